@@ -0,0 +1,204 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"gopkg.in/yaml.v3"
+)
+
+// adminSetting maps a Finnish /aseta name to a Config field, the description is setting_<name> in the catalog
+type adminSetting struct {
+	Name  string
+	Field string
+}
+
+var adminSettings = []adminSetting{
+	{"valmis", "ReadyThreshold"},
+	{"nollaus", "ResetThreshold"},
+	{"lampiaa", "WarmingThreshold"},
+	{"ylikuumeneminen", "OverheatThreshold"},
+	{"sessio", "MaxSessionDuration"},
+	{"eidataa", "NoDataThreshold"},
+	{"paristo", "BatteryLowThreshold"},
+	{"hiljainen_alku", "QuietHoursStart"},
+	{"hiljainen_loppu", "QuietHoursEnd"},
+}
+
+func findAdminSetting(name string) (adminSetting, bool) {
+	for _, s := range adminSettings {
+		if s.Name == name {
+			return s, true
+		}
+	}
+	return adminSetting{}, false
+}
+
+// Return the yaml and env names of a Config field
+func configFieldTags(field string) (yamlName, envName string) {
+	f, _ := reflect.TypeOf(Config{}).FieldByName(field)
+	return f.Tag.Get("yaml"), f.Tag.Get("env")
+}
+
+func configFieldValue(config *Config, field string) string {
+	return fmt.Sprint(reflect.ValueOf(config).Elem().FieldByName(field).Interface())
+}
+
+// Set a config value by its /aseta name. The change is validated on a copy
+// so that an invalid value never reaches the running config.
+func setAdminSetting(configs *ConfigStore, name, value string) (old string, err error) {
+	setting, ok := findAdminSetting(name)
+	if !ok {
+		return "", &MessageError{Key: "setting_unknown", Args: []any{name}}
+	}
+
+	err = configs.update(func(config *Config) error {
+		old = configFieldValue(config, setting.Field)
+		if err := setField(reflect.ValueOf(config).Elem().FieldByName(setting.Field), value); err != nil {
+			return &MessageError{Key: "setting_invalid_value", Args: []any{value, err}}
+		}
+		return config.Validate()
+	})
+	return old, err
+}
+
+// Write a single value to the YAML config file, keeping the rest of the file and its comments intact
+func saveConfigValue(path, key, value string) error {
+	var doc yaml.Node
+	data, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if len(data) > 0 {
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return err
+		}
+	}
+	if doc.Kind == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+
+	mapping := doc.Content[0]
+	if mapping.Kind != yaml.MappingNode {
+		return fmt.Errorf("%s is not a YAML mapping", path)
+	}
+
+	valueNode := &yaml.Node{}
+	if err := valueNode.Encode(value); err != nil {
+		return err
+	}
+	// Store numbers as numbers instead of quoted strings
+	var number float64
+	if yaml.Unmarshal([]byte(value), &number) == nil {
+		valueNode = &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+	}
+
+	found := false
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			valueNode.LineComment = mapping.Content[i+1].LineComment
+			mapping.Content[i+1] = valueNode
+			found = true
+			break
+		}
+	}
+	if !found {
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: key}, valueNode)
+	}
+
+	out, err := yaml.Marshal(&doc)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, out, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func formatAdminSettings(config *Config, locale Locale) string {
+	var sb strings.Builder
+	for _, s := range adminSettings {
+		fmt.Fprintf(&sb, "%s = %s\n  %s\n", s.Name, configFieldValue(config, s.Field), locale.T("setting_"+s.Name))
+	}
+	return locale.T("settings", sb.String())
+}
+
+func userName(user *models.User) string {
+	if user == nil {
+		return "unknown"
+	}
+	if user.Username != "" {
+		return fmt.Sprintf("@%s (%d)", user.Username, user.ID)
+	}
+	return fmt.Sprintf("%s (%d)", user.FirstName, user.ID)
+}
+
+// Return the command of a message without the arguments and the @bot suffix
+func commandName(text string) string {
+	command, _, _ := strings.Cut(text, " ")
+	command, _, _ = strings.Cut(command, "@")
+	return command
+}
+
+func replyText(ctx context.Context, b TelegramBot, update *models.Update, text string) {
+	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: update.Message.Chat.ID,
+		Text:   text,
+	})
+	if err != nil {
+		fmt.Printf("Failed to send message: %v\n", err)
+	}
+}
+
+// Handler for /aseta <nimi> <arvo>
+func handleSetCommand(ctx context.Context, b TelegramBot, configs *ConfigStore, langs *Languages, update *models.Update) {
+	locale := langs.For(configs.Load(), update.Message.Chat.ID)
+	args := strings.Fields(update.Message.Text)
+	if len(args) != 3 {
+		replyText(ctx, b, update, locale.T("set_usage", formatAdminSettings(configs.Load(), locale)))
+		return
+	}
+	name, value := args[1], args[2]
+
+	// A value in the file would have no effect, the environment variable wins on every reload
+	if setting, ok := findAdminSetting(name); ok {
+		if _, envName := configFieldTags(setting.Field); os.Getenv(envName) != "" {
+			replyText(ctx, b, update, locale.T("set_env", envName))
+			return
+		}
+	}
+
+	old, err := setAdminSetting(configs, name, value)
+	if err != nil {
+		replyText(ctx, b, update, locale.T("set_rejected", locale.Error(err)))
+		return
+	}
+
+	config := configs.Load()
+	setting, _ := findAdminSetting(name)
+	newValue := configFieldValue(config, setting.Field)
+	log.Printf("Config %s changed from %s to %s by %s\n", setting.Field, old, newValue, userName(update.Message.From))
+
+	yamlName, _ := configFieldTags(setting.Field)
+	reply := fmt.Sprintf("%s: %s → %s", name, old, newValue)
+	if err := configs.saveValue(yamlName, value); err != nil {
+		log.Printf("Failed to save config: %v\n", err)
+		reply += locale.T("set_save_failed")
+	}
+	replyText(ctx, b, update, reply)
+}
+
+// Handler for /asetukset
+func handleSettingsCommand(ctx context.Context, b TelegramBot, config *Config, langs *Languages, update *models.Update) {
+	replyText(ctx, b, update, formatAdminSettings(config, langs.For(config, update.Message.Chat.ID)))
+}
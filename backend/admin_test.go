@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+)
+
+func newCommandUpdate(chatID int64, text string) *models.Update {
+	return &models.Update{
+		Message: &models.Message{
+			Chat: models.Chat{ID: chatID},
+			From: &models.User{ID: 42, Username: "tonttu"},
+			Text: text,
+		},
+	}
+}
+
+func TestSetAdminSetting_Validation(t *testing.T) {
+	config := DefaultConfig()
+	config.TelegramBotToken = "token"
+	config.MaintenanceChatID = 1
+	config.NotificationChatID = 2
+	configs := NewConfigStore(config)
+
+	old, err := setAdminSetting(configs, "valmis", "75")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if old != "70" || configs.Load().ReadyThreshold != 75 {
+		t.Errorf("Expected ready threshold 70 → 75, got %s → %v", old, configs.Load().ReadyThreshold)
+	}
+	// The snapshot taken before the change is not modified
+	if config.ReadyThreshold != 70 {
+		t.Errorf("Expected the old snapshot to be unchanged, got %v", config.ReadyThreshold)
+	}
+
+	if _, err := setAdminSetting(configs, "nollaus", "80"); err == nil {
+		t.Errorf("Expected reset threshold above ready threshold to be rejected")
+	}
+	if configs.Load().ResetThreshold != 40 {
+		t.Errorf("Expected reset threshold to be unchanged, got %v", configs.Load().ResetThreshold)
+	}
+
+	if _, err := setAdminSetting(configs, "sessio", "3h"); err != nil || configs.Load().MaxSessionDuration != 3*time.Hour {
+		t.Errorf("Expected session duration 3h, got %v (%v)", configs.Load().MaxSessionDuration, err)
+	}
+
+	if _, err := setAdminSetting(configs, "tuntematon", "1"); err == nil {
+		t.Errorf("Expected unknown setting to be rejected")
+	}
+}
+
+func TestSaveConfigValue_KeepsComments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	content := "# Sauna\nready_threshold: 70 # °C\nreset_threshold: 40\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := saveConfigValue(path, "ready_threshold", "75"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := saveConfigValue(path, "max_session_duration", "3h"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"# Sauna", "ready_threshold: 75 # °C", "reset_threshold: 40", "max_session_duration: 3h"} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Expected %q in the saved file, got:\n%s", expected, data)
+		}
+	}
+}
+
+func TestHandleSetCommand(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	config := DefaultConfig()
+	config.TelegramBotToken = "token"
+	config.MaintenanceChatID = 1
+	config.NotificationChatID = 2
+	config.path = path
+
+	mockBot := &MockTelegramBot{}
+	ctx := context.Background()
+
+	configs := NewConfigStore(config)
+	handleSetCommand(ctx, mockBot, configs, nil, newCommandUpdate(1, "/aseta valmis 75"))
+	if configs.Load().ReadyThreshold != 75 {
+		t.Errorf("Expected ready threshold 75, got %v", configs.Load().ReadyThreshold)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil || !strings.Contains(string(data), "ready_threshold: 75") {
+		t.Errorf("Expected change to be saved, got %q (%v)", data, err)
+	}
+	// The watcher skips the reload of the bot's own write
+	if info, err := os.Stat(path); err != nil || !configs.ownWrite(info.ModTime()) {
+		t.Errorf("Expected the write to be recognised as the bot's own, got %v", err)
+	}
+
+	// A reload would apply the environment variable again, so the change is refused
+	t.Setenv("SAUNA_READY_THRESHOLD", "75")
+	handleSetCommand(ctx, mockBot, configs, nil, newCommandUpdate(1, "/aseta valmis 80"))
+	if configs.Load().ReadyThreshold != 75 {
+		t.Errorf("Expected the env override to keep ready threshold 75, got %v", configs.Load().ReadyThreshold)
+	}
+	if reply := mockBot.SentMessages[len(mockBot.SentMessages)-1]; !strings.Contains(reply, "SAUNA_READY_THRESHOLD") {
+		t.Errorf("Expected the reply to name the environment variable, got %q", reply)
+	}
+}
+
+func TestCommandName(t *testing.T) {
+	tests := map[string]string{
+		"/aseta valmis 75":         "/aseta",
+		"/asetukset":               "/asetukset",
+		"/aseta@HikitonttuBot x":   "/aseta",
+		"/asetukset@HikitonttuBot": "/asetukset",
+	}
+	for text, expected := range tests {
+		if got := commandName(text); got != expected {
+			t.Errorf("commandName(%q) = %q, expected %q", text, got, expected)
+		}
+	}
+}
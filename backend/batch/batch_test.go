@@ -0,0 +1,186 @@
+package batch
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Data format 5 example from the Ruuvi documentation, as sent by the proxy in the raw format
+const rawData = "99040512FC5394C37C0004FFFC040CAC364200CDCBB8334C884F"
+
+// Version 1 batch of two readings ten seconds apart, written out by hand from the schema:
+// array(2), uint32 base, array(2) of array(2) with the offset and a 26 byte string
+const goldenV1 = "82" + "1A676AF6A0" + "82" +
+	"82" + "00" + "581A" + rawData +
+	"82" + "0A" + "581A" + rawData
+
+func mustDecodeHex(t testing.TB, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func testReadings(t testing.TB) []Reading {
+	base := time.Unix(1735063200, 0)
+	return []Reading{
+		{Time: base, Data: mustDecodeHex(t, rawData)},
+		{Time: base.Add(10 * time.Second), Data: mustDecodeHex(t, rawData)},
+	}
+}
+
+func equalReadings(a, b []Reading) bool {
+	return slices.EqualFunc(a, b, func(x, y Reading) bool {
+		return x.Time.Equal(y.Time) && bytes.Equal(x.Data, y.Data)
+	})
+}
+
+func TestEncode_Golden(t *testing.T) {
+	encoded, err := Encode(testReadings(t))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if got := strings.ToUpper(hex.EncodeToString(encoded)); got != goldenV1 {
+		t.Errorf("Expected the documented encoding\n%s\ngot\n%s", goldenV1, got)
+	}
+}
+
+func TestDecode_Golden(t *testing.T) {
+	readings, err := Decode(mustDecodeHex(t, goldenV1), 1)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !equalReadings(readings, testReadings(t)) {
+		t.Errorf("Unexpected readings %v", readings)
+	}
+}
+
+func TestEncode_RoundTrip(t *testing.T) {
+	base := time.Date(2024, 12, 24, 18, 0, 0, 0, time.UTC)
+	readings := []Reading{
+		{Time: base.Add(500 * time.Millisecond), Data: []byte{0x99, 0x04, 0x05}},
+		// Readings are not reordered, offsets can be negative
+		{Time: base.Add(-time.Hour), Data: []byte{}},
+		{Time: base.Add(24 * time.Hour), Data: bytes.Repeat([]byte{0xFF}, 40)},
+	}
+	encoded, err := Encode(readings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(encoded, Version)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Only whole seconds are kept
+	readings[0].Time = base
+	readings[1].Data = nil
+	if !equalReadings(decoded, readings) {
+		t.Errorf("Expected %v, got %v", readings, decoded)
+	}
+
+	if encoded, err := Encode(nil); err != nil {
+		t.Fatal(err)
+	} else if decoded, err := Decode(encoded, Version); err != nil || len(decoded) != 0 {
+		t.Errorf("Expected an empty batch, got %v, %v", decoded, err)
+	}
+	if _, err := Encode(make([]Reading, MaxReadings+1)); err == nil {
+		t.Errorf("Expected an error for a too large batch")
+	}
+}
+
+func TestDecode_Invalid(t *testing.T) {
+	if _, err := Decode(mustDecodeHex(t, goldenV1), 2); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected an unsupported version error, got %v", err)
+	}
+	invalid := []string{
+		"",
+		goldenV1[:20],        // truncated
+		"A0",                 // map instead of an array
+		"8301028080",         // too many fields
+		"82" + "00" + "8101", // reading is not an array
+	}
+	for _, s := range invalid {
+		if _, err := Decode(mustDecodeHex(t, s), 1); err == nil {
+			t.Errorf("Expected %s to be rejected", s)
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	for header, want := range map[string]int{"": 1, "1": 1} {
+		if version, err := ParseVersion(header); err != nil || version != want {
+			t.Errorf("Expected version %d for %q, got %d, %v", want, header, version, err)
+		}
+	}
+	for _, header := range []string{"0", "2", "v1", "-1"} {
+		if _, err := ParseVersion(header); !errors.Is(err, ErrUnsupportedVersion) {
+			t.Errorf("Expected %q to be unsupported, got %v", header, err)
+		}
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	data := mustDecodeHex(t, goldenV1)
+	compressed, err := Gzip(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, encoding := range []string{"", "identity", "gzip"} {
+		body := data
+		if encoding == "gzip" {
+			body = compressed
+		}
+		r, err := NewReader(bytes.NewReader(body), encoding, int64(len(data)))
+		if err != nil {
+			t.Fatalf("%q: unexpected error: %v", encoding, err)
+		}
+		if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%q: expected the body back, got %v", encoding, err)
+		}
+	}
+
+	// The limit applies to the decompressed body
+	r, err := NewReader(bytes.NewReader(compressed), "gzip", int64(len(data)-1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadAll(r); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Expected the body to be too large, got %v", err)
+	}
+
+	if _, err := NewReader(bytes.NewReader(data), "br", 100); !errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("Expected an unsupported encoding to be rejected")
+	}
+	if _, err := NewReader(bytes.NewReader(data), "gzip", 100); err == nil || errors.Is(err, ErrUnsupportedEncoding) {
+		t.Errorf("Expected an invalid gzip body to be rejected, got %v", err)
+	}
+}
+
+func FuzzDecode(f *testing.F) {
+	f.Add(mustDecodeHex(f, goldenV1))
+	f.Add([]byte{0x82, 0x00, 0x80})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		readings, err := Decode(data, 1)
+		if err != nil {
+			return
+		}
+		// Anything that decodes encodes back to the same readings
+		encoded, err := Encode(readings)
+		if err != nil {
+			t.Fatalf("Failed to encode %v: %v", readings, err)
+		}
+		decoded, err := Decode(encoded, 1)
+		if err != nil || !equalReadings(decoded, readings) {
+			t.Fatalf("Round trip of %v failed: %v, %v", readings, decoded, err)
+		}
+	})
+}
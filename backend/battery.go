@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// How often a battery reading is stored in the history
+	batteryRecordInterval = time.Hour
+	// How long the battery history is kept for the life estimate
+	batteryHistoryLength = 60 * 24 * time.Hour
+	// Temperature the compensated voltage is normalized to
+	batteryReferenceTemp = 25.0
+)
+
+// BatteryReading is a temperature compensated battery voltage in millivolts
+type BatteryReading struct {
+	Time    time.Time `json:"time"`
+	Voltage float64   `json:"voltage"`
+}
+
+func batteryHistoryPath(config *Config) string {
+	return filepath.Join(config.DataDir, "battery.json")
+}
+
+// LoadBatteryHistory reads the battery history from the data directory so that the
+// discharge trend survives restarts
+func (k *Kiuas) LoadBatteryHistory(config *Config) error {
+	return loadJSON(batteryHistoryPath(config), &k.BatteryHistory)
+}
+
+// Battery voltage normalized to batteryReferenceTemp, since the coin cell voltage
+// sags noticeably in the heat of the sauna. BatteryTempCoefficient is the sag in mV
+// per °C and positive, so a hot reading is raised and a cold one lowered.
+func (k *Kiuas) CompensatedBattery(config *Config) float64 {
+	return float64(k.Battery) + config.BatteryTempCoefficient*(k.Temperature-batteryReferenceTemp)
+}
+
+// Store the compensated battery voltage at most once per batteryRecordInterval and save the history
+func (k *Kiuas) AddBatteryRecord(config *Config, t time.Time) {
+	if k.Battery == 0 {
+		return
+	}
+	if n := len(k.BatteryHistory); n > 0 && t.Sub(k.BatteryHistory[n-1].Time) < batteryRecordInterval {
+		return
+	}
+
+	k.BatteryHistory = append(k.BatteryHistory, BatteryReading{Time: t, Voltage: k.CompensatedBattery(config)})
+
+	cutoff := t.Add(-batteryHistoryLength)
+	i := 0
+	for i < len(k.BatteryHistory) && k.BatteryHistory[i].Time.Before(cutoff) {
+		i++
+	}
+	k.BatteryHistory = k.BatteryHistory[i:]
+
+	if config.DataDir == "" {
+		return
+	}
+	if err := saveJSON(batteryHistoryPath(config), k.BatteryHistory); err != nil {
+		log.Printf("Failed to save battery history: %v\n", err)
+	}
+}
+
+// Battery discharge rate in millivolts per day using a least squares fit over the history
+func (k *Kiuas) batteryDischargeRate() float64 {
+	if len(k.BatteryHistory) < 2 {
+		return 0
+	}
+
+	start := k.BatteryHistory[0].Time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, r := range k.BatteryHistory {
+		x := r.Time.Sub(start).Hours() / 24
+		sumX += x
+		sumY += r.Voltage
+		sumXY += x * r.Voltage
+		sumXX += x * x
+	}
+
+	n := float64(len(k.BatteryHistory))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+// Estimate how long until the battery reaches BatteryLowThreshold.
+// Returns false if the battery is not discharging measurably.
+func (k *Kiuas) EstimateBatteryLife(config *Config) (time.Duration, bool) {
+	rate := k.batteryDischargeRate()
+	if rate >= 0 || len(k.BatteryHistory) == 0 {
+		return 0, false
+	}
+
+	remaining := k.BatteryHistory[len(k.BatteryHistory)-1].Voltage - config.BatteryLowThreshold
+	if remaining <= 0 {
+		return 0, true
+	}
+	days := remaining / -rate
+	if days > 10*365 {
+		return 0, false
+	}
+	return time.Duration(days * 24 * float64(time.Hour)), true
+}
+
+// Human readable battery summary for /info
+func (k *Kiuas) BatteryStatus(config *Config) string {
+	status := fmt.Sprintf("%d mV (compensated %.0f mV)", k.Battery, k.CompensatedBattery(config))
+	if life, ok := k.EstimateBatteryLife(config); ok {
+		status += fmt.Sprintf(", ~%d days left", int(math.Round(life.Hours()/24)))
+	}
+	return status
+}
+
+// Function to check the battery level and send replacement reminders to the maintenance chat.
+// The alert clears only after the voltage has risen BatteryHysteresis above the threshold.
+func checkBattery(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, langs *Languages, currentTime time.Time) {
+	kiuas.AddBatteryRecord(config, currentTime)
+
+	if config.BatteryLowThreshold <= 0 || len(kiuas.BatteryHistory) == 0 {
+		return
+	}
+
+	// Use the stored hourly value so that a single low reading does not trigger the alert
+	voltage := kiuas.BatteryHistory[len(kiuas.BatteryHistory)-1].Voltage
+
+	if kiuas.BatteryLowAlertSent {
+		if voltage >= config.BatteryLowThreshold+config.BatteryHysteresis {
+			log.Printf("Battery level recovered to %.0f mV\n", voltage)
+			kiuas.BatteryLowAlertSent = false
+			kiuas.LastBatteryReminder = time.Time{}
+			sendLocalized(b, ctx, config, langs, config.MaintenanceChatID, "battery_ok", voltage)
+			return
+		}
+		if config.BatteryReminderInterval <= 0 || currentTime.Sub(kiuas.LastBatteryReminder) < config.BatteryReminderInterval {
+			return
+		}
+	} else if voltage >= config.BatteryLowThreshold {
+		return
+	}
+
+	log.Printf("Battery low: %.0f mV\n", voltage)
+	kiuas.BatteryLowAlertSent = true
+	kiuas.LastBatteryReminder = currentTime
+	sendLocalized(b, ctx, config, langs, config.MaintenanceChatID, "battery_low", voltage, config.BatteryLowThreshold)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCompensatedBattery(t *testing.T) {
+	kiuas := &Kiuas{Battery: 2900, Temperature: 85.0}
+	config := &Config{BatteryTempCoefficient: 1.0}
+
+	// The voltage sags in the heat, a hot reading is compensated upward
+	if got := kiuas.CompensatedBattery(config); got != 2960 || got <= float64(kiuas.Battery) {
+		t.Errorf("Expected 2960 mV, got %.0f", got)
+	}
+	kiuas.Temperature = 5.0
+	if got := kiuas.CompensatedBattery(config); got != 2880 {
+		t.Errorf("Expected a cold reading to be compensated downward to 2880 mV, got %.0f", got)
+	}
+}
+
+func TestEstimateBatteryLife(t *testing.T) {
+	start := time.Now()
+	kiuas := &Kiuas{}
+	config := &Config{BatteryLowThreshold: 2500}
+
+	// Discharging 2 mV per day
+	for day := 0; day < 30; day++ {
+		kiuas.BatteryHistory = append(kiuas.BatteryHistory, BatteryReading{
+			Time:    start.Add(time.Duration(day) * 24 * time.Hour),
+			Voltage: 2800 - 2*float64(day),
+		})
+	}
+
+	life, ok := kiuas.EstimateBatteryLife(config)
+	if !ok {
+		t.Fatalf("Expected a battery life estimate")
+	}
+	// 2742 mV left at the end, 242 mV to go at 2 mV per day
+	if days := life.Hours() / 24; days < 120 || days > 122 {
+		t.Errorf("Expected about 121 days, got %.1f", days)
+	}
+}
+
+func TestCheckBattery_Hysteresis(t *testing.T) {
+	currentTime := time.Now()
+	kiuas := &Kiuas{Battery: 2450, Temperature: 25.0}
+
+	mockBot := &MockTelegramBot{}
+
+	config := &Config{
+		MaintenanceChatID:       1,
+		BatteryLowThreshold:     2500,
+		BatteryHysteresis:       100,
+		BatteryReminderInterval: 7 * 24 * time.Hour,
+	}
+
+	ctx := context.Background()
+
+	checkBattery(mockBot, ctx, kiuas, config, nil, currentTime)
+	if !kiuas.BatteryLowAlertSent || len(mockBot.SentMessages) != 1 {
+		t.Fatalf("Expected low battery alert, got %d messages", len(mockBot.SentMessages))
+	}
+
+	// Slightly above the threshold is not enough to clear the alert
+	kiuas.Battery = 2550
+	checkBattery(mockBot, ctx, kiuas, config, nil, currentTime.Add(2*time.Hour))
+	if !kiuas.BatteryLowAlertSent || len(mockBot.SentMessages) != 1 {
+		t.Fatalf("Expected alert to stay active, got %d messages", len(mockBot.SentMessages))
+	}
+
+	// Reminder after BatteryReminderInterval
+	kiuas.Battery = 2450
+	checkBattery(mockBot, ctx, kiuas, config, nil, currentTime.Add(8*24*time.Hour))
+	if len(mockBot.SentMessages) != 2 {
+		t.Fatalf("Expected a reminder, got %d messages", len(mockBot.SentMessages))
+	}
+
+	// New battery clears the alert
+	kiuas.Battery = 3000
+	checkBattery(mockBot, ctx, kiuas, config, nil, currentTime.Add(9*24*time.Hour))
+	if kiuas.BatteryLowAlertSent || len(mockBot.SentMessages) != 3 {
+		t.Fatalf("Expected alert to be cleared, got %d messages", len(mockBot.SentMessages))
+	}
+}
+
+func TestBatteryHistory_Persisted(t *testing.T) {
+	start := time.Date(2024, 12, 1, 12, 0, 0, 0, time.UTC)
+	config := &Config{DataDir: t.TempDir(), BatteryTempCoefficient: 1.0}
+	kiuas := &Kiuas{Battery: 2900, Temperature: 25.0}
+
+	kiuas.AddBatteryRecord(config, start)
+	kiuas.Battery = 2890
+	kiuas.AddBatteryRecord(config, start.Add(24*time.Hour))
+
+	loaded := &Kiuas{}
+	if err := loaded.LoadBatteryHistory(config); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(loaded.BatteryHistory) != 2 || !loaded.BatteryHistory[0].Time.Equal(start) || loaded.BatteryHistory[1].Voltage != 2890 {
+		t.Errorf("Expected the history to be loaded from disk, got %+v", loaded.BatteryHistory)
+	}
+}
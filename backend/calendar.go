@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// How far back finished sessions are included in the calendar
+const calendarSessionHistory = 30 * 24 * time.Hour
+
+// VTIMEZONE for Europe/Helsinki, EET/EEST with the EU daylight saving rules
+const helsinkiTimezone = "BEGIN:VTIMEZONE\r\n" +
+	"TZID:Europe/Helsinki\r\n" +
+	"BEGIN:DAYLIGHT\r\n" +
+	"TZOFFSETFROM:+0200\r\n" +
+	"TZOFFSETTO:+0300\r\n" +
+	"TZNAME:EEST\r\n" +
+	"DTSTART:19700329T030000\r\n" +
+	"RRULE:FREQ=YEARLY;BYMONTH=3;BYDAY=-1SU\r\n" +
+	"END:DAYLIGHT\r\n" +
+	"BEGIN:STANDARD\r\n" +
+	"TZOFFSETFROM:+0300\r\n" +
+	"TZOFFSETTO:+0200\r\n" +
+	"TZNAME:EET\r\n" +
+	"DTSTART:19701025T040000\r\n" +
+	"RRULE:FREQ=YEARLY;BYMONTH=10;BYDAY=-1SU\r\n" +
+	"END:STANDARD\r\n" +
+	"END:VTIMEZONE\r\n"
+
+// CalendarTokens maps personal calendar feed tokens to Telegram user IDs
+type CalendarTokens struct {
+	mu     sync.RWMutex
+	path   string
+	Tokens map[string]int64 `json:"tokens"`
+}
+
+// LoadCalendarTokens reads the saved tokens from the data directory
+func LoadCalendarTokens(config *Config) (*CalendarTokens, error) {
+	t := &CalendarTokens{
+		path:   filepath.Join(config.DataDir, "calendar_tokens.json"),
+		Tokens: make(map[string]int64),
+	}
+	if err := loadJSON(t.path, t); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// TokenFor returns the token of a user, creating a new one if needed
+func (t *CalendarTokens) TokenFor(userID int64) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for token, id := range t.Tokens {
+		if id == userID {
+			return token, nil
+		}
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+	t.Tokens[token] = userID
+	return token, saveJSON(t.path, t)
+}
+
+// User returns the user of a token
+func (t *CalendarTokens) User(token string) (int64, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	userID, ok := t.Tokens[token]
+	return userID, ok
+}
+
+// Escape TEXT values as specified in RFC 5545 section 3.3.11
+func icalEscape(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`,
+		";", `\;`,
+		",", `\,`,
+		"\r\n", `\n`,
+		"\n", `\n`,
+	).Replace(value)
+}
+
+// Fold a content line to at most 75 octets without splitting UTF-8 characters
+func icalFold(line string) string {
+	var sb strings.Builder
+	width := 0
+	for _, r := range line {
+		size := len(string(r))
+		if width+size > 75 {
+			sb.WriteString("\r\n ")
+			width = 1
+		}
+		sb.WriteRune(r)
+		width += size
+	}
+	sb.WriteString("\r\n")
+	return sb.String()
+}
+
+type calendarEvent struct {
+	UID         string
+	Start, End  time.Time
+	Summary     string
+	Description string
+}
+
+// Render the events as an iCalendar document with times in Europe/Helsinki
+func renderCalendar(events []calendarEvent, now time.Time) string {
+	loc, err := time.LoadLocation("Europe/Helsinki")
+	if err != nil {
+		loc = time.Local
+	}
+
+	var sb strings.Builder
+	sb.WriteString("BEGIN:VCALENDAR\r\n")
+	sb.WriteString("VERSION:2.0\r\n")
+	sb.WriteString("PRODID:-//Hamalais-Osakunta//Saunatonttu//FI\r\n")
+	sb.WriteString("CALSCALE:GREGORIAN\r\n")
+	sb.WriteString("X-WR-CALNAME:Hikiän sauna\r\n")
+	sb.WriteString("X-WR-TIMEZONE:Europe/Helsinki\r\n")
+	sb.WriteString(helsinkiTimezone)
+
+	for _, e := range events {
+		sb.WriteString("BEGIN:VEVENT\r\n")
+		sb.WriteString(icalFold("UID:" + e.UID))
+		sb.WriteString("DTSTAMP:" + now.UTC().Format("20060102T150405Z") + "\r\n")
+		sb.WriteString("DTSTART;TZID=Europe/Helsinki:" + e.Start.In(loc).Format("20060102T150405") + "\r\n")
+		sb.WriteString("DTEND;TZID=Europe/Helsinki:" + e.End.In(loc).Format("20060102T150405") + "\r\n")
+		sb.WriteString(icalFold("SUMMARY:" + icalEscape(e.Summary)))
+		if e.Description != "" {
+			sb.WriteString(icalFold("DESCRIPTION:" + icalEscape(e.Description)))
+		}
+		sb.WriteString("END:VEVENT\r\n")
+	}
+
+	sb.WriteString("END:VCALENDAR\r\n")
+	return sb.String()
+}
+
+// Build the calendar events. Reservations of other users are shown without names
+// unless the feed belongs to an admin, the user's own reservations are shown in full.
+func calendarEvents(kiuas *Kiuas, reservations *Reservations, userID int64, showNames bool, now time.Time) []calendarEvent {
+	var events []calendarEvent
+
+	for _, res := range reservations.All() {
+		summary := "Sauna varattu"
+		if res.UserID == userID || showNames {
+			summary = "Saunavuoro: " + res.Name
+		}
+		events = append(events, calendarEvent{
+			UID:     fmt.Sprintf("reservation-%d@saunatonttu", res.ID),
+			Start:   res.Start,
+			End:     res.End,
+			Summary: summary,
+		})
+	}
+
+	for _, session := range kiuas.SessionsSnapshot() {
+		if now.Sub(session.End) > calendarSessionHistory {
+			continue
+		}
+		description := fmt.Sprintf("Korkein lämpötila %.1f °C", session.MaxTemperature)
+		if !session.Ready.IsZero() {
+			description += "\nValmis klo " + session.Ready.Format("15:04")
+		}
+		if session.LoylyCount > 0 {
+			description += fmt.Sprintf("\nLöylyjä %d", session.LoylyCount)
+		}
+		events = append(events, calendarEvent{
+			UID:         fmt.Sprintf("session-%d@saunatonttu", session.Start.Unix()),
+			Start:       session.Start,
+			End:         session.End,
+			Summary:     "Sauna lämmitetty",
+			Description: description,
+		})
+	}
+
+	return events
+}
+
+// Handler for GET /api/calendar.ics?token=<token>. Without a token the feed only
+// shows anonymous reservations, or nothing at all if CalendarRequireToken is set.
+func handleCalendar(w http.ResponseWriter, r *http.Request, kiuas *Kiuas, config *Config, auth *Authorizer, reservations *Reservations, tokens *CalendarTokens) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var userID int64
+	showNames := false
+	if token := r.URL.Query().Get("token"); token != "" {
+		id, ok := tokens.User(token)
+		if !ok {
+			http.Error(w, "Invalid token", http.StatusForbidden)
+			return
+		}
+		userID = id
+		showNames = auth.RoleFor(userID, userID) >= RoleAdmin
+	} else if config.CalendarRequireToken {
+		http.Error(w, "Token required", http.StatusUnauthorized)
+		return
+	}
+
+	now := time.Now()
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	w.Header().Set("Content-Disposition", `inline; filename="sauna.ics"`)
+	fmt.Fprint(w, renderCalendar(calendarEvents(kiuas, reservations, userID, showNames, now), now))
+}
+
+// Handler for /kalenteri, sends the personal calendar link as a direct message
+func handleCalendarCommand(ctx context.Context, b TelegramBot, config *Config, tokens *CalendarTokens, langs *Languages, update *models.Update) {
+	if update.Message.From == nil {
+		return
+	}
+	userID := update.Message.From.ID
+	locale := langs.For(config, update.Message.Chat.ID)
+	if config.PublicURL == "" {
+		replyText(ctx, b, update, locale.T("calendar_disabled"))
+		return
+	}
+
+	token, err := tokens.TokenFor(userID)
+	if err != nil {
+		log.Printf("Failed to save calendar tokens: %v\n", err)
+		replyText(ctx, b, update, locale.T("calendar_failed"))
+		return
+	}
+
+	link := strings.TrimSuffix(config.PublicURL, "/") + "/api/calendar.ics?token=" + token
+	if update.Message.Chat.ID != userID {
+		replyText(ctx, b, update, locale.T("calendar_sent_private"))
+	}
+	// The link goes to the private chat, in the language of the user
+	_, err = b.SendMessage(ctx, &bot.SendMessageParams{
+		ChatID: userID,
+		Text:   langs.For(config, userID).T("calendar_link", link),
+	})
+	if err != nil {
+		fmt.Printf("Failed to send message: %v\n", err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestIcalFold(t *testing.T) {
+	line := "DESCRIPTION:" + strings.Repeat("ä", 60)
+	for _, part := range strings.Split(strings.TrimSuffix(icalFold(line), "\r\n"), "\r\n") {
+		if len(part) > 75 {
+			t.Errorf("Line longer than 75 octets: %d", len(part))
+		}
+	}
+	if unfolded := strings.ReplaceAll(strings.TrimSuffix(icalFold(line), "\r\n"), "\r\n ", ""); unfolded != line {
+		t.Errorf("Expected unfolding to restore the line, got %q", unfolded)
+	}
+}
+
+func TestIcalEscape(t *testing.T) {
+	if got := icalEscape("a,b;c\\d\ne"); got != `a\,b\;c\\d\ne` {
+		t.Errorf("Unexpected escaping: %s", got)
+	}
+}
+
+func TestRenderCalendar_HelsinkiTime(t *testing.T) {
+	start := time.Date(2024, 7, 1, 15, 0, 0, 0, time.UTC)
+	ics := renderCalendar([]calendarEvent{{UID: "test@saunatonttu", Start: start, End: start.Add(time.Hour), Summary: "Sauna"}}, start)
+
+	for _, expected := range []string{
+		"BEGIN:VCALENDAR\r\n",
+		"TZID:Europe/Helsinki\r\n",
+		"DTSTART;TZID=Europe/Helsinki:20240701T180000\r\n",
+		"DTEND;TZID=Europe/Helsinki:20240701T190000\r\n",
+		"END:VCALENDAR\r\n",
+	} {
+		if !strings.Contains(ics, expected) {
+			t.Errorf("Expected %q in the calendar, got:\n%s", expected, ics)
+		}
+	}
+}
+
+func TestHandleCalendar_HidesOtherUsersNames(t *testing.T) {
+	config := &Config{DataDir: t.TempDir(), MaintenanceChatID: -100}
+	auth, _ := LoadAuthorizer(NewConfigStore(config))
+	reservations, _ := LoadReservations(config)
+	tokens, _ := LoadCalendarTokens(config)
+
+	start := time.Now().Add(24 * time.Hour)
+	reservations.Add(Reservation{UserID: 1, Name: "@matti", Start: start, End: start.Add(time.Hour)}, time.Now())
+	reservations.Add(Reservation{UserID: 2, Name: "@maija", Start: start.Add(2 * time.Hour), End: start.Add(3 * time.Hour)}, time.Now())
+
+	kiuas := &Kiuas{}
+
+	recorder := httptest.NewRecorder()
+	handleCalendar(recorder, httptest.NewRequest(http.MethodGet, "/api/calendar.ics", nil), kiuas, config, auth, reservations, tokens)
+	if strings.Contains(recorder.Body.String(), "@matti") || strings.Count(recorder.Body.String(), "SUMMARY:Sauna varattu") != 2 {
+		t.Errorf("Expected anonymous reservations without a token, got:\n%s", recorder.Body.String())
+	}
+
+	token, err := tokens.TokenFor(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorder = httptest.NewRecorder()
+	handleCalendar(recorder, httptest.NewRequest(http.MethodGet, "/api/calendar.ics?token="+token, nil), kiuas, config, auth, reservations, tokens)
+	body := recorder.Body.String()
+	if !strings.Contains(body, "@matti") || strings.Contains(body, "@maija") {
+		t.Errorf("Expected only the own reservation with a name, got:\n%s", body)
+	}
+
+	recorder = httptest.NewRecorder()
+	handleCalendar(recorder, httptest.NewRequest(http.MethodGet, "/api/calendar.ics?token=wrong", nil), kiuas, config, auth, reservations, tokens)
+	if recorder.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 for an invalid token, got %d", recorder.Code)
+	}
+
+	config.CalendarRequireToken = true
+	recorder = httptest.NewRecorder()
+	handleCalendar(recorder, httptest.NewRequest(http.MethodGet, "/api/calendar.ics", nil), kiuas, config, auth, reservations, tokens)
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without a token, got %d", recorder.Code)
+	}
+}
+
+func TestHandleCalendarCommand_RequiresPublicURL(t *testing.T) {
+	config := &Config{DataDir: t.TempDir()}
+	tokens, _ := LoadCalendarTokens(config)
+	mockBot := &MockTelegramBot{}
+
+	handleCalendarCommand(context.Background(), mockBot, config, tokens, nil, newCommandUpdate(42, "/kalenteri"))
+	if len(mockBot.SentMessages) != 1 || strings.Contains(mockBot.SentMessages[0], "/api/calendar.ics") {
+		t.Errorf("Expected no link without public_url, got %v", mockBot.SentMessages)
+	}
+
+	config.PublicURL = "https://sauna.example.org/"
+	handleCalendarCommand(context.Background(), mockBot, config, tokens, nil, newCommandUpdate(42, "/kalenteri"))
+	if last := mockBot.SentMessages[len(mockBot.SentMessages)-1]; !strings.Contains(last, "https://sauna.example.org/api/calendar.ics?token=") {
+		t.Errorf("Expected an absolute link, got %q", last)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	chartWidth  = 800
+	chartHeight = 400
+	// Plot area margins in pixels
+	chartLeft   = 50
+	chartRight  = 50
+	chartTop    = 30
+	chartBottom = 40
+	// Default and maximum number of hours shown by /graafi
+	defaultChartHours = 3
+	maxChartHours     = int(historyLength / time.Hour)
+	// Readings further apart than this are not connected with a line
+	chartGap = 10 * historyInterval
+)
+
+var (
+	chartBackground  = color.RGBA{255, 255, 255, 255}
+	chartGrid        = color.RGBA{220, 220, 220, 255}
+	chartText        = color.RGBA{60, 60, 60, 255}
+	chartTemperature = color.RGBA{220, 50, 32, 255}
+	chartHumidity    = color.RGBA{30, 110, 220, 255}
+)
+
+// Steps between the time axis labels, the smallest one giving at most 8 labels is used
+var chartTimeSteps = []time.Duration{
+	15 * time.Minute, 30 * time.Minute, time.Hour, 2 * time.Hour, 3 * time.Hour,
+	6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+type chart struct {
+	img      *image.RGBA
+	from, to time.Time
+	// Temperature axis range, humidity is always 0-100 %
+	tempMin, tempMax float64
+}
+
+func (c *chart) x(t time.Time) int {
+	width := float64(chartWidth - chartLeft - chartRight)
+	return chartLeft + int(width*t.Sub(c.from).Seconds()/c.to.Sub(c.from).Seconds())
+}
+
+func (c *chart) y(value, lo, hi float64) int {
+	height := float64(chartHeight - chartTop - chartBottom)
+	return chartHeight - chartBottom - int(height*(value-lo)/(hi-lo))
+}
+
+func (c *chart) text(x, y int, s string, col color.Color) {
+	d := &font.Drawer{Dst: c.img, Src: image.NewUniform(col), Face: basicfont.Face7x13, Dot: fixed.P(x, y)}
+	d.DrawString(s)
+}
+
+func textWidth(s string) int {
+	return font.MeasureString(basicfont.Face7x13, s).Ceil()
+}
+
+// Draw a two pixels wide line with Bresenham's algorithm
+func (c *chart) line(x0, y0, x1, y1 int, col color.Color) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	err := dx + dy
+	for {
+		c.img.Set(x0, y0, col)
+		c.img.Set(x0, y0+1, col)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * err
+		if e2 >= dy {
+			err += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			err += dx
+			y0 += sy
+		}
+	}
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func (c *chart) series(readings []HistoryReading, value func(HistoryReading) float64, lo, hi float64, col color.Color) {
+	for i := 1; i < len(readings); i++ {
+		prev, cur := readings[i-1], readings[i]
+		if cur.Time.Sub(prev.Time) > chartGap {
+			continue
+		}
+		c.line(c.x(prev.Time), c.y(value(prev), lo, hi), c.x(cur.Time), c.y(value(cur), lo, hi), col)
+	}
+}
+
+// Temperature axis rounded to tens of degrees around the readings
+func temperatureRange(readings []HistoryReading) (float64, float64) {
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, r := range readings {
+		lo = math.Min(lo, r.Temperature)
+		hi = math.Max(hi, r.Temperature)
+	}
+	lo = math.Floor(lo/10) * 10
+	hi = math.Ceil(hi/10) * 10
+	if hi <= lo {
+		hi = lo + 10
+	}
+	return lo, hi
+}
+
+// Render a PNG line chart of temperature (left axis) and humidity (right axis) between from and to.
+// The bundled font only covers ASCII, so the labels avoid the degree sign.
+func renderChart(readings []HistoryReading, from, to time.Time) ([]byte, error) {
+	if len(readings) < 2 || !to.After(from) {
+		return nil, fmt.Errorf("not enough readings for a chart")
+	}
+
+	c := &chart{img: image.NewRGBA(image.Rect(0, 0, chartWidth, chartHeight)), from: from, to: to}
+	c.tempMin, c.tempMax = temperatureRange(readings)
+	draw.Draw(c.img, c.img.Bounds(), image.NewUniform(chartBackground), image.Point{}, draw.Src)
+
+	left, right := chartLeft, chartWidth-chartRight
+	top, bottom := chartTop, chartHeight-chartBottom
+
+	// Horizontal grid with temperature labels on the left and humidity on the right
+	tempStep := 10.0
+	if c.tempMax-c.tempMin > 100 {
+		tempStep = 20
+	}
+	for v := c.tempMin; v <= c.tempMax; v += tempStep {
+		y := c.y(v, c.tempMin, c.tempMax)
+		c.line(left, y, right, y, chartGrid)
+		label := strconv.Itoa(int(v))
+		c.text(left-textWidth(label)-6, y+5, label, chartTemperature)
+	}
+	for v := 0.0; v <= 100; v += 25 {
+		c.text(right+6, c.y(v, 0, 100)+5, strconv.Itoa(int(v)), chartHumidity)
+	}
+
+	// Vertical grid with time labels
+	step := chartTimeSteps[len(chartTimeSteps)-1]
+	for _, s := range chartTimeSteps {
+		if to.Sub(from)/s <= 8 {
+			step = s
+			break
+		}
+	}
+	layout := "15:04"
+	if step >= 24*time.Hour {
+		layout = "2.1."
+	}
+	// Truncate in local time so that the labels fall on whole hours and midnights
+	_, offset := from.Zone()
+	offsetDuration := time.Duration(offset) * time.Second
+	for t := from.Add(offsetDuration).Truncate(step).Add(-offsetDuration); !t.After(to); t = t.Add(step) {
+		if t.Before(from) {
+			continue
+		}
+		x := c.x(t)
+		c.line(x, top, x, bottom, chartGrid)
+		label := t.Format(layout)
+		c.text(x-textWidth(label)/2, bottom+18, label, chartText)
+	}
+
+	c.series(readings, func(r HistoryReading) float64 { return math.Max(0, math.Min(r.Humidity, 100)) }, 0, 100, chartHumidity)
+	c.series(readings, func(r HistoryReading) float64 { return r.Temperature }, c.tempMin, c.tempMax, chartTemperature)
+
+	// Axes and legend
+	c.line(left, top, left, bottom, chartText)
+	c.line(right, top, right, bottom, chartText)
+	c.line(left, bottom, right, bottom, chartText)
+	c.text(left, top-12, "Temperature (C)", chartTemperature)
+	legend := "Humidity (%)"
+	c.text(right-textWidth(legend), top-12, legend, chartHumidity)
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, c.img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Send a chart of the readings between from and to as a photo
+func sendChart(b TelegramBot, ctx context.Context, chatID int64, readings []HistoryReading, from, to time.Time, caption string) error {
+	data, err := renderChart(readings, from, to)
+	if err != nil {
+		return err
+	}
+	_, err = b.SendPhoto(ctx, &bot.SendPhotoParams{
+		ChatID:  chatID,
+		Photo:   &models.InputFileUpload{Filename: "sauna.png", Data: bytes.NewReader(data)},
+		Caption: caption,
+	})
+	return err
+}
+
+// Send a chart of the current session to the notification chat with the ready notification.
+// It is rendered and uploaded in the background, the readings must not wait for the upload.
+func sendReadyChart(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, langs *Languages, currentTime time.Time) {
+	if !config.ReadyChart {
+		return
+	}
+	from := kiuas.WarmingStartTime
+	if from.IsZero() || currentTime.Sub(from) < time.Hour {
+		from = currentTime.Add(-time.Hour)
+	}
+	readings := kiuas.History.Since(from)
+	chatID := config.NotificationChatID
+	caption := langs.For(config, chatID).T("chart_ready_caption")
+	goBackground(func() {
+		if err := sendChart(b, ctx, chatID, readings, from, currentTime, caption); err != nil {
+			fmt.Printf("Failed to send chart: %v\n", err)
+		}
+	})
+}
+
+// Handler for /graafi [tunnit]
+func handleChartCommand(ctx context.Context, b TelegramBot, kiuas *Kiuas, config *Config, langs *Languages, update *models.Update, now time.Time) {
+	locale := langs.For(config, update.Message.Chat.ID)
+	hours := defaultChartHours
+	args := strings.Fields(update.Message.Text)[1:]
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 1 || n > maxChartHours {
+			replyText(ctx, b, update, locale.T("chart_usage", maxChartHours))
+			return
+		}
+		hours = n
+	}
+
+	from := now.Add(-time.Duration(hours) * time.Hour)
+	readings := kiuas.History.Since(from)
+	if len(readings) < 2 {
+		replyText(ctx, b, update, locale.T("chart_no_readings"))
+		return
+	}
+	caption := locale.T("chart_caption", hours)
+	if err := sendChart(b, ctx, update.Message.Chat.ID, readings, from, now, caption); err != nil {
+		fmt.Printf("Failed to send chart: %v\n", err)
+	}
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"image/png"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func testReadings(start time.Time, minutes int) []HistoryReading {
+	readings := make([]HistoryReading, minutes)
+	for i := range readings {
+		readings[i] = HistoryReading{
+			Time:        start.Add(time.Duration(i) * time.Minute),
+			Temperature: 20 + float64(i)/2,
+			Humidity:    40 - float64(i)/10,
+		}
+	}
+	return readings
+}
+
+func TestRenderChart(t *testing.T) {
+	start := time.Date(2024, 12, 24, 16, 0, 0, 0, time.UTC)
+	data, err := renderChart(testReadings(start, 120), start, start.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Expected a valid PNG: %v", err)
+	}
+	if b := img.Bounds(); b.Dx() != chartWidth || b.Dy() != chartHeight {
+		t.Errorf("Unexpected image size %v", b)
+	}
+
+	// Halfway through the temperature is 50 °C, in the middle of the 20-80 °C axis
+	c := &chart{from: start, to: start.Add(2 * time.Hour)}
+	x, y := c.x(start.Add(time.Hour)), c.y(50, 20, 80)
+	r, g, b, _ := img.At(x, y).RGBA()
+	if r>>8 != 220 || g>>8 != 50 || b>>8 != 32 {
+		t.Errorf("Expected temperature line at %d,%d, got %d %d %d", x, y, r>>8, g>>8, b>>8)
+	}
+
+	if _, err := renderChart(nil, start, start.Add(time.Hour)); err == nil {
+		t.Errorf("Expected an error without readings")
+	}
+}
+
+func TestTemperatureRange(t *testing.T) {
+	lo, hi := temperatureRange([]HistoryReading{{Temperature: 21.5}, {Temperature: 78}})
+	if lo != 20 || hi != 80 {
+		t.Errorf("Expected range 20-80, got %v-%v", lo, hi)
+	}
+	lo, hi = temperatureRange([]HistoryReading{{Temperature: 30}, {Temperature: 30}})
+	if lo != 30 || hi != 40 {
+		t.Errorf("Expected a range of at least ten degrees, got %v-%v", lo, hi)
+	}
+}
+
+func TestHandleChartCommand(t *testing.T) {
+	now := time.Date(2024, 12, 24, 18, 0, 0, 0, time.UTC)
+	kiuas := &Kiuas{History: &History{Readings: testReadings(now.Add(-4*time.Hour), 240)}}
+	mockBot := &MockTelegramBot{}
+	ctx := context.Background()
+
+	handleChartCommand(ctx, mockBot, kiuas, &Config{}, nil, newCommandUpdate(-200, "/graafi 2"), now)
+	if len(mockBot.SentPhotos) != 1 || mockBot.SentPhotos[0].ChatID != int64(-200) {
+		t.Fatalf("Expected a chart to be sent to the chat, got %v", mockBot.SentPhotos)
+	}
+	if mockBot.SentPhotos[0].Caption != "Lämpötila ja kosteus, viimeiset 2 h" {
+		t.Errorf("Unexpected caption %q", mockBot.SentPhotos[0].Caption)
+	}
+
+	handleChartCommand(ctx, mockBot, kiuas, &Config{}, nil, newCommandUpdate(-200, "/graafi 1000"), now)
+	handleChartCommand(ctx, mockBot, &Kiuas{}, &Config{}, nil, newCommandUpdate(-200, "/graafi"), now)
+	if len(mockBot.SentPhotos) != 1 || len(mockBot.SentMessages) != 2 {
+		t.Errorf("Expected usage and no data replies, got %v", mockBot.SentMessages)
+	}
+}
+
+func TestCheckAndNotify_ReadyChart(t *testing.T) {
+	now := time.Date(2024, 12, 24, 18, 0, 0, 0, time.UTC)
+	kiuas := &Kiuas{
+		Temperature:      75,
+		WarmingStartTime: now.Add(-90 * time.Minute),
+		History:          &History{Readings: testReadings(now.Add(-2*time.Hour), 120)},
+	}
+	config := &Config{NotificationChatID: -200, ReadyThreshold: 70, ResetThreshold: 40, ReadyChart: true}
+	mockBot := &MockTelegramBot{}
+
+	checkAndNotify(mockBot, context.Background(), kiuas, config, nil, nil, now)
+	background.Wait()
+	if len(mockBot.SentMessages) != 1 || len(mockBot.SentPhotos) != 1 {
+		t.Errorf("Expected the ready message and a chart, got %d messages and %d photos", len(mockBot.SentMessages), len(mockBot.SentPhotos))
+	}
+}
+
+// A bot whose photo uploads wait until released
+type slowPhotoBot struct {
+	MockTelegramBot
+	release chan struct{}
+}
+
+func (s *slowPhotoBot) SendPhoto(ctx context.Context, params *bot.SendPhotoParams) (*models.Message, error) {
+	<-s.release
+	return &models.Message{}, nil
+}
+
+func TestCheckAndNotify_ReadyChartInBackground(t *testing.T) {
+	now := time.Date(2024, 12, 24, 18, 0, 0, 0, time.UTC)
+	kiuas := &Kiuas{Temperature: 75, History: &History{Readings: testReadings(now.Add(-time.Hour), 60)}}
+	config := &Config{NotificationChatID: -200, ReadyThreshold: 70, ResetThreshold: 40, ReadyChart: true}
+	slowBot := &slowPhotoBot{release: make(chan struct{})}
+
+	done := make(chan struct{})
+	go func() {
+		checkAndNotify(slowBot, context.Background(), kiuas, config, nil, nil, now)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Expected the readings not to wait for the chart upload")
+	}
+	close(slowBot.release)
+	background.Wait()
+}
@@ -0,0 +1,424 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"os/signal"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"bt-telegram/format"
+)
+
+// How often the config file is checked for changes
+const configPollInterval = 10 * time.Second
+
+// Config is loaded from a YAML file. The fields with an env tag can be overridden with that environment
+// variable, the notifiers and the SMTP settings are only read from the file.
+type Config struct {
+	ReadyThreshold     float64 `yaml:"ready_threshold" env:"SAUNA_READY_THRESHOLD"`
+	WarmingThreshold   float64 `yaml:"warming_threshold" env:"SAUNA_WARMING_THRESHOLD"`
+	ChangeThreshold    float64 `yaml:"change_threshold" env:"SAUNA_CHANGE_THRESHOLD"`
+	LowerBound         float64 `yaml:"lower_bound" env:"SAUNA_LOWER_BOUND"`
+	ResetThreshold     float64 `yaml:"reset_threshold" env:"SAUNA_RESET_THRESHOLD"`
+	MaintenanceChatID  int64   `yaml:"maintenance_chat_id" env:"MAINTENANCE_CHAT_ID"`
+	NotificationChatID int64   `yaml:"notification_chat_id" env:"NOTIFICATION_CHAT_ID"`
+	ServerPort         string  `yaml:"server_port" env:"SERVER_PORT"`
+	TelegramBotToken   string  `yaml:"telegram_bot_token" env:"TELEGRAM_BOT_TOKEN"`
+	DataDir            string  `yaml:"data_dir" env:"DATA_DIR"`     // roles and other state saved by the bot
+	Language           string  `yaml:"language" env:"LANGUAGE"`     // default language of the messages, fi, sv or en
+	ParseMode          string  `yaml:"parse_mode" env:"PARSE_MODE"` // MarkdownV2 or HTML
+	// Extra notification channels and the mail server of the email channels, see notifier.go
+	Notifiers   []NotifierConfig `yaml:"notifiers"`
+	SMTP        SMTPConfig       `yaml:"smtp"`
+	RuuviTagMAC string           `yaml:"ruuvi_tag_mac" env:"RUUVI_TAG_MAC"` // tag of the sauna, required for gateway batches of several tags
+	// MQTT publishing, empty MQTTBroker disables it. Changes require a restart.
+	MQTTBroker          string `yaml:"mqtt_broker" env:"MQTT_BROKER"` // e.g. tcp://localhost:1883
+	MQTTUsername        string `yaml:"mqtt_username" env:"MQTT_USERNAME"`
+	MQTTPassword        string `yaml:"mqtt_password" env:"MQTT_PASSWORD"`
+	MQTTClientID        string `yaml:"mqtt_client_id" env:"MQTT_CLIENT_ID"`
+	MQTTTopicPrefix     string `yaml:"mqtt_topic_prefix" env:"MQTT_TOPIC_PREFIX"`
+	MQTTDiscoveryPrefix string `yaml:"mqtt_discovery_prefix" env:"MQTT_DISCOVERY_PREFIX"` // Home Assistant, empty disables discovery
+	MQTTIngestTopic     string `yaml:"mqtt_ingest_topic" env:"MQTT_INGEST_TOPIC"`         // readings of the tag, empty disables ingestion
+	// Event detection, zero values disable the detector
+	LoylyHumidityRise float64       `yaml:"loyly_humidity_rise" env:"LOYLY_HUMIDITY_RISE"` // percentage points
+	LoylyPressureRise float64       `yaml:"loyly_pressure_rise" env:"LOYLY_PRESSURE_RISE"` // Pa
+	LoylyWindow       time.Duration `yaml:"loyly_window" env:"LOYLY_WINDOW"`
+	DoorOpenTempDrop  float64       `yaml:"door_open_temp_drop" env:"DOOR_OPEN_TEMP_DROP"` // °C
+	DoorOpenWindow    time.Duration `yaml:"door_open_window" env:"DOOR_OPEN_WINDOW"`
+	NotifyLoyly       bool          `yaml:"notify_loyly" env:"NOTIFY_LOYLY"`
+	NotifyDoorOpen    bool          `yaml:"notify_door_open" env:"NOTIFY_DOOR_OPEN"`
+	// How often the warming message is edited with the current progress, zero sends a new ready message instead
+	WarmingUpdateInterval time.Duration `yaml:"warming_update_interval" env:"WARMING_UPDATE_INTERVAL"`
+	ReadyChart            bool          `yaml:"ready_chart" env:"READY_CHART"` // send a temperature chart with the ready notification
+	// Sauna left on alerts, zero MaxSessionDuration disables them
+	MaxSessionDuration   time.Duration `yaml:"max_session_duration" env:"MAX_SESSION_DURATION"`
+	SessionAlertInterval time.Duration `yaml:"session_alert_interval" env:"SESSION_ALERT_INTERVAL"`
+	// Safety alerts, zero values disable the individual checks
+	OverheatThreshold     float64       `yaml:"overheat_threshold" env:"OVERHEAT_THRESHOLD"` // °C
+	MaxTempRiseRate       float64       `yaml:"max_temp_rise_rate" env:"MAX_TEMP_RISE_RATE"` // °C per minute between two samples
+	FrozenReadingDuration time.Duration `yaml:"frozen_reading_duration" env:"FROZEN_READING_DURATION"`
+	HumiditySaturation    float64       `yaml:"humidity_saturation" env:"HUMIDITY_SATURATION"` // %
+	SafetyRecoveryTime    time.Duration `yaml:"safety_recovery_time" env:"SAFETY_RECOVERY_TIME"`
+	// Battery monitoring, zero BatteryLowThreshold disables the alert
+	BatteryLowThreshold     float64       `yaml:"battery_low_threshold" env:"BATTERY_LOW_THRESHOLD"`       // mV
+	BatteryHysteresis       float64       `yaml:"battery_hysteresis" env:"BATTERY_HYSTERESIS"`             // mV
+	BatteryTempCoefficient  float64       `yaml:"battery_temp_coefficient" env:"BATTERY_TEMP_COEFFICIENT"` // mV per °C, positive as the voltage sags in the heat
+	BatteryReminderInterval time.Duration `yaml:"battery_reminder_interval" env:"BATTERY_REMINDER_INTERVAL"`
+	// No data alerts
+	NoDataThreshold           time.Duration `yaml:"no_data_threshold" env:"NO_DATA_THRESHOLD"`
+	NoDataCheckInterval       time.Duration `yaml:"no_data_check_interval" env:"NO_DATA_CHECK_INTERVAL"`
+	NoDataEscalationThreshold time.Duration `yaml:"no_data_escalation_threshold" env:"NO_DATA_ESCALATION_THRESHOLD"` // zero disables the escalation
+	NoDataEscalationChatID    int64         `yaml:"no_data_escalation_chat_id" env:"NO_DATA_ESCALATION_CHAT_ID"`     // zero sends the escalation only to the notifiers
+	QuietHoursStart           int           `yaml:"quiet_hours_start" env:"QUIET_HOURS_START"`                       // hour of day, equal start and end disables quiet hours
+	QuietHoursEnd             int           `yaml:"quiet_hours_end" env:"QUIET_HOURS_END"`
+	// Reservations
+	ReservationReminder    time.Duration `yaml:"reservation_reminder" env:"RESERVATION_REMINDER"` // zero disables the reminders
+	ReservationMaxDuration time.Duration `yaml:"reservation_max_duration" env:"RESERVATION_MAX_DURATION"`
+	// Calendar feed
+	PublicURL            string `yaml:"public_url" env:"PUBLIC_URL"` // used in the links sent by the bot, empty disables /kalenteri
+	CalendarRequireToken bool   `yaml:"calendar_require_token" env:"CALENDAR_REQUIRE_TOKEN"`
+
+	// File the config was loaded from, runtime changes are saved there
+	path string
+}
+
+// DefaultConfig returns the values used when neither the config file nor the environment set a field
+func DefaultConfig() *Config {
+	return &Config{
+		ReadyThreshold:            70.0,
+		WarmingThreshold:          0,
+		ChangeThreshold:           0.0123,
+		LowerBound:                0.0123 * 0.9,
+		ResetThreshold:            40.0,
+		ServerPort:                "1337",
+		DataDir:                   "data",
+		Language:                  "fi",
+		ParseMode:                 "MarkdownV2",
+		MQTTClientID:              "saunatonttu",
+		MQTTTopicPrefix:           "saunatonttu",
+		MQTTDiscoveryPrefix:       "homeassistant",
+		LoylyHumidityRise:         8.0,
+		LoylyWindow:               1 * time.Minute,
+		DoorOpenTempDrop:          10.0,
+		DoorOpenWindow:            10 * time.Minute,
+		NotifyLoyly:               false,
+		NotifyDoorOpen:            true,
+		WarmingUpdateInterval:     time.Minute,
+		MaxSessionDuration:        4 * time.Hour,
+		SessionAlertInterval:      30 * time.Minute,
+		OverheatThreshold:         110.0,
+		MaxTempRiseRate:           10.0,
+		FrozenReadingDuration:     30 * time.Minute,
+		HumiditySaturation:        100.0,
+		SafetyRecoveryTime:        5 * time.Minute,
+		BatteryLowThreshold:       2500,
+		BatteryHysteresis:         100,
+		BatteryTempCoefficient:    1.0,
+		BatteryReminderInterval:   7 * 24 * time.Hour,
+		NoDataThreshold:           time.Hour,
+		NoDataCheckInterval:       time.Minute,
+		NoDataEscalationThreshold: 12 * time.Hour,
+		QuietHoursStart:           23,
+		QuietHoursEnd:             8,
+		ReservationReminder:       30 * time.Minute,
+		ReservationMaxDuration:    4 * time.Hour,
+	}
+}
+
+// ValidationError lists every invalid field of a config
+type ValidationError []string
+
+func (v ValidationError) Error() string {
+	return "invalid config: " + strings.Join(v, "; ")
+}
+
+// LoadConfig reads the defaults, the YAML file at path (if it exists) and the environment overrides, in that order
+func LoadConfig(path string) (*Config, error) {
+	config := DefaultConfig()
+	config.path = path
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		if err := yaml.Unmarshal(data, config); err != nil {
+			return nil, fmt.Errorf("parsing %s: %w", path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var invalid ValidationError
+	invalid = append(invalid, config.applyEnv()...)
+
+	if err := config.Validate(); err != nil {
+		invalid = append(invalid, err.(ValidationError)...)
+	}
+	if len(invalid) > 0 {
+		return nil, invalid
+	}
+	return config, nil
+}
+
+// Override the fields that have their environment variable set
+func (c *Config) applyEnv() []string {
+	var invalid []string
+
+	v := reflect.ValueOf(c).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		name := t.Field(i).Tag.Get("env")
+		value, ok := os.LookupEnv(name)
+		if name == "" || !ok || value == "" {
+			continue
+		}
+		if err := setField(v.Field(i), value); err != nil {
+			invalid = append(invalid, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	return invalid
+}
+
+// Parse a string value into a config field
+func setField(field reflect.Value, value string) error {
+	if field.Type() == reflect.TypeOf(time.Duration(0)) {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(d))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	case reflect.Int, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported type %s", field.Type())
+	}
+	return nil
+}
+
+// Validate checks every field and returns a ValidationError listing all the problems
+func (c *Config) Validate() error {
+	var invalid ValidationError
+	check := func(ok bool, format string, args ...any) {
+		if !ok {
+			invalid = append(invalid, fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.TelegramBotToken != "", "telegram_bot_token is required")
+	check(c.MaintenanceChatID != 0, "maintenance_chat_id is required")
+	check(c.NotificationChatID != 0, "notification_chat_id is required")
+	check(c.ReadyThreshold > 0 && c.ReadyThreshold <= 120, "ready_threshold must be between 0 and 120 °C, got %v", c.ReadyThreshold)
+	check(c.ResetThreshold >= 0 && c.ResetThreshold < c.ReadyThreshold, "reset_threshold must be below ready_threshold, got %v", c.ResetThreshold)
+	check(c.WarmingThreshold >= 0 && c.WarmingThreshold < c.ReadyThreshold, "warming_threshold must be below ready_threshold, got %v", c.WarmingThreshold)
+	check(c.ChangeThreshold >= 0, "change_threshold must not be negative")
+	check(c.LowerBound > 0, "lower_bound must be positive")
+	check(c.DataDir != "", "data_dir is required")
+
+	port, err := strconv.Atoi(c.ServerPort)
+	check(err == nil && port > 0 && port < 65536, "server_port must be a port number, got %q", c.ServerPort)
+	_, err = ParseLocale(c.Language)
+	check(err == nil, "language must be fi, sv or en, got %q", c.Language)
+	_, err = format.ParseMode(c.ParseMode)
+	check(err == nil, "parse_mode must be MarkdownV2 or HTML, got %q", c.ParseMode)
+	for i, n := range c.Notifiers {
+		err := n.validate(c)
+		check(err == nil, "notifiers[%d]: %v", i, err)
+	}
+	if c.MQTTBroker != "" {
+		check(c.MQTTClientID != "", "mqtt_client_id is required")
+		check(c.MQTTTopicPrefix != "" && !strings.ContainsAny(c.MQTTTopicPrefix, "+#"), "mqtt_topic_prefix must be a topic without wildcards, got %q", c.MQTTTopicPrefix)
+	}
+	check(c.MQTTIngestTopic == "" || c.MQTTBroker != "", "mqtt_ingest_topic requires mqtt_broker")
+	if c.PublicURL != "" {
+		u, err := url.Parse(c.PublicURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "public_url must be an absolute http or https URL, got %q", c.PublicURL)
+	}
+
+	check(c.OverheatThreshold == 0 || c.OverheatThreshold > c.ReadyThreshold, "overheat_threshold must be above ready_threshold, got %v", c.OverheatThreshold)
+	check(c.HumiditySaturation >= 0 && c.HumiditySaturation <= 200, "humidity_saturation must be between 0 and 200 %%, got %v", c.HumiditySaturation)
+	check(c.BatteryLowThreshold >= 0 && c.BatteryLowThreshold < 3700, "battery_low_threshold must be between 0 and 3700 mV, got %v", c.BatteryLowThreshold)
+	check(c.BatteryHysteresis >= 0, "battery_hysteresis must not be negative")
+	check(c.BatteryTempCoefficient >= 0, "battery_temp_coefficient must not be negative, the voltage sags in the heat")
+	check(c.NoDataThreshold > 0, "no_data_threshold must be positive")
+	check(c.NoDataCheckInterval > 0, "no_data_check_interval must be positive")
+	check(c.QuietHoursStart >= 0 && c.QuietHoursStart < 24, "quiet_hours_start must be an hour between 0 and 23, got %d", c.QuietHoursStart)
+	check(c.QuietHoursEnd >= 0 && c.QuietHoursEnd < 24, "quiet_hours_end must be an hour between 0 and 23, got %d", c.QuietHoursEnd)
+
+	durations := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"loyly_window", c.LoylyWindow},
+		{"door_open_window", c.DoorOpenWindow},
+		{"warming_update_interval", c.WarmingUpdateInterval},
+		{"max_session_duration", c.MaxSessionDuration},
+		{"session_alert_interval", c.SessionAlertInterval},
+		{"frozen_reading_duration", c.FrozenReadingDuration},
+		{"safety_recovery_time", c.SafetyRecoveryTime},
+		{"battery_reminder_interval", c.BatteryReminderInterval},
+		{"no_data_escalation_threshold", c.NoDataEscalationThreshold},
+		{"reservation_reminder", c.ReservationReminder},
+		{"reservation_max_duration", c.ReservationMaxDuration},
+	}
+	for _, d := range durations {
+		check(d.value >= 0, "%s must not be negative", d.name)
+	}
+
+	if len(invalid) > 0 {
+		return invalid
+	}
+	return nil
+}
+
+// ConfigStore holds the running config. Reloads and /aseta replace the whole Config instead of
+// modifying it, so the snapshot returned by Load can be read without locking while a change is made.
+type ConfigStore struct {
+	current atomic.Pointer[Config]
+	mu      sync.Mutex // serialises the changes
+	written time.Time  // modification time of the config file after the last write of saveValue
+}
+
+func NewConfigStore(config *Config) *ConfigStore {
+	s := &ConfigStore{}
+	s.current.Store(config)
+	return s
+}
+
+// Load returns the current config, which must not be modified
+func (s *ConfigStore) Load() *Config {
+	return s.current.Load()
+}
+
+// Replace the config with a modified copy, nothing is changed if update returns an error
+func (s *ConfigStore) update(update func(config *Config) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	config := *s.current.Load()
+	if err := update(&config); err != nil {
+		return err
+	}
+	s.current.Store(&config)
+	return nil
+}
+
+// Write a value to the config file and remember the write, the watcher does not reload
+// the bot's own changes
+func (s *ConfigStore) saveValue(key, value string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := s.current.Load().path
+	if err := saveConfigValue(path, key, value); err != nil {
+		return err
+	}
+	if info, err := os.Stat(path); err == nil {
+		s.written = info.ModTime()
+	}
+	return nil
+}
+
+// Report whether the file modification time is from the last write of saveValue
+func (s *ConfigStore) ownWrite(modTime time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.written.IsZero() && s.written.Equal(modTime)
+}
+
+// Reload the config file into the store. Invalid files are rejected and the old values kept.
+// The bot token and server port cannot be changed without a restart.
+func reloadConfig(path string, configs *ConfigStore) error {
+	newConfig, err := LoadConfig(path)
+	if err != nil {
+		return err
+	}
+
+	configs.mu.Lock()
+	defer configs.mu.Unlock()
+
+	config := configs.current.Load()
+	if newConfig.TelegramBotToken != config.TelegramBotToken || newConfig.ServerPort != config.ServerPort {
+		log.Println("Changing the bot token or the server port requires a restart")
+		newConfig.TelegramBotToken = config.TelegramBotToken
+		newConfig.ServerPort = config.ServerPort
+	}
+
+	configs.current.Store(newConfig)
+	return nil
+}
+
+// Reload the config on SIGHUP or when the file modification time changes
+func watchConfig(ctx context.Context, path string, configs *ConfigStore) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	ticker := time.NewTicker(configPollInterval)
+	defer ticker.Stop()
+
+	modTime := func() time.Time {
+		info, err := os.Stat(path)
+		if err != nil {
+			return time.Time{}
+		}
+		return info.ModTime()
+	}
+	lastModified := modTime()
+
+	reload := func(reason string) {
+		if err := reloadConfig(path, configs); err != nil {
+			log.Printf("Config reload (%s) failed, keeping the old config: %v\n", reason, err)
+			return
+		}
+		log.Printf("Config reloaded (%s)\n", reason)
+	}
+
+	for {
+		select {
+		case <-hup:
+			lastModified = modTime()
+			reload("SIGHUP")
+		case <-ticker.C:
+			if m := modTime(); !m.Equal(lastModified) {
+				lastModified = m
+				if !configs.ownWrite(m) {
+					reload("file changed")
+				}
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
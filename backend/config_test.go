@@ -0,0 +1,172 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func writeConfigFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestLoadConfig_FileAndEnvOverrides(t *testing.T) {
+	path := writeConfigFile(t, `
+telegram_bot_token: token
+notification_chat_id: 2
+maintenance_chat_id: 1
+ready_threshold: 75
+loyly_window: 2m
+`)
+	t.Setenv("SAUNA_READY_THRESHOLD", "80")
+	t.Setenv("NOTIFY_LOYLY", "true")
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if config.ReadyThreshold != 80 {
+		t.Errorf("Expected env to override ready_threshold, got %v", config.ReadyThreshold)
+	}
+	if config.LoylyWindow != 2*time.Minute {
+		t.Errorf("Expected loyly_window 2m, got %v", config.LoylyWindow)
+	}
+	if !config.NotifyLoyly {
+		t.Errorf("Expected NotifyLoyly to be true")
+	}
+	if config.ResetThreshold != 40 {
+		t.Errorf("Expected default reset_threshold, got %v", config.ResetThreshold)
+	}
+	if config.NoDataEscalationChatID != 0 {
+		t.Errorf("Expected no escalation chat by default, got %d", config.NoDataEscalationChatID)
+	}
+}
+
+func TestLoadConfig_ListsEveryInvalidField(t *testing.T) {
+	path := writeConfigFile(t, `
+ready_threshold: 30
+reset_threshold: 40
+quiet_hours_start: 25
+battery_temp_coefficient: -1
+`)
+	t.Setenv("MAINTENANCE_CHAT_ID", "not-a-number")
+
+	_, err := LoadConfig(path)
+
+	var invalid ValidationError
+	if !errors.As(err, &invalid) {
+		t.Fatalf("Expected ValidationError, got %v", err)
+	}
+	for _, field := range []string{"MAINTENANCE_CHAT_ID", "telegram_bot_token", "notification_chat_id", "reset_threshold", "quiet_hours_start", "battery_temp_coefficient"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Errorf("Expected %s in the error, got: %v", field, err)
+		}
+	}
+}
+
+func TestReloadConfig_KeepsOldConfigOnError(t *testing.T) {
+	path := writeConfigFile(t, `
+telegram_bot_token: token
+notification_chat_id: 2
+maintenance_chat_id: 1
+ready_threshold: 75
+`)
+
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	configs := NewConfigStore(config)
+
+	if err := os.WriteFile(path, []byte("ready_threshold: -1\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloadConfig(path, configs); err == nil {
+		t.Errorf("Expected reload to fail")
+	}
+	if config = configs.Load(); config.ReadyThreshold != 75 {
+		t.Errorf("Expected old config to be kept, got ready_threshold %v", config.ReadyThreshold)
+	}
+
+	if err := os.WriteFile(path, []byte("telegram_bot_token: other\nnotification_chat_id: 2\nmaintenance_chat_id: 1\nready_threshold: 65\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := reloadConfig(path, configs); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if config = configs.Load(); config.ReadyThreshold != 65 {
+		t.Errorf("Expected ready_threshold 65 after reload, got %v", config.ReadyThreshold)
+	}
+	if config.TelegramBotToken != "token" {
+		t.Errorf("Expected bot token to require a restart, got %s", config.TelegramBotToken)
+	}
+}
+
+// Run with -race: readers use their snapshot while reloads and /aseta replace the config
+func TestConfigStore_ConcurrentChanges(t *testing.T) {
+	path := writeConfigFile(t, "telegram_bot_token: token\nnotification_chat_id: 2\nmaintenance_chat_id: 1\n")
+	config, err := LoadConfig(path)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	configs := NewConfigStore(config)
+
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if err := reloadConfig(path, configs); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			if _, err := setAdminSetting(configs, "valmis", "75"); err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			c := configs.Load()
+			if c.ResetThreshold >= c.ReadyThreshold || len(c.Notifiers) != 0 {
+				t.Errorf("Unexpected config %+v", c)
+			}
+		}
+	}()
+	wg.Wait()
+}
+
+func TestValidate_PublicURL(t *testing.T) {
+	config := DefaultConfig()
+	config.TelegramBotToken = "token"
+	config.MaintenanceChatID = 1
+	config.NotificationChatID = 2
+
+	for _, publicURL := range []string{"", "https://sauna.example.org", "http://192.168.1.10:1337/"} {
+		config.PublicURL = publicURL
+		if err := config.Validate(); err != nil {
+			t.Errorf("Expected %q to be valid, got %v", publicURL, err)
+		}
+	}
+	for _, publicURL := range []string{"sauna.example.org", "/api", "ftp://sauna.example.org", "https://"} {
+		config.PublicURL = publicURL
+		if err := config.Validate(); err == nil || !strings.Contains(err.Error(), "public_url") {
+			t.Errorf("Expected %q to be rejected, got %v", publicURL, err)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// How long raw samples are kept for event detection
+const sampleWindow = 30 * time.Minute
+
+// Sample is a single reading from the RuuviTag
+type Sample struct {
+	Time        time.Time
+	Temperature float64
+	Humidity    float64
+	Pressure    uint32
+}
+
+// Add a new sample and drop the ones that are older than sampleWindow
+func (k *Kiuas) AddSample(temperature, humidity float64, pressure uint32, t time.Time) {
+	// Remember when the reading last changed for detecting a frozen sensor
+	if len(k.Samples) == 0 || k.Samples[len(k.Samples)-1].Temperature != temperature || k.Samples[len(k.Samples)-1].Humidity != humidity {
+		k.LastReadingChange = t
+	}
+
+	k.Samples = append(k.Samples, Sample{
+		Time:        t,
+		Temperature: temperature,
+		Humidity:    humidity,
+		Pressure:    pressure,
+	})
+
+	cutoff := t.Add(-sampleWindow)
+	i := 0
+	for i < len(k.Samples) && k.Samples[i].Time.Before(cutoff) {
+		i++
+	}
+	k.Samples = k.Samples[i:]
+}
+
+// Return the samples measured within the given duration before t
+func (k *Kiuas) samplesSince(t time.Time, d time.Duration) []Sample {
+	cutoff := t.Add(-d)
+	for i, s := range k.Samples {
+		if !s.Time.Before(cutoff) {
+			return k.Samples[i:]
+		}
+	}
+	return nil
+}
+
+// Check if löyly was just thrown, i.e. humidity (or pressure) rose sharply within LoylyWindow
+func (k *Kiuas) IsLoylyThrown(config *Config, currentTime time.Time) bool {
+	if config.LoylyWindow <= 0 || (config.LoylyHumidityRise <= 0 && config.LoylyPressureRise <= 0) {
+		return false
+	}
+
+	samples := k.samplesSince(currentTime, config.LoylyWindow)
+	if len(samples) < 2 {
+		return false
+	}
+
+	latest := samples[len(samples)-1]
+	minHumidity := latest.Humidity
+	minPressure := latest.Pressure
+	for _, s := range samples {
+		minHumidity = min(minHumidity, s.Humidity)
+		minPressure = min(minPressure, s.Pressure)
+	}
+
+	if config.LoylyHumidityRise > 0 && latest.Humidity-minHumidity >= config.LoylyHumidityRise {
+		return true
+	}
+	return config.LoylyPressureRise > 0 && float64(latest.Pressure-minPressure) >= config.LoylyPressureRise
+}
+
+// Check if the temperature has been falling steadily for DoorOpenWindow, which while
+// the sauna is heating means that the door or a window has been left open
+func (k *Kiuas) IsDoorOpen(config *Config, currentTime time.Time) bool {
+	if config.DoorOpenWindow <= 0 || config.DoorOpenTempDrop <= 0 {
+		return false
+	}
+
+	samples := k.samplesSince(currentTime, config.DoorOpenWindow)
+	if len(samples) < 2 {
+		return false
+	}
+
+	// Require the samples to cover most of the window so that a single dip does not count
+	if samples[len(samples)-1].Time.Sub(samples[0].Time) < config.DoorOpenWindow*3/4 {
+		return false
+	}
+
+	// The drop has to be sustained: every sample must be at or below the previous peak
+	peak := samples[0].Temperature
+	for _, s := range samples[1:] {
+		if s.Temperature > peak+doorOpenTolerance {
+			return false
+		}
+		peak = min(peak, s.Temperature)
+	}
+
+	return samples[0].Temperature-samples[len(samples)-1].Temperature >= config.DoorOpenTempDrop
+}
+
+// Allow for sensor noise when checking that the temperature keeps dropping
+const doorOpenTolerance = 0.5
+
+// Function to detect löyly and door events from the sample stream and send the optional notifications
+func checkEvents(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, langs *Languages, currentTime time.Time) {
+	sessionActive := kiuas.WarmingNotificationSent || kiuas.ReadyNotificationSent
+
+	if kiuas.IsLoylyThrown(config, currentTime) && currentTime.Sub(kiuas.LastLoylyTime) > config.LoylyWindow {
+		kiuas.LastLoylyTime = currentTime
+		kiuas.LoylyCount++
+		log.Printf("Löyly thrown (%d this session), humidity %.1f%%\n", kiuas.LoylyCount, kiuas.Humidity)
+		if config.NotifyLoyly && sessionActive {
+			sendLocalized(b, ctx, config, langs, config.NotificationChatID, "loyly", kiuas.Humidity)
+		}
+	}
+
+	// After the sauna is ready the temperature falls anyway while bathing or when the heater is switched off
+	heating := kiuas.WarmingNotificationSent && !kiuas.ReadyNotificationSent
+	if heating && !kiuas.DoorOpenNotificationSent && kiuas.IsDoorOpen(config, currentTime) {
+		kiuas.DoorOpenNotificationSent = true
+		log.Printf("Sustained temperature drop detected, door or ventilation open? Temperature %.1f °C\n", kiuas.Temperature)
+		if config.NotifyDoorOpen {
+			sendLocalized(b, ctx, config, langs, config.NotificationChatID, "door_open", config.DoorOpenWindow.Minutes(), kiuas.Temperature)
+		}
+	}
+}
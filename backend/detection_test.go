@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestIsLoylyThrown_HumiditySpike(t *testing.T) {
+	currentTime := time.Now()
+	kiuas := &Kiuas{}
+	kiuas.AddSample(75.0, 10.0, 100000, currentTime.Add(-40*time.Second))
+	kiuas.AddSample(75.0, 10.5, 100000, currentTime.Add(-30*time.Second))
+	kiuas.AddSample(74.0, 22.0, 100000, currentTime)
+
+	config := &Config{
+		LoylyHumidityRise: 8.0,
+		LoylyWindow:       time.Minute,
+	}
+
+	if !kiuas.IsLoylyThrown(config, currentTime) {
+		t.Errorf("Expected löyly to be detected")
+	}
+
+	config.LoylyHumidityRise = 0
+	if kiuas.IsLoylyThrown(config, currentTime) {
+		t.Errorf("Expected detector to be disabled")
+	}
+}
+
+func TestIsLoylyThrown_SlowHumidityRise(t *testing.T) {
+	currentTime := time.Now()
+	kiuas := &Kiuas{}
+	for i := 10; i >= 0; i-- {
+		kiuas.AddSample(75.0, 20.0-float64(i), 100000, currentTime.Add(-time.Duration(i)*time.Minute))
+	}
+
+	config := &Config{
+		LoylyHumidityRise: 8.0,
+		LoylyWindow:       time.Minute,
+	}
+
+	if kiuas.IsLoylyThrown(config, currentTime) {
+		t.Errorf("Slow humidity rise should not be detected as löyly")
+	}
+}
+
+func TestIsDoorOpen(t *testing.T) {
+	currentTime := time.Now()
+	kiuas := &Kiuas{}
+	for i := 10; i >= 0; i-- {
+		kiuas.AddSample(60.0+float64(i)*1.5, 10.0, 100000, currentTime.Add(-time.Duration(i)*time.Minute))
+	}
+
+	config := &Config{
+		DoorOpenTempDrop: 10.0,
+		DoorOpenWindow:   10 * time.Minute,
+	}
+
+	if !kiuas.IsDoorOpen(config, currentTime) {
+		t.Errorf("Expected open door to be detected")
+	}
+
+	// A temporary dip that recovers is not an open door
+	kiuas.AddSample(70.0, 10.0, 100000, currentTime.Add(time.Minute))
+	if kiuas.IsDoorOpen(config, currentTime.Add(time.Minute)) {
+		t.Errorf("Recovered temperature should not be detected as an open door")
+	}
+}
+
+func TestAddSample_DropsOldSamples(t *testing.T) {
+	currentTime := time.Now()
+	kiuas := &Kiuas{}
+	kiuas.AddSample(20.0, 10.0, 100000, currentTime.Add(-2*sampleWindow))
+	kiuas.AddSample(21.0, 10.0, 100000, currentTime)
+
+	if len(kiuas.Samples) != 1 {
+		t.Fatalf("Expected 1 sample, got %d", len(kiuas.Samples))
+	}
+}
+
+func TestCheckEvents_DoorOpenNotificationSentOnlyOnce(t *testing.T) {
+	currentTime := time.Now()
+	kiuas := &Kiuas{WarmingNotificationSent: true}
+	for i := 10; i >= 0; i-- {
+		kiuas.AddSample(60.0+float64(i)*1.5, 10.0, 100000, currentTime.Add(-time.Duration(i)*time.Minute))
+	}
+
+	mockBot := &MockTelegramBot{}
+
+	config := &Config{
+		DoorOpenTempDrop: 10.0,
+		DoorOpenWindow:   10 * time.Minute,
+		NotifyDoorOpen:   true,
+	}
+
+	checkEvents(mockBot, context.Background(), kiuas, config, nil, currentTime)
+	checkEvents(mockBot, context.Background(), kiuas, config, nil, currentTime)
+
+	if !kiuas.DoorOpenNotificationSent {
+		t.Errorf("Expected DoorOpenNotificationSent to be true")
+	}
+	if len(mockBot.SentMessages) != 1 {
+		t.Fatalf("Expected 1 message to be sent, got %d", len(mockBot.SentMessages))
+	}
+}
+
+func TestCheckEvents_NoDoorOpenAfterReady(t *testing.T) {
+	currentTime := time.Now()
+	kiuas := &Kiuas{WarmingNotificationSent: true, ReadyNotificationSent: true}
+	// The heater is switched off after the ready peak and the sauna cools down
+	for i := 10; i >= 0; i-- {
+		kiuas.AddSample(75.0+float64(i)*1.5, 10.0, 100000, currentTime.Add(-time.Duration(i)*time.Minute))
+	}
+
+	mockBot := &MockTelegramBot{}
+	config := &Config{
+		DoorOpenTempDrop: 10.0,
+		DoorOpenWindow:   10 * time.Minute,
+		NotifyDoorOpen:   true,
+	}
+	checkEvents(mockBot, context.Background(), kiuas, config, nil, currentTime)
+
+	if kiuas.DoorOpenNotificationSent || len(mockBot.SentMessages) != 0 {
+		t.Errorf("Expected no door alert for the cool-down after ready, got %v", mockBot.SentMessages)
+	}
+}
@@ -0,0 +1,227 @@
+// Package format renders Telegram messages for the MarkdownV2 and HTML parse modes.
+//
+// Templates use a small markup that works in both modes: *bold*, _italic_ and a
+// backslash to write the next character literally. All other text in the template
+// and every formatted value is escaped, so dynamic values can never break a message.
+// Entities left open at the end of the template are closed.
+package format
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Mode is a Telegram parse mode
+type Mode string
+
+const (
+	MarkdownV2 Mode = "MarkdownV2"
+	HTML       Mode = "HTML"
+	// Plain text for channels other than Telegram, the markup is removed and nothing is escaped
+	Plain Mode = "Plain"
+)
+
+// ParseMode returns the Telegram parse mode with the given name
+func ParseMode(name string) (Mode, error) {
+	switch strings.ToLower(name) {
+	case "markdownv2", "markdown":
+		return MarkdownV2, nil
+	case "html":
+		return HTML, nil
+	}
+	return "", fmt.Errorf("unknown parse mode %q", name)
+}
+
+// Characters that must be escaped in MarkdownV2, see https://core.telegram.org/bots/api#markdownv2-style
+const markdownV2Reserved = "_*[]()~`>#+-=|{}.!\\"
+
+// EscapeMarkdownV2 escapes every reserved character with a backslash
+func EscapeMarkdownV2(s string) string {
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		if strings.IndexByte(markdownV2Reserved, s[i]) >= 0 {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(s[i])
+	}
+	return sb.String()
+}
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+// EscapeHTML escapes the characters Telegram requires to be written as entities
+func EscapeHTML(s string) string {
+	return htmlEscaper.Replace(s)
+}
+
+// Escape escapes text for the mode, unknown modes are MarkdownV2
+func Escape(mode Mode, s string) string {
+	switch mode {
+	case HTML:
+		return EscapeHTML(s)
+	case Plain:
+		return s
+	}
+	return EscapeMarkdownV2(s)
+}
+
+type entity int
+
+const (
+	bold entity = iota
+	italic
+)
+
+var markers = map[Mode]map[entity][2]string{
+	MarkdownV2: {bold: {"*", "*"}, italic: {"_", "_"}},
+	HTML:       {bold: {"<b>", "</b>"}, italic: {"<i>", "</i>"}},
+	Plain:      {},
+}
+
+type openEntity struct {
+	entity entity
+	// Position of the opening marker and of the content in the output
+	pos, start int
+}
+
+type renderer struct {
+	mode  Mode
+	out   []byte
+	stack []openEntity
+	// The entity closed last and where its closing marker ends, used to join adjacent entities
+	closed    *openEntity
+	closedEnd int
+}
+
+func (r *renderer) text(s string) {
+	r.out = append(r.out, Escape(r.mode, s)...)
+}
+
+func (r *renderer) toggle(e entity) {
+	for i := len(r.stack) - 1; i >= 0; i-- {
+		if r.stack[i].entity == e {
+			r.close(i)
+			return
+		}
+	}
+	r.open(e)
+}
+
+func (r *renderer) open(e entity) {
+	// An entity opened right after closing the same one continues it. In MarkdownV2
+	// "__" would otherwise start an underline.
+	if r.closed != nil && r.closed.entity == e && r.closedEnd == len(r.out) {
+		r.out = r.out[:r.closedEnd-len(markers[r.mode][e][1])]
+		r.stack = append(r.stack, *r.closed)
+		r.closed = nil
+		return
+	}
+	pos := len(r.out)
+	r.out = append(r.out, markers[r.mode][e][0]...)
+	r.stack = append(r.stack, openEntity{entity: e, pos: pos, start: len(r.out)})
+}
+
+// Close the entity at index i of the stack. Entities opened inside it are closed
+// first and reopened after it, so that the output is always properly nested.
+func (r *renderer) close(i int) {
+	inner := make([]entity, 0, len(r.stack)-i-1)
+	for len(r.stack) > i+1 {
+		inner = append(inner, r.stack[len(r.stack)-1].entity)
+		r.closeTop()
+	}
+	r.closeTop()
+	for j := len(inner) - 1; j >= 0; j-- {
+		r.open(inner[j])
+	}
+}
+
+func (r *renderer) closeTop() {
+	top := r.stack[len(r.stack)-1]
+	r.stack = r.stack[:len(r.stack)-1]
+	// Drop empty entities, Telegram does not accept them
+	if len(r.out) == top.start {
+		r.out = r.out[:top.pos]
+		r.closed = nil
+		return
+	}
+	r.out = append(r.out, markers[r.mode][top.entity][1]...)
+	r.closed = &top
+	r.closedEnd = len(r.out)
+}
+
+// Format verbs used in the messages. Other text after a percent sign, like "50% off", is
+// kept as is. The space flag and width and precision given as arguments (%*d) are not supported.
+var verb = regexp.MustCompile(`^%[-+#0]*[0-9]*(\.[0-9]*)?[dfqsvxX%]`)
+
+// Sprintf formats the template like fmt.Sprintf and renders it for the mode.
+// The formatted values are escaped, the markup of the template is kept.
+func Sprintf(mode Mode, template string, args ...any) string {
+	if mode != HTML && mode != Plain {
+		mode = MarkdownV2
+	}
+	r := &renderer{mode: mode}
+	argi := 0
+	literal := 0
+
+	flush := func(i int) {
+		if i > literal {
+			r.text(template[literal:i])
+		}
+	}
+
+	for i := 0; i < len(template); {
+		switch template[i] {
+		case '\\':
+			flush(i)
+			if i+1 < len(template) {
+				// Keep a multi-byte character together
+				size := 1
+				for i+1+size < len(template) && template[i+1+size]&0xC0 == 0x80 {
+					size++
+				}
+				r.text(template[i+1 : i+1+size])
+				i += 1 + size
+			} else {
+				r.text(`\`)
+				i++
+			}
+			literal = i
+		case '*', '_':
+			flush(i)
+			if template[i] == '*' {
+				r.toggle(bold)
+			} else {
+				r.toggle(italic)
+			}
+			i++
+			literal = i
+		case '%':
+			v := verb.FindString(template[i:])
+			if v == "" {
+				i++
+				continue
+			}
+			flush(i)
+			switch {
+			case v == "%%":
+				r.text("%")
+			case argi < len(args):
+				r.text(fmt.Sprintf(v, args[argi]))
+				argi++
+			default:
+				r.text(fmt.Sprintf(v))
+			}
+			i += len(v)
+			literal = i
+		default:
+			i++
+		}
+	}
+	flush(len(template))
+
+	for len(r.stack) > 0 {
+		r.closeTop()
+	}
+	return string(r.out)
+}
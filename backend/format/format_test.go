@@ -0,0 +1,216 @@
+package format
+
+import (
+	"html"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// Every character MarkdownV2 reserves, and a few that are not reserved
+const specCharacters = "_*[]()~`>#+-=|{}.!\\ %&<>\"'aä🔥\n"
+
+func TestEscapeMarkdownV2(t *testing.T) {
+	if got := EscapeMarkdownV2("a_b*c[d](e)!.-"); got != "a\\_b\\*c\\[d\\]\\(e\\)\\!\\.\\-" {
+		t.Errorf("Unexpected escape result %q", got)
+	}
+	if got := EscapeMarkdownV2("~`>#+=|{}\\"); got != "\\~\\`\\>\\#\\+\\=\\|\\{\\}\\\\" {
+		t.Errorf("Unexpected escape result %q", got)
+	}
+}
+
+func TestEscapeHTML(t *testing.T) {
+	if got := EscapeHTML(`<b>"Tom & Jerry"</b>`); got != "&lt;b&gt;&quot;Tom &amp; Jerry&quot;&lt;/b&gt;" {
+		t.Errorf("Unexpected escape result %q", got)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for name, expected := range map[string]Mode{"MarkdownV2": MarkdownV2, "markdown": MarkdownV2, "HTML": HTML} {
+		if mode, err := ParseMode(name); err != nil || mode != expected {
+			t.Errorf("ParseMode(%q) = %s, %v", name, mode, err)
+		}
+	}
+	if _, err := ParseMode("bbcode"); err == nil {
+		t.Errorf("Expected error for an unknown mode")
+	}
+}
+
+func TestSprintf(t *testing.T) {
+	tests := []struct {
+		template string
+		args     []any
+		markdown string
+		html     string
+		plain    string
+	}{
+		{"*Sauna valmis!* %.1f °C", []any{75.0}, "*Sauna valmis\\!* 75\\.0 °C", "<b>Sauna valmis!</b> 75.0 °C", "Sauna valmis! 75.0 °C"},
+		{"Varattu: %s", []any{"*Matti_M* <3"}, "Varattu: \\*Matti\\_M\\* <3", "Varattu: *Matti_M* &lt;3", "Varattu: *Matti_M* <3"},
+		{"Kosteus %.0f%%", []any{80.0}, "Kosteus 80%", "Kosteus 80%", "Kosteus 80%"},
+		{"a \\* b \\_ c", nil, "a \\* b \\_ c", "a * b _ c", "a * b _ c"},
+		{"*bold _both* italic_", nil, "*bold _both_*_ italic_", "<b>bold <i>both</i></b><i> italic</i>", "bold both italic"},
+		{"*a**b*", nil, "*ab*", "<b>ab</b>", "ab"},
+		{"_a__b_", nil, "_ab_", "<i>ab</i>", "ab"},
+		{"** __ *unclosed", nil, "  *unclosed*", "  <b>unclosed</b>", "  unclosed"},
+		{"%d %s", []any{1}, "1 %\\!s\\(MISSING\\)", "1 %!s(MISSING)", "1 %!s(MISSING)"},
+		{"Täysin 100%!", nil, "Täysin 100%\\!", "Täysin 100%!", "Täysin 100%!"},
+		{"50% off, %d left", []any{3}, "50% off, 3 left", "50% off, 3 left", "50% off, 3 left"},
+		{"100% valmis %+d", []any{3}, "100% valmis \\+3", "100% valmis +3", "100% valmis +3"},
+	}
+	for _, tt := range tests {
+		if got := Sprintf(MarkdownV2, tt.template, tt.args...); got != tt.markdown {
+			t.Errorf("Sprintf(MarkdownV2, %q) = %q, expected %q", tt.template, got, tt.markdown)
+		}
+		if got := Sprintf(HTML, tt.template, tt.args...); got != tt.html {
+			t.Errorf("Sprintf(HTML, %q) = %q, expected %q", tt.template, got, tt.html)
+		}
+		if got := Sprintf(Plain, tt.template, tt.args...); got != tt.plain {
+			t.Errorf("Sprintf(Plain, %q) = %q, expected %q", tt.template, got, tt.plain)
+		}
+	}
+}
+
+// Check that the text is valid MarkdownV2: reserved characters are escaped except for
+// bold and italic markers, which must be properly nested and not empty
+func validateMarkdownV2(t *testing.T, text string) {
+	t.Helper()
+	var stack []byte
+	empty := false
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case c == '\\':
+			if i+1 == len(text) {
+				t.Fatalf("Trailing backslash in %q", text)
+			}
+			i++
+			empty = false
+		case c == '*' || c == '_':
+			if c == '_' && i+1 < len(text) && text[i+1] == '_' {
+				t.Fatalf("Double underscore at %d in %q", i, text)
+			}
+			if len(stack) > 0 && stack[len(stack)-1] == c {
+				if empty {
+					t.Fatalf("Empty entity at %d in %q", i, text)
+				}
+				stack = stack[:len(stack)-1]
+			} else if strings.IndexByte(string(stack), c) >= 0 {
+				t.Fatalf("Improperly nested %q at %d in %q", c, i, text)
+			} else {
+				stack = append(stack, c)
+				empty = true
+			}
+		case strings.IndexByte(markdownV2Reserved, c) >= 0:
+			t.Fatalf("Unescaped %q at %d in %q", c, i, text)
+		default:
+			empty = false
+		}
+	}
+	if len(stack) > 0 {
+		t.Fatalf("Unclosed entities %q in %q", stack, text)
+	}
+}
+
+// Check that the text is valid Telegram HTML with only bold and italic tags
+func validateHTML(t *testing.T, text string) {
+	t.Helper()
+	var stack []string
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '<':
+			end := strings.IndexByte(text[i:], '>')
+			if end < 0 {
+				t.Fatalf("Unescaped < at %d in %q", i, text)
+			}
+			tag := text[i+1 : i+end]
+			switch tag {
+			case "b", "i":
+				stack = append(stack, tag)
+			case "/b", "/i":
+				if len(stack) == 0 || stack[len(stack)-1] != tag[1:] {
+					t.Fatalf("Unbalanced tag %q at %d in %q", tag, i, text)
+				}
+				stack = stack[:len(stack)-1]
+			default:
+				t.Fatalf("Unexpected tag %q in %q", tag, text)
+			}
+			i += end
+		case '>':
+			t.Fatalf("Unescaped > at %d in %q", i, text)
+		case '&':
+			rest := text[i:]
+			if !strings.HasPrefix(rest, "&amp;") && !strings.HasPrefix(rest, "&lt;") &&
+				!strings.HasPrefix(rest, "&gt;") && !strings.HasPrefix(rest, "&quot;") {
+				t.Fatalf("Unescaped & at %d in %q", i, text)
+			}
+		}
+	}
+	if len(stack) > 0 {
+		t.Fatalf("Unclosed tags %v in %q", stack, text)
+	}
+}
+
+// Remove the backslashes of a MarkdownV2 escaped text
+func unescapeMarkdownV2(text string) string {
+	var sb strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) {
+			i++
+		}
+		sb.WriteByte(text[i])
+	}
+	return sb.String()
+}
+
+func addSeeds(f *testing.F) {
+	f.Add("")
+	f.Add(specCharacters)
+	for _, c := range specCharacters {
+		f.Add(string(c))
+		f.Add("a" + string(c) + "b" + string(c))
+	}
+	f.Add("*bold _both* italic_")
+	f.Add("%s %d %.1f%% %!")
+}
+
+func FuzzEscapeMarkdownV2(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, s string) {
+		escaped := EscapeMarkdownV2(s)
+		validateMarkdownV2(t, escaped)
+		if unescaped := unescapeMarkdownV2(escaped); unescaped != s {
+			t.Fatalf("Escaping %q is not reversible, got %q", s, unescaped)
+		}
+	})
+}
+
+func FuzzEscapeHTML(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, s string) {
+		escaped := EscapeHTML(s)
+		validateHTML(t, escaped)
+		if unescaped := html.UnescapeString(escaped); unescaped != s {
+			t.Fatalf("Escaping %q is not reversible, got %q", s, unescaped)
+		}
+	})
+}
+
+func FuzzSprintf(f *testing.F) {
+	addSeeds(f)
+	f.Fuzz(func(t *testing.T, template string) {
+		if !utf8.ValidString(template) {
+			t.Skip()
+		}
+		value := template + specCharacters
+		markdown := Sprintf(MarkdownV2, template, value, value, 1.5, value)
+		validateMarkdownV2(t, markdown)
+		validateHTML(t, Sprintf(HTML, template, value, value, 1.5, value))
+
+		// Without markup and verbs only escaping is added
+		if !strings.ContainsAny(template, "*_\\%") {
+			if plain := unescapeMarkdownV2(Sprintf(MarkdownV2, template)); plain != template {
+				t.Fatalf("Sprintf(%q) = %q", template, plain)
+			}
+		}
+	})
+}
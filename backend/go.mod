@@ -6,4 +6,20 @@ require (
 	github.com/go-telegram/bot v1.7.2
 	github.com/joho/godotenv v1.5.1
 	github.com/peterhellberg/ruuvitag v0.1.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/eclipse/paho.mqtt.golang v1.5.0
+	github.com/fxamacker/cbor/v2 v2.9.4
+	github.com/mochi-mqtt/server/v2 v2.7.9
+	golang.org/x/image v0.23.0
+)
+
+require (
+	github.com/gorilla/websocket v1.5.3 // indirect
+	github.com/rs/xid v1.4.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/net v0.33.0 // indirect
+	golang.org/x/sync v0.7.0 // indirect
 )
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// Minimum time between two readings kept in the history
+	historyInterval = time.Minute
+	// How long the readings are kept
+	historyLength = 7 * 24 * time.Hour
+	// How often the history is written to disk
+	historySaveInterval = 10 * time.Minute
+)
+
+// HistoryReading is a single stored measurement
+type HistoryReading struct {
+	Time        time.Time `json:"time"`
+	Temperature float64   `json:"temperature"`
+	Humidity    float64   `json:"humidity"`
+}
+
+// History of the measurements, saved to the data directory every historySaveInterval
+type History struct {
+	mu       sync.RWMutex
+	path     string
+	saved    time.Time
+	Readings []HistoryReading `json:"readings"`
+}
+
+// Load the saved measurement history from the data directory
+func (k *Kiuas) LoadHistory(config *Config) error {
+	h := &History{path: filepath.Join(config.DataDir, "history.json")}
+	if err := loadJSON(h.path, h); err != nil {
+		return err
+	}
+	k.History = h
+	return nil
+}
+
+// Add a reading unless the previous one is less than historyInterval old
+func (h *History) Add(reading HistoryReading) error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if n := len(h.Readings); n > 0 && reading.Time.Sub(h.Readings[n-1].Time) < historyInterval {
+		return nil
+	}
+	h.Readings = append(h.Readings, reading)
+
+	// Drop the readings older than historyLength
+	cutoff := reading.Time.Add(-historyLength)
+	i, _ := slices.BinarySearchFunc(h.Readings, cutoff, func(r HistoryReading, t time.Time) int { return r.Time.Compare(t) })
+	h.Readings = h.Readings[i:]
+
+	if reading.Time.Sub(h.saved) < historySaveInterval {
+		return nil
+	}
+	h.saved = reading.Time
+	return saveJSON(h.path, h)
+}
+
+// Merge adds a reading older than the latest one, e.g. from a batch the proxy buffered while a
+// newer reading got through, unless a stored reading is less than historyInterval away. It is
+// written with the next save. Reports whether the reading was added.
+func (h *History) Merge(reading HistoryReading) bool {
+	if h == nil {
+		return false
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if n := len(h.Readings); n > 0 && reading.Time.Before(h.Readings[n-1].Time.Add(-historyLength)) {
+		return false
+	}
+	i, _ := slices.BinarySearchFunc(h.Readings, reading.Time, func(r HistoryReading, t time.Time) int { return r.Time.Compare(t) })
+	if i > 0 && reading.Time.Sub(h.Readings[i-1].Time) < historyInterval ||
+		i < len(h.Readings) && h.Readings[i].Time.Sub(reading.Time) < historyInterval {
+		return false
+	}
+	h.Readings = slices.Insert(h.Readings, i, reading)
+	return true
+}
+
+// Since returns the readings taken at or after the given time
+func (h *History) Since(t time.Time) []HistoryReading {
+	if h == nil {
+		return nil
+	}
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	i, _ := slices.BinarySearchFunc(h.Readings, t, func(r HistoryReading, t time.Time) int { return r.Time.Compare(t) })
+	return slices.Clone(h.Readings[i:])
+}
+
+// Save writes the history to disk, used on shutdown
+func (h *History) Save() error {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return saveJSON(h.path, h)
+}
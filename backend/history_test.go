@@ -0,0 +1,98 @@
+package main
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestHistory_Add(t *testing.T) {
+	kiuas := &Kiuas{}
+	config := &Config{DataDir: t.TempDir()}
+	if err := kiuas.LoadHistory(config); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, 12, 24, 12, 0, 0, 0, time.UTC)
+	for i := 0; i < 120; i++ {
+		// Two readings per minute, only one of them is kept
+		now := start.Add(time.Duration(i) * 30 * time.Second)
+		if err := kiuas.History.Add(HistoryReading{Time: now, Temperature: float64(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := len(kiuas.History.Readings); n != 60 {
+		t.Errorf("Expected one reading per minute, got %d", n)
+	}
+
+	since := kiuas.History.Since(start.Add(30 * time.Minute))
+	if len(since) != 30 || !since[0].Time.Equal(start.Add(30*time.Minute)) {
+		t.Errorf("Expected readings from the last 30 minutes, got %d", len(since))
+	}
+
+	// Old readings are dropped
+	if err := kiuas.History.Add(HistoryReading{Time: start.Add(historyLength + 30*time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(kiuas.History.Readings); n != 31 {
+		t.Errorf("Expected readings older than the history length to be dropped, got %d", n)
+	}
+}
+
+func TestHistory_Merge(t *testing.T) {
+	h := &History{path: filepath.Join(t.TempDir(), "history.json")}
+	start := time.Date(2024, 12, 24, 12, 0, 0, 0, time.UTC)
+	h.Add(HistoryReading{Time: start, Temperature: 20})
+	h.Add(HistoryReading{Time: start.Add(10 * time.Minute), Temperature: 80})
+
+	if !h.Merge(HistoryReading{Time: start.Add(5 * time.Minute), Temperature: 50}) {
+		t.Errorf("Expected the older reading to be merged")
+	}
+	// Readings too close to a stored one, e.g. sent again, are dropped
+	for _, age := range []time.Duration{5 * time.Minute, 5*time.Minute + 30*time.Second, 10 * time.Minute} {
+		if h.Merge(HistoryReading{Time: start.Add(age), Temperature: 99}) {
+			t.Errorf("Expected the reading at %s to be dropped", age)
+		}
+	}
+	if h.Merge(HistoryReading{Time: start.Add(-historyLength)}) {
+		t.Errorf("Expected a reading older than the history length to be dropped")
+	}
+
+	var temperatures []float64
+	for _, r := range h.Since(time.Time{}) {
+		temperatures = append(temperatures, r.Temperature)
+	}
+	if !slices.Equal(temperatures, []float64{20, 50, 80}) {
+		t.Errorf("Expected the readings in time order, got %v", temperatures)
+	}
+}
+
+func TestHistory_Persisted(t *testing.T) {
+	config := &Config{DataDir: t.TempDir()}
+	kiuas := &Kiuas{}
+	if err := kiuas.LoadHistory(config); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	kiuas.History.Add(HistoryReading{Time: now, Temperature: 80})
+	kiuas.History.Add(HistoryReading{Time: now.Add(time.Minute), Temperature: 81})
+	if err := kiuas.History.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := &Kiuas{}
+	if err := loaded.LoadHistory(config); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.History.Readings) != 2 || loaded.History.Readings[1].Temperature != 81 {
+		t.Errorf("Expected history to be loaded from disk, got %v", loaded.History.Readings)
+	}
+}
+
+func TestHistory_Nil(t *testing.T) {
+	var h *History
+	if err := h.Add(HistoryReading{Time: time.Now()}); err != nil || h.Merge(HistoryReading{}) || h.Since(time.Time{}) != nil {
+		t.Errorf("Expected nil history to be a no-op")
+	}
+}
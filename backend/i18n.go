@@ -0,0 +1,572 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"bt-telegram/format"
+)
+
+// Locale is the language of the bot messages
+type Locale string
+
+const (
+	LocaleFi Locale = "fi"
+	LocaleSv Locale = "sv"
+	LocaleEn Locale = "en"
+)
+
+var locales = []Locale{LocaleFi, LocaleSv, LocaleEn}
+
+// ParseLocale accepts the language codes and names in the supported languages
+func ParseLocale(name string) (Locale, error) {
+	switch strings.ToLower(name) {
+	case "fi", "suomi", "finska", "finnish":
+		return LocaleFi, nil
+	case "sv", "ruotsi", "svenska", "swedish":
+		return LocaleSv, nil
+	case "en", "englanti", "engelska", "english":
+		return LocaleEn, nil
+	}
+	return "", fmt.Errorf("unknown language %q", name)
+}
+
+// Template of the message with the given key in the locale. Messages missing from
+// the locale fall back to Finnish, every key must exist in the Finnish catalog.
+func (l Locale) template(key string) (string, bool) {
+	template, ok := messages[l][key]
+	if !ok {
+		template, ok = messages[LocaleFi][key]
+	}
+	if !ok {
+		log.Printf("Missing message %q\n", key)
+	}
+	return template, ok
+}
+
+// T formats the message with the given key in the locale as plain text
+func (l Locale) T(key string, args ...any) string {
+	template, ok := l.template(key)
+	if !ok {
+		return key
+	}
+	return fmt.Sprintf(template, args...)
+}
+
+// Format renders the message with the given key in the locale for a Telegram parse mode
+func (l Locale) Format(mode format.Mode, key string, args ...any) string {
+	template, ok := l.template(key)
+	if !ok {
+		return format.Escape(mode, key)
+	}
+	return format.Sprintf(mode, template, args...)
+}
+
+// MessageError is an error shown to the user, the text is the message with the key in the catalog
+type MessageError struct {
+	Key  string
+	Args []any
+}
+
+func (e *MessageError) Error() string {
+	return LocaleFi.T(e.Key, e.Args...)
+}
+
+// Error renders an error for the user, a MessageError in the locale and other errors as is
+func (l Locale) Error(err error) string {
+	var msgErr *MessageError
+	if errors.As(err, &msgErr) {
+		return l.T(msgErr.Key, msgErr.Args...)
+	}
+	return err.Error()
+}
+
+// Message templates. Notifications are sent with Format and may use the *bold* and _italic_
+// markup of the format package, the other messages are plain text for fmt.Sprintf.
+var messages = map[Locale]map[string]string{
+	LocaleFi: {
+		"warming":            "🔥*Sauna lämpiää!*🔥\nValmis klo %s",
+		"warming_progress":   "🔥*Sauna lämpiää!*🔥\nValmis klo %s\n🌡️ %.1f °C %s %.0f %%",
+		"ready":              "*Sauna valmis!*🔥\nLämpötila: %.1f °C 🌡️",
+		"stalled":            "⚠️ *Sauna ei saavuttanut tavoitelämpötilaa kahdessa tunnissa!* Tarkista kiuas.",
+		"status":             "Sauna on %s\nLämpötila: %.1f °C\nKosteus: %.1f%%",
+		"status_on":          "päällä",
+		"status_off":         "pois päältä",
+		"status_reservation": "\nVarattu klo %s-%s: %s",
+		"info":               "Saunan tiedot:\nLämpötila: %.1f °C\nKosteus: %.1f%%\nParisto: %s\nViimeisin data: %s",
+		"cooled":             "Sauna on jäähtynyt, lämpötila %.1f °C",
+		"info_webhooks":      "\n\nWebhookit:",
+		"info_webhook":       "\n%s %s → %s, yrityksiä %d: %s",
+		"info_webhook_ok":    "ok",
+		"no_data":            "Anturilta ei ole tullut dataa (%s)",
+		"no_data_escalated":  "⚠️ Saunan anturi ei ole lähettänyt dataa (%s)",
+		"no_data_recovered":  "Datan vastaanotto palautui, katko kesti %s",
+		"rsvp_tulossa":       "✅ Tulossa",
+		"rsvp_ehka":          "🤔 Ehkä",
+		"rsvp_en":            "❌ En",
+		"rsvp_saved":         "Vastaus tallennettu: %s",
+		"rsvp_closed":        "Sessio on jo päättynyt.",
+		"rsvp_unknown":       "Tuntematon vastaus.",
+		"eta_ready":          "Sauna on valmis, lämpötila %.1f °C 🔥",
+		"eta_warming":        "Sauna lämpiää, valmis arviolta klo %s (nyt %.1f °C)",
+		"eta_no_estimate":    "Sauna lämpiää, lämpötila %.1f °C",
+		"eta_off":            "Sauna ei ole päällä.",
+		"today":              "Tänään saunassa:\n%s",
+		"today_session":      "%s-%s lämmitetty, korkein %.1f °C",
+		"today_now":          "%s- päällä nyt",
+		"today_reserved":     "%s-%s varattu",
+		"today_none":         "Tänään ei ole vielä saunottu.",
+		"inline_status":      "Saunan tila",
+		"inline_eta":         "Valmistumisarvio",
+		"inline_today":       "Tämän päivän saunat",
+		"language_name":      "suomi",
+		"language_current":   "Kieli: %s\nKäyttö: /kieli fi|sv|en",
+		"language_set":       "Kieli vaihdettu suomeksi.",
+		"language_admin":     "Vain admin voi vaihtaa ryhmän kielen.",
+		"language_failed":    "Kielen tallennus epäonnistui.",
+		// Alerts and reminders, sent with Format
+		"session_long":                   "⚠️ *Sauna on ollut päällä jo %d h %d min!* Muistakaa sammuttaa kiuas.\nLämpötila: %.1f °C",
+		"session_still_on":               "🚨 *Kiuas on edelleen päällä!* Sauna on ollut valmiina %d h %d min.\nLämpötila: %.1f °C",
+		"loyly":                          "💦 Löylyä heitetty! Kosteus: %.1f%%",
+		"door_open":                      "🚪 *Saunan ovi taitaa olla auki!* Lämpötila laskenut %.0f minuutissa %.1f °C:een.",
+		"safety_overheat":                "🔥 *Ylikuumeneminen!* Lämpötila %.1f °C ylittää rajan %.0f °C. Tarkista kiuas heti!",
+		"safety_rapid_rise":              "⚠️ *Epäuskottava lämpötilan nousu!* Yli %.0f °C minuutissa, nyt %.1f °C. Tarkista anturi.",
+		"safety_frozen_readings":         "⚠️ *Anturin lukemat jumissa!* Sama lukema %.1f °C / %.1f%% yli %.0f minuuttia.",
+		"safety_humidity_saturated":      "⚠️ *Kosteusanturi kyllästynyt!* Kosteus %.1f%%. Anturi voi olla märkä tai rikki.",
+		"safety_overheat_name":           "Ylikuumeneminen",
+		"safety_rapid_rise_name":         "Epäuskottava lämpötilan nousu",
+		"safety_frozen_readings_name":    "Jumissa olevat lukemat",
+		"safety_humidity_saturated_name": "Kosteusanturin kyllästyminen",
+		"safety_recovered":               "✅ %s ohi, kesti %s.",
+		"battery_ok":                     "✅ RuuviTagin paristo ok: %.0f mV",
+		"battery_low":                    "🔋 *RuuviTagin paristo vähissä!* Jännite %.0f mV, raja %.0f mV. Vaihda paristo.",
+		"reservation_reminder":           "⏰ Saunavuorosi alkaa klo %s.",
+		"chart_ready_caption":            "Lämpiäminen",
+		// Replies to the commands, plain text
+		"reserve_usage":                "Käyttö: /varaa <pvm> <klo>-<klo>, esim. /varaa 24.12. 18-20 tai /varaa huomenna 17:30-19",
+		"reserve_conflict":             "Aika on jo varattu: %s",
+		"reserve_failed":               "Varauksen tallennus epäonnistui.",
+		"reserve_done":                 "Varattu: %s",
+		"reservation_invalid_date":     "Virheellinen päivämäärä %q",
+		"reservation_invalid_clock":    "Virheellinen kellonaika %q",
+		"reservation_clock_format":     "Anna aika muodossa 18-20 tai 18:30-20",
+		"reservation_end_before_start": "Varauksen pitää päättyä alkamisen jälkeen",
+		"reservation_in_past":          "Varaus on menneisyydessä",
+		"reservation_too_long":         "Varaus voi olla enintään %s",
+		"reservations":                 "Varaukset:\n%s",
+		"reservations_none":            "Ei tulevia varauksia.",
+		"cancel_reservation_usage":     "Käyttö: /peruvaraus <numero>, numerot näet komennolla /varaukset",
+		"reservation_not_found":        "Varausta #%d ei löytynyt.",
+		"reservation_not_owned":        "Varaus #%d ei ole sinun.",
+		"reservation_cancelled":        "Peruttu: %s",
+		"subscribe_usage":              "Käyttö: /tilaa [lampiaa|valmis|kaikki], /tilaa hiljaa 23-8, /tilaa hiljaa pois, /peru [lampiaa|valmis]",
+		"subscribe_first":              "Tilaa ensin ilmoitukset komennolla /tilaa.",
+		"subscribe_failed":             "Tilauksen tallennus epäonnistui.",
+		"subscribe_private":            "\nAloita keskustelu botin kanssa yksityisesti, jotta se voi lähettää sinulle viestejä.",
+		"subscriptions":                "Tilaukset: %s",
+		"subscriptions_none":           "Sinulla ei ole tilauksia.",
+		"subscription_warming":         "lämpiää",
+		"subscription_ready":           "valmis",
+		"subscription_quiet_hours":     "\nHiljaiset tunnit: %d-%d",
+		"quiet_hours_format":           "Anna hiljaiset tunnit muodossa 23-8",
+		"calendar_disabled":            "Kalenterilinkit eivät ole käytössä, asetus public_url puuttuu.",
+		"calendar_failed":              "Kalenterilinkin luonti epäonnistui.",
+		"calendar_sent_private":        "Lähetin kalenterilinkin yksityisviestinä.",
+		"calendar_link":                "Henkilökohtainen kalenterisyötteesi, lisää se puhelimesi kalenteriin:\n%s",
+		"chart_usage":                  "Käyttö: /graafi [tunnit], enintään %d tuntia",
+		"chart_no_readings":            "Ei mittauksia valitulta ajalta.",
+		"chart_caption":                "Lämpötila ja kosteus, viimeiset %d h",
+		"roles_usage":                  "Käyttö: /roolit aseta <id> <rooli> tai /roolit poista <id>\nRoolit: jasen, yllapitaja, admin",
+		"roles":                        "Roolit:\n%s",
+		"roles_none":                   "Ei tallennettuja rooleja.\n\n%s",
+		"roles_invalid_id":             "Virheellinen id %q",
+		"roles_unknown":                "Tuntematon rooli %q",
+		"roles_failed":                 "Roolien tallennus epäonnistui.",
+		"settings":                     "Asetukset:\n%s\nMuuta: /aseta <nimi> <arvo>",
+		"set_usage":                    "Käyttö: /aseta <nimi> <arvo>\n\n%s",
+		"set_env":                      "Asetusta ei muutettu: ympäristömuuttuja %s ohittaa sen. Poista muuttuja ja käynnistä botti uudelleen.",
+		"set_rejected":                 "Asetusta ei muutettu: %s",
+		"set_save_failed":              "\nTallennus epäonnistui, muutos on voimassa vain uudelleenkäynnistykseen asti.",
+		"setting_unknown":              "tuntematon asetus %q",
+		"setting_invalid_value":        "virheellinen arvo %q: %v",
+		"setting_valmis":               "Valmis-ilmoituksen lämpötila (°C)",
+		"setting_nollaus":              "Ilmoitusten nollauslämpötila (°C)",
+		"setting_lampiaa":              "Lämpiämisilmoituksen alaraja (°C)",
+		"setting_ylikuumeneminen":      "Ylikuumenemishälytys (°C)",
+		"setting_sessio":               "Sauna päällä -hälytys (esim. 4h)",
+		"setting_eidataa":              "Ei dataa -hälytys (esim. 1h)",
+		"setting_paristo":              "Pariston hälytysraja (mV)",
+		"setting_hiljainen_alku":       "Hiljaisten tuntien alku (tunti)",
+		"setting_hiljainen_loppu":      "Hiljaisten tuntien loppu (tunti)",
+		// Descriptions of the commands in the menu of the bot
+		"command_kiuas":      "Näytä saunan tila",
+		"command_graafi":     "Lämpötilakäyrä, esim. /graafi 6 näyttää 6 tuntia",
+		"command_tilaa":      "Tilaa ilmoitukset yksityisviestinä",
+		"command_peru":       "Peru ilmoitusten tilaus",
+		"command_varaa":      "Varaa saunavuoro, esim. /varaa 24.12. 18-20",
+		"command_varaukset":  "Näytä tulevat varaukset",
+		"command_peruvaraus": "Peru varaus",
+		"command_kalenteri":  "Hae henkilökohtainen kalenterilinkki",
+		"command_kieli":      "Vaihda kieli / Byt språk / Change language (fi, sv, en)",
+	},
+	LocaleSv: {
+		"warming":            "🔥*Bastun värms upp!*🔥\nKlar kl. %s",
+		"warming_progress":   "🔥*Bastun värms upp!*🔥\nKlar kl. %s\n🌡️ %.1f °C %s %.0f %%",
+		"ready":              "*Bastun är klar!*🔥\nTemperatur: %.1f °C 🌡️",
+		"stalled":            "⚠️ *Bastun nådde inte måltemperaturen på två timmar!* Kontrollera aggregatet.",
+		"status":             "Bastun är %s\nTemperatur: %.1f °C\nFuktighet: %.1f%%",
+		"status_on":          "på",
+		"status_off":         "av",
+		"status_reservation": "\nBokad kl. %s-%s: %s",
+		"info":               "Bastuinfo:\nTemperatur: %.1f °C\nFuktighet: %.1f%%\nBatteri: %s\nSenaste data: %s",
+		"cooled":             "Bastun har svalnat, temperatur %.1f °C",
+		"info_webhooks":      "\n\nWebhooks:",
+		"info_webhook":       "\n%s %s → %s, försök %d: %s",
+		"info_webhook_ok":    "ok",
+		"no_data":            "Ingen data från sensorn (%s)",
+		"no_data_escalated":  "⚠️ Bastusensorn har inte skickat data (%s)",
+		"no_data_recovered":  "Datamottagningen fungerar igen, avbrottet varade %s",
+		"rsvp_tulossa":       "✅ Kommer",
+		"rsvp_ehka":          "🤔 Kanske",
+		"rsvp_en":            "❌ Nej",
+		"rsvp_saved":         "Svaret sparat: %s",
+		"rsvp_closed":        "Bastuturen har redan tagit slut.",
+		"rsvp_unknown":       "Okänt svar.",
+		"eta_ready":          "Bastun är klar, temperatur %.1f °C 🔥",
+		"eta_warming":        "Bastun värms upp, klar uppskattningsvis kl. %s (nu %.1f °C)",
+		"eta_no_estimate":    "Bastun värms upp, temperatur %.1f °C",
+		"eta_off":            "Bastun är inte på.",
+		"today":              "Bastun i dag:\n%s",
+		"today_session":      "%s-%s uppvärmd, högst %.1f °C",
+		"today_now":          "%s- på nu",
+		"today_reserved":     "%s-%s bokad",
+		"today_none":         "Ingen har bastat i dag ännu.",
+		"inline_status":      "Bastuns status",
+		"inline_eta":         "Beräknad klartid",
+		"inline_today":       "Dagens bastuturer",
+		"language_name":      "svenska",
+		"language_current":   "Språk: %s\nAnvändning: /kieli fi|sv|en",
+		"language_set":       "Språket har ändrats till svenska.",
+		"language_admin":     "Endast en admin kan ändra gruppens språk.",
+		"language_failed":    "Det gick inte att spara språket.",
+		// Alerts and reminders, sent with Format
+		"session_long":                   "⚠️ *Bastun har redan varit på i %d h %d min!* Kom ihåg att stänga av aggregatet.\nTemperatur: %.1f °C",
+		"session_still_on":               "🚨 *Aggregatet är fortfarande på!* Bastun har varit klar i %d h %d min.\nTemperatur: %.1f °C",
+		"loyly":                          "💦 Nu kastades det bad! Fuktighet: %.1f%%",
+		"door_open":                      "🚪 *Bastudörren verkar stå öppen!* Temperaturen har sjunkit på %.0f minuter till %.1f °C.",
+		"safety_overheat":                "🔥 *Överhettning!* Temperaturen %.1f °C överstiger gränsen %.0f °C. Kontrollera aggregatet genast!",
+		"safety_rapid_rise":              "⚠️ *Osannolik temperaturökning!* Över %.0f °C per minut, nu %.1f °C. Kontrollera givaren.",
+		"safety_frozen_readings":         "⚠️ *Givarens värden har fastnat!* Samma värde %.1f °C / %.1f%% i över %.0f minuter.",
+		"safety_humidity_saturated":      "⚠️ *Fuktgivaren är mättad!* Fuktighet %.1f%%. Givaren kan vara våt eller trasig.",
+		"safety_overheat_name":           "Överhettningen",
+		"safety_rapid_rise_name":         "Den osannolika temperaturökningen",
+		"safety_frozen_readings_name":    "De fastnade värdena",
+		"safety_humidity_saturated_name": "Den mättade fuktgivaren",
+		"safety_recovered":               "✅ %s är över, varade %s.",
+		"battery_ok":                     "✅ RuuviTaggens batteri ok: %.0f mV",
+		"battery_low":                    "🔋 *RuuviTaggens batteri är svagt!* Spänning %.0f mV, gräns %.0f mV. Byt batteri.",
+		"reservation_reminder":           "⏰ Din bastutur börjar kl. %s.",
+		"chart_ready_caption":            "Uppvärmning",
+		// Replies to the commands, plain text
+		"reserve_usage":                "Användning: /varaa <datum> <kl>-<kl>, t.ex. /varaa 24.12. 18-20 eller /varaa imorgon 17:30-19",
+		"reserve_conflict":             "Tiden är redan bokad: %s",
+		"reserve_failed":               "Det gick inte att spara bokningen.",
+		"reserve_done":                 "Bokad: %s",
+		"reservation_invalid_date":     "Ogiltigt datum %q",
+		"reservation_invalid_clock":    "Ogiltig tid %q",
+		"reservation_clock_format":     "Ange tiden som 18-20 eller 18:30-20",
+		"reservation_end_before_start": "Bokningen måste sluta efter att den börjar",
+		"reservation_in_past":          "Bokningen är redan förbi",
+		"reservation_too_long":         "En bokning kan vara högst %s",
+		"reservations":                 "Bokningar:\n%s",
+		"reservations_none":            "Inga kommande bokningar.",
+		"cancel_reservation_usage":     "Användning: /peruvaraus <nummer>, numren ser du med /varaukset",
+		"reservation_not_found":        "Bokning #%d hittades inte.",
+		"reservation_not_owned":        "Bokning #%d är inte din.",
+		"reservation_cancelled":        "Avbokad: %s",
+		"subscribe_usage":              "Användning: /tilaa [lampiaa|valmis|kaikki], /tilaa hiljaa 23-8, /tilaa hiljaa pois, /peru [lampiaa|valmis]",
+		"subscribe_first":              "Prenumerera först på aviseringarna med /tilaa.",
+		"subscribe_failed":             "Det gick inte att spara prenumerationen.",
+		"subscribe_private":            "\nStarta en privat chatt med botten så att den kan skicka meddelanden till dig.",
+		"subscriptions":                "Prenumerationer: %s",
+		"subscriptions_none":           "Du har inga prenumerationer.",
+		"subscription_warming":         "värms upp",
+		"subscription_ready":           "klar",
+		"subscription_quiet_hours":     "\nTysta timmar: %d-%d",
+		"quiet_hours_format":           "Ange de tysta timmarna som 23-8",
+		"calendar_disabled":            "Kalenderlänkar används inte, inställningen public_url saknas.",
+		"calendar_failed":              "Det gick inte att skapa kalenderlänken.",
+		"calendar_sent_private":        "Jag skickade kalenderlänken som ett privat meddelande.",
+		"calendar_link":                "Ditt personliga kalenderflöde, lägg till det i telefonens kalender:\n%s",
+		"chart_usage":                  "Användning: /graafi [timmar], högst %d timmar",
+		"chart_no_readings":            "Inga mätningar under den valda tiden.",
+		"chart_caption":                "Temperatur och fuktighet, senaste %d h",
+		"roles_usage":                  "Användning: /roolit aseta <id> <roll> eller /roolit poista <id>\nRoller: jasen, yllapitaja, admin",
+		"roles":                        "Roller:\n%s",
+		"roles_none":                   "Inga sparade roller.\n\n%s",
+		"roles_invalid_id":             "Ogiltigt id %q",
+		"roles_unknown":                "Okänd roll %q",
+		"roles_failed":                 "Det gick inte att spara rollerna.",
+		"settings":                     "Inställningar:\n%s\nÄndra: /aseta <namn> <värde>",
+		"set_usage":                    "Användning: /aseta <namn> <värde>\n\n%s",
+		"set_env":                      "Inställningen ändrades inte: miljövariabeln %s åsidosätter den. Ta bort variabeln och starta om botten.",
+		"set_rejected":                 "Inställningen ändrades inte: %s",
+		"set_save_failed":              "\nDet gick inte att spara, ändringen gäller bara tills botten startas om.",
+		"setting_unknown":              "okänd inställning %q",
+		"setting_invalid_value":        "ogiltigt värde %q: %v",
+		"setting_valmis":               "Temperatur för klar-aviseringen (°C)",
+		"setting_nollaus":              "Temperatur då aviseringarna nollställs (°C)",
+		"setting_lampiaa":              "Nedre gräns för uppvärmningsaviseringen (°C)",
+		"setting_ylikuumeneminen":      "Larm för överhettning (°C)",
+		"setting_sessio":               "Larm för bastu på (t.ex. 4h)",
+		"setting_eidataa":              "Larm för uteblivna data (t.ex. 1h)",
+		"setting_paristo":              "Larmgräns för batteriet (mV)",
+		"setting_hiljainen_alku":       "Början av de tysta timmarna (timme)",
+		"setting_hiljainen_loppu":      "Slutet av de tysta timmarna (timme)",
+		// Descriptions of the commands in the menu of the bot
+		"command_kiuas":      "Visa bastuns läge",
+		"command_graafi":     "Temperaturkurva, t.ex. /graafi 6 visar 6 timmar",
+		"command_tilaa":      "Prenumerera på aviseringar som privata meddelanden",
+		"command_peru":       "Avsluta prenumerationen",
+		"command_varaa":      "Boka en bastutur, t.ex. /varaa 24.12. 18-20",
+		"command_varaukset":  "Visa kommande bokningar",
+		"command_peruvaraus": "Avboka en bokning",
+		"command_kalenteri":  "Hämta en personlig kalenderlänk",
+		"command_kieli":      "Byt språk / Vaihda kieli / Change language (fi, sv, en)",
+	},
+	LocaleEn: {
+		"warming":            "🔥*Sauna is warming up!*🔥\nReady at %s",
+		"warming_progress":   "🔥*Sauna is warming up!*🔥\nReady at %s\n🌡️ %.1f °C %s %.0f %%",
+		"ready":              "*Sauna is ready!*🔥\nTemperature: %.1f °C 🌡️",
+		"stalled":            "⚠️ *Sauna did not reach the target temperature in two hours!* Check the stove.",
+		"status":             "Sauna is %s\nTemperature: %.1f °C\nHumidity: %.1f%%",
+		"status_on":          "on",
+		"status_off":         "off",
+		"status_reservation": "\nReserved %s-%s: %s",
+		"info":               "Sauna Info:\nTemperature: %.1f °C\nHumidity: %.1f%%\nBattery: %s\nLast Data Received: %s",
+		"cooled":             "Sauna has cooled down, temperature %.1f °C",
+		"info_webhooks":      "\n\nWebhooks:",
+		"info_webhook":       "\n%s %s → %s, attempts %d: %s",
+		"info_webhook_ok":    "ok",
+		"no_data":            "No data received for %s",
+		"no_data_escalated":  "⚠️ Sauna sensor has not sent data for %s",
+		"no_data_recovered":  "Data reception recovered, outage lasted %s",
+		"rsvp_tulossa":       "✅ Coming",
+		"rsvp_ehka":          "🤔 Maybe",
+		"rsvp_en":            "❌ Not coming",
+		"rsvp_saved":         "Answer saved: %s",
+		"rsvp_closed":        "The session has already ended.",
+		"rsvp_unknown":       "Unknown answer.",
+		"eta_ready":          "Sauna is ready, temperature %.1f °C 🔥",
+		"eta_warming":        "Sauna is warming up, ready at about %s (now %.1f °C)",
+		"eta_no_estimate":    "Sauna is warming up, temperature %.1f °C",
+		"eta_off":            "Sauna is not on.",
+		"today":              "Sauna today:\n%s",
+		"today_session":      "%s-%s heated, max %.1f °C",
+		"today_now":          "%s- on now",
+		"today_reserved":     "%s-%s reserved",
+		"today_none":         "No sauna sessions today yet.",
+		"inline_status":      "Sauna status",
+		"inline_eta":         "Estimated ready time",
+		"inline_today":       "Today's sessions",
+		"language_name":      "English",
+		"language_current":   "Language: %s\nUsage: /kieli fi|sv|en",
+		"language_set":       "Language changed to English.",
+		"language_admin":     "Only an admin can change the language of a group.",
+		"language_failed":    "Saving the language failed.",
+		// Alerts and reminders, sent with Format
+		"session_long":                   "⚠️ *Sauna has been on for %d h %d min!* Remember to switch off the stove.\nTemperature: %.1f °C",
+		"session_still_on":               "🚨 *The stove is still on!* Sauna has been ready for %d h %d min.\nTemperature: %.1f °C",
+		"loyly":                          "💦 Löyly thrown! Humidity: %.1f%%",
+		"door_open":                      "🚪 *The sauna door seems to be open!* Temperature has dropped in %.0f minutes to %.1f °C.",
+		"safety_overheat":                "🔥 *Overheating!* Temperature %.1f °C exceeds the limit of %.0f °C. Check the stove now!",
+		"safety_rapid_rise":              "⚠️ *Implausible temperature rise!* Over %.0f °C per minute, now %.1f °C. Check the sensor.",
+		"safety_frozen_readings":         "⚠️ *Sensor readings stuck!* The same reading %.1f °C / %.1f%% for over %.0f minutes.",
+		"safety_humidity_saturated":      "⚠️ *Humidity sensor saturated!* Humidity %.1f%%. The sensor may be wet or broken.",
+		"safety_overheat_name":           "Overheating",
+		"safety_rapid_rise_name":         "Implausible temperature rise",
+		"safety_frozen_readings_name":    "Stuck readings",
+		"safety_humidity_saturated_name": "Saturated humidity sensor",
+		"safety_recovered":               "✅ %s over, lasted %s.",
+		"battery_ok":                     "✅ RuuviTag battery ok: %.0f mV",
+		"battery_low":                    "🔋 *RuuviTag battery low!* Voltage %.0f mV, limit %.0f mV. Replace the battery.",
+		"reservation_reminder":           "⏰ Your sauna turn starts at %s.",
+		"chart_ready_caption":            "Warming up",
+		// Replies to the commands, plain text
+		"reserve_usage":                "Usage: /varaa <date> <time>-<time>, e.g. /varaa 24.12. 18-20 or /varaa tomorrow 17:30-19",
+		"reserve_conflict":             "The time is already reserved: %s",
+		"reserve_failed":               "Saving the reservation failed.",
+		"reserve_done":                 "Reserved: %s",
+		"reservation_invalid_date":     "Invalid date %q",
+		"reservation_invalid_clock":    "Invalid time %q",
+		"reservation_clock_format":     "Give the time as 18-20 or 18:30-20",
+		"reservation_end_before_start": "The reservation must end after it starts",
+		"reservation_in_past":          "The reservation is in the past",
+		"reservation_too_long":         "A reservation can be at most %s",
+		"reservations":                 "Reservations:\n%s",
+		"reservations_none":            "No upcoming reservations.",
+		"cancel_reservation_usage":     "Usage: /peruvaraus <number>, see the numbers with /varaukset",
+		"reservation_not_found":        "Reservation #%d not found.",
+		"reservation_not_owned":        "Reservation #%d is not yours.",
+		"reservation_cancelled":        "Cancelled: %s",
+		"subscribe_usage":              "Usage: /tilaa [lampiaa|valmis|kaikki], /tilaa hiljaa 23-8, /tilaa hiljaa pois, /peru [lampiaa|valmis]",
+		"subscribe_first":              "Subscribe to the notifications with /tilaa first.",
+		"subscribe_failed":             "Saving the subscription failed.",
+		"subscribe_private":            "\nStart a private chat with the bot so that it can send you messages.",
+		"subscriptions":                "Subscriptions: %s",
+		"subscriptions_none":           "You have no subscriptions.",
+		"subscription_warming":         "warming up",
+		"subscription_ready":           "ready",
+		"subscription_quiet_hours":     "\nQuiet hours: %d-%d",
+		"quiet_hours_format":           "Give the quiet hours as 23-8",
+		"calendar_disabled":            "Calendar links are not in use, the public_url setting is missing.",
+		"calendar_failed":              "Creating the calendar link failed.",
+		"calendar_sent_private":        "I sent the calendar link as a private message.",
+		"calendar_link":                "Your personal calendar feed, add it to the calendar of your phone:\n%s",
+		"chart_usage":                  "Usage: /graafi [hours], at most %d hours",
+		"chart_no_readings":            "No readings in the selected time.",
+		"chart_caption":                "Temperature and humidity, last %d h",
+		"roles_usage":                  "Usage: /roolit aseta <id> <role> or /roolit poista <id>\nRoles: jasen, yllapitaja, admin",
+		"roles":                        "Roles:\n%s",
+		"roles_none":                   "No saved roles.\n\n%s",
+		"roles_invalid_id":             "Invalid id %q",
+		"roles_unknown":                "Unknown role %q",
+		"roles_failed":                 "Saving the roles failed.",
+		"settings":                     "Settings:\n%s\nChange: /aseta <name> <value>",
+		"set_usage":                    "Usage: /aseta <name> <value>\n\n%s",
+		"set_env":                      "The setting was not changed: the environment variable %s overrides it. Remove the variable and restart the bot.",
+		"set_rejected":                 "The setting was not changed: %s",
+		"set_save_failed":              "\nSaving failed, the change is only in effect until the bot is restarted.",
+		"setting_unknown":              "unknown setting %q",
+		"setting_invalid_value":        "invalid value %q: %v",
+		"setting_valmis":               "Temperature of the ready notification (°C)",
+		"setting_nollaus":              "Temperature at which the notifications reset (°C)",
+		"setting_lampiaa":              "Lower limit of the warming notification (°C)",
+		"setting_ylikuumeneminen":      "Overheat alert (°C)",
+		"setting_sessio":               "Sauna left on alert (e.g. 4h)",
+		"setting_eidataa":              "No data alert (e.g. 1h)",
+		"setting_paristo":              "Battery alert limit (mV)",
+		"setting_hiljainen_alku":       "Start of the quiet hours (hour)",
+		"setting_hiljainen_loppu":      "End of the quiet hours (hour)",
+		// Descriptions of the commands in the menu of the bot
+		"command_kiuas":      "Show the sauna status",
+		"command_graafi":     "Temperature chart, e.g. /graafi 6 shows 6 hours",
+		"command_tilaa":      "Subscribe to the notifications as private messages",
+		"command_peru":       "Cancel the subscription",
+		"command_varaa":      "Reserve a sauna turn, e.g. /varaa 24.12. 18-20",
+		"command_varaukset":  "Show the upcoming reservations",
+		"command_peruvaraus": "Cancel a reservation",
+		"command_kalenteri":  "Get a personal calendar link",
+		"command_kieli":      "Change language / Vaihda kieli / Byt språk (fi, sv, en)",
+	},
+}
+
+// Languages chosen with /kieli for chats and users, saved to the data directory.
+// The private chat ID of a user is the same as the user ID.
+type Languages struct {
+	mu    sync.RWMutex
+	path  string
+	Chats map[int64]Locale `json:"chats"`
+}
+
+// LoadLanguages reads the saved languages from the data directory
+func LoadLanguages(config *Config) (*Languages, error) {
+	l := &Languages{
+		path:  filepath.Join(config.DataDir, "languages.json"),
+		Chats: make(map[int64]Locale),
+	}
+	if err := loadJSON(l.path, l); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// For returns the language of a chat, or the configured default language
+func (l *Languages) For(config *Config, chatID int64) Locale {
+	if l != nil {
+		l.mu.RLock()
+		defer l.mu.RUnlock()
+		if locale, ok := l.Chats[chatID]; ok {
+			return locale
+		}
+	}
+	if locale, err := ParseLocale(config.Language); err == nil {
+		return locale
+	}
+	return LocaleFi
+}
+
+// Set the language of a chat and save the languages
+func (l *Languages) Set(chatID int64, locale Locale) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Chats[chatID] = locale
+	return saveJSON(l.path, l)
+}
+
+// Commands in the menu of the bot, the description of each is command_<name> in the catalog
+var botCommands = []string{"kiuas", "graafi", "tilaa", "peru", "varaa", "varaukset", "peruvaraus", "kalenteri", "kieli"}
+
+// Register the command menu in every language. Telegram shows the menu of the language of
+// the user's app and the one without a language code, in the default language, to the others.
+func setBotCommands(ctx context.Context, b TelegramBot, config *Config) error {
+	commands := func(locale Locale) []models.BotCommand {
+		list := make([]models.BotCommand, len(botCommands))
+		for i, name := range botCommands {
+			list[i] = models.BotCommand{Command: name, Description: locale.T("command_" + name)}
+		}
+		return list
+	}
+
+	defaultLocale, err := ParseLocale(config.Language)
+	if err != nil {
+		defaultLocale = LocaleFi
+	}
+	if err := b.SetMyCommands(ctx, &bot.SetMyCommandsParams{Commands: commands(defaultLocale)}); err != nil {
+		return err
+	}
+	for _, locale := range locales {
+		if err := b.SetMyCommands(ctx, &bot.SetMyCommandsParams{Commands: commands(locale), LanguageCode: string(locale)}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler for /kieli [fi|sv|en]. Anyone can choose the language of a private chat,
+// changing the language of a group requires the admin role.
+func handleLanguageCommand(ctx context.Context, b TelegramBot, config *Config, auth *Authorizer, langs *Languages, update *models.Update) {
+	userID, chatID := updateIDs(update)
+	locale := langs.For(config, chatID)
+	args := strings.Fields(update.Message.Text)[1:]
+
+	if len(args) != 1 {
+		replyText(ctx, b, update, locale.T("language_current", locale.T("language_name")))
+		return
+	}
+	newLocale, err := ParseLocale(args[0])
+	if err != nil {
+		replyText(ctx, b, update, locale.T("language_current", locale.T("language_name")))
+		return
+	}
+	if chatID != userID && auth.RoleFor(userID, chatID) < RoleAdmin {
+		replyText(ctx, b, update, locale.T("language_admin"))
+		return
+	}
+
+	if err := langs.Set(chatID, newLocale); err != nil {
+		log.Printf("Failed to save languages: %v\n", err)
+		replyText(ctx, b, update, locale.T("language_failed"))
+		return
+	}
+	log.Printf("Language of chat %d set to %s by %s\n", chatID, newLocale, userName(update.Message.From))
+	replyText(ctx, b, update, newLocale.T("language_set"))
+}
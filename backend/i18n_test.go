@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"bt-telegram/format"
+)
+
+var formatVerb = regexp.MustCompile(`%[-+# 0-9.]*[a-zA-Z%]`)
+
+func TestMessages_AllKeysInAllLocales(t *testing.T) {
+	for _, locale := range locales {
+		if _, ok := messages[locale]; !ok {
+			t.Fatalf("Missing catalog for %s", locale)
+		}
+	}
+
+	for _, locale := range locales {
+		for key, format := range messages[locale] {
+			for _, other := range locales {
+				otherFormat, ok := messages[other][key]
+				if !ok {
+					t.Errorf("Key %q of %s is missing from %s", key, locale, other)
+					continue
+				}
+				// Arguments are passed in the same order in every language
+				if !slices.Equal(formatVerb.FindAllString(format, -1), formatVerb.FindAllString(otherFormat, -1)) {
+					t.Errorf("Key %q has different format verbs in %s and %s", key, locale, other)
+				}
+			}
+		}
+	}
+}
+
+func TestLocale_T(t *testing.T) {
+	if got := LocaleSv.T("status_on"); got != "på" {
+		t.Errorf("Unexpected Swedish message %q", got)
+	}
+	if got := Locale("de").T("eta_off"); got != "Sauna ei ole päällä." {
+		t.Errorf("Expected unknown locale to fall back to Finnish, got %q", got)
+	}
+	if got := LocaleEn.T("no_such_key"); got != "no_such_key" {
+		t.Errorf("Expected missing key to be returned as is, got %q", got)
+	}
+}
+
+func TestLocale_Format(t *testing.T) {
+	if got := LocaleSv.Format(format.MarkdownV2, "ready", 75.0); got != "*Bastun är klar\\!*🔥\nTemperatur: 75\\.0 °C 🌡️" {
+		t.Errorf("Unexpected MarkdownV2 message %q", got)
+	}
+	if got := LocaleSv.Format(format.HTML, "ready", 75.0); got != "<b>Bastun är klar!</b>🔥\nTemperatur: 75.0 °C 🌡️" {
+		t.Errorf("Unexpected HTML message %q", got)
+	}
+	if got := LocaleEn.Format(format.MarkdownV2, "no_such_key"); got != "no\\_such\\_key" {
+		t.Errorf("Expected missing key to be escaped, got %q", got)
+	}
+}
+
+func TestParseLocale(t *testing.T) {
+	for name, expected := range map[string]Locale{"fi": LocaleFi, "Svenska": LocaleSv, "englanti": LocaleEn} {
+		if locale, err := ParseLocale(name); err != nil || locale != expected {
+			t.Errorf("ParseLocale(%q) = %s, %v", name, locale, err)
+		}
+	}
+	if _, err := ParseLocale("de"); err == nil {
+		t.Errorf("Expected error for an unsupported language")
+	}
+}
+
+func newTestLanguages(t *testing.T) *Languages {
+	t.Helper()
+	langs, err := LoadLanguages(&Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return langs
+}
+
+func TestLanguages(t *testing.T) {
+	langs := newTestLanguages(t)
+	config := &Config{Language: "en"}
+
+	if locale := langs.For(config, 42); locale != LocaleEn {
+		t.Errorf("Expected the configured default language, got %s", locale)
+	}
+	if err := langs.Set(42, LocaleSv); err != nil {
+		t.Fatal(err)
+	}
+	if locale := langs.For(config, 42); locale != LocaleSv {
+		t.Errorf("Expected the chosen language, got %s", locale)
+	}
+
+	loaded, err := LoadLanguages(&Config{DataDir: filepath.Dir(langs.path)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locale := loaded.For(config, 42); locale != LocaleSv {
+		t.Errorf("Expected language to be loaded from disk, got %s", locale)
+	}
+
+	var nilLangs *Languages
+	if locale := nilLangs.For(&Config{}, 42); locale != LocaleFi {
+		t.Errorf("Expected Finnish without languages, got %s", locale)
+	}
+}
+
+func TestHandleLanguageCommand(t *testing.T) {
+	auth := newTestAuthorizer(t)
+	langs := newTestLanguages(t)
+	config := auth.configs.Load()
+	mockBot := &MockTelegramBot{}
+	ctx := context.Background()
+
+	handleLanguageCommand(ctx, mockBot, config, auth, langs, newCommandUpdate(42, "/kieli sv"))
+	if langs.For(config, 42) != LocaleSv || mockBot.SentMessages[0] != "Språket har ändrats till svenska." {
+		t.Errorf("Expected the private chat language to change, got %v", mockBot.SentMessages)
+	}
+
+	// Members can not change the language of the notification chat
+	handleLanguageCommand(ctx, mockBot, config, auth, langs, newCommandUpdate(-200, "/kieli en"))
+	if langs.For(config, -200) != LocaleFi {
+		t.Errorf("Expected group language not to change")
+	}
+
+	handleLanguageCommand(ctx, mockBot, config, auth, langs, newCommandUpdate(-100, "/kieli en"))
+	if langs.For(config, -100) != LocaleEn {
+		t.Errorf("Expected admin to change the group language")
+	}
+
+	handleLanguageCommand(ctx, mockBot, config, auth, langs, newCommandUpdate(42, "/kieli"))
+	if last := mockBot.SentMessages[len(mockBot.SentMessages)-1]; !strings.HasPrefix(last, "Språk: svenska") {
+		t.Errorf("Expected current language in Swedish, got %q", last)
+	}
+}
+
+func TestCheckAndNotify_Localized(t *testing.T) {
+	currentTime := time.Date(2024, 12, 1, 18, 0, 0, 0, time.Local)
+	kiuas := &Kiuas{Temperature: 80.0}
+	config := &Config{ReadyThreshold: 75.0, ResetThreshold: 40.0, NotificationChatID: 1, Language: "fi"}
+
+	subs := newTestSubscriptions(t)
+	subs.Update(42, func(sub *Subscription) { sub.Ready = true })
+	langs := newTestLanguages(t)
+	langs.Set(42, LocaleEn)
+
+	mockBot := &MockTelegramBot{}
+	checkAndNotify(mockBot, context.Background(), kiuas, config, subs, langs, currentTime)
+
+	if len(mockBot.SentMessages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(mockBot.SentMessages))
+	}
+	if !strings.HasPrefix(mockBot.SentMessages[0], "*Sauna valmis") || !strings.HasPrefix(mockBot.SentMessages[1], "*Sauna is ready") {
+		t.Errorf("Expected Finnish to the group and English to the subscriber, got %v", mockBot.SentMessages)
+	}
+}
+
+func TestCheckSafety_Localized(t *testing.T) {
+	currentTime := time.Date(2024, 12, 1, 18, 0, 0, 0, time.Local)
+	kiuas := &Kiuas{Temperature: 115.0}
+	config := &Config{MaintenanceChatID: 1, NotificationChatID: 2, OverheatThreshold: 110.0, SafetyRecoveryTime: 5 * time.Minute, Language: "fi"}
+	langs := newTestLanguages(t)
+	langs.Set(1, LocaleSv)
+
+	mockBot := &MockTelegramBot{}
+	checkSafety(mockBot, context.Background(), kiuas, config, langs, currentTime)
+	kiuas.Temperature = 90.0
+	checkSafety(mockBot, context.Background(), kiuas, config, langs, currentTime.Add(10*time.Minute))
+
+	if len(mockBot.SentMessages) != 2 {
+		t.Fatalf("Expected an alert and a recovery message, got %v", mockBot.SentMessages)
+	}
+	if !strings.HasPrefix(mockBot.SentMessages[0], "🔥 *Överhettning\\!*") || !strings.HasPrefix(mockBot.SentMessages[1], "✅ Överhettningen är över") {
+		t.Errorf("Expected the alerts in the language of the maintenance chat, got %v", mockBot.SentMessages)
+	}
+}
+
+func TestLocale_Error(t *testing.T) {
+	err := &MessageError{Key: "reservation_invalid_date", Args: []any{"eilen"}}
+	if got := LocaleSv.Error(err); got != `Ogiltigt datum "eilen"` {
+		t.Errorf("Unexpected Swedish error %q", got)
+	}
+	if got := err.Error(); got != `Virheellinen päivämäärä "eilen"` {
+		t.Errorf("Expected the error text in Finnish, got %q", got)
+	}
+	if got := LocaleSv.Error(errors.New("disk full")); got != "disk full" {
+		t.Errorf("Expected other errors as is, got %q", got)
+	}
+}
+
+func TestHandleReserveCommand_Localized(t *testing.T) {
+	reservations := newTestReservations(t)
+	now := time.Date(2024, 12, 20, 12, 0, 0, 0, time.Local)
+	config := &Config{Language: "fi"}
+	langs := newTestLanguages(t)
+	langs.Set(42, LocaleEn)
+	mockBot := &MockTelegramBot{}
+	ctx := context.Background()
+
+	handleReserveCommand(ctx, mockBot, config, reservations, langs, newCommandUpdate(42, "/varaa tomorrow 20-18"), now)
+	handleReserveCommand(ctx, mockBot, config, reservations, langs, newCommandUpdate(42, "/varaa tomorrow 18-20"), now)
+	handleReservationsCommand(ctx, mockBot, config, reservations, langs, newCommandUpdate(-200, "/varaukset"), now)
+
+	want := []string{
+		"The reservation must end after it starts",
+		"Reserved: #1 21.12. 18:00-20:00 @tonttu",
+		"Varaukset:\n#1 21.12. 18:00-20:00 @tonttu",
+	}
+	if !slices.Equal(mockBot.SentMessages, want) {
+		t.Errorf("Expected the replies in the language of the chat, got %q", mockBot.SentMessages)
+	}
+}
+
+func TestSetBotCommands(t *testing.T) {
+	mockBot := &MockTelegramBot{}
+	if err := setBotCommands(context.Background(), mockBot, &Config{Language: "en"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(mockBot.Commands) != 1+len(locales) {
+		t.Fatalf("Expected the default menu and one for each language, got %d", len(mockBot.Commands))
+	}
+	if def := mockBot.Commands[0]; def.LanguageCode != "" || def.Commands[0].Description != "Show the sauna status" {
+		t.Errorf("Expected the default menu in the configured language, got %+v", def)
+	}
+	for i, locale := range locales {
+		menu := mockBot.Commands[i+1]
+		if menu.LanguageCode != string(locale) || len(menu.Commands) != len(botCommands) || menu.Commands[0].Description != locale.T("command_kiuas") {
+			t.Errorf("Unexpected menu for %s: %+v", locale, menu)
+		}
+	}
+}
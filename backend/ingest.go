@@ -0,0 +1,488 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/peterhellberg/ruuvitag"
+
+	"bt-telegram/batch"
+)
+
+// Readings arrive from the HTTP handlers and the MQTT client concurrently, they are processed one at a time
+var ingestMu sync.Mutex
+
+// Slow work started while processing a reading, e.g. uploads and requests to other services,
+// runs in the background so that the next reading does not wait for it. main waits for it on shutdown.
+var background sync.WaitGroup
+
+func goBackground(f func()) {
+	background.Add(1)
+	go func() {
+		defer background.Done()
+		f()
+	}()
+}
+
+const (
+	// How far in the future a device timestamp may be
+	maxClockSkew = time.Minute
+	// Readings older than this are backfilled without notifications
+	backfillAge = 5 * time.Minute
+	// Largest ingest request body after decompressing
+	maxIngestBody = 1 << 20
+)
+
+// Manufacturer specific data in a BLE advertisement, and the company id of Ruuvi
+const (
+	adTypeManufacturerData = 0xFF
+	ruuviCompanyID         = 0x0499
+)
+
+// TagReading is a reading of a tag received from a gateway. A zero Time means the
+// gateway did not timestamp it and it is processed as received now.
+type TagReading struct {
+	MAC  string
+	Data ruuvitag.RAWv2
+	Time time.Time
+}
+
+// RuuviGatewayMessage is the MQTT payload of a Ruuvi Gateway for a single tag
+type RuuviGatewayMessage struct {
+	GatewayMAC string      `json:"gw_mac"`
+	RSSI       int         `json:"rssi"`
+	Timestamp  unixSeconds `json:"ts"`   // when the gateway received the advertisement
+	Data       string      `json:"data"` // the raw advertisement in hex
+}
+
+// RuuviGatewayBatch is the HTTP payload of a Ruuvi Gateway, the latest advertisement of every tag it hears
+type RuuviGatewayBatch struct {
+	Data struct {
+		GatewayMAC string      `json:"gw_mac"`
+		Timestamp  unixSeconds `json:"timestamp"`
+		Tags       map[string]struct {
+			RSSI      int         `json:"rssi"`
+			Timestamp unixSeconds `json:"timestamp"`
+			Data      string      `json:"data"`
+		} `json:"tags"`
+	} `json:"data"`
+}
+
+// RuuviStationBatch is the HTTP payload of the gateway feature of the Ruuvi Station app,
+// which sends the decoded values instead of the advertisement
+type RuuviStationBatch struct {
+	DeviceID string `json:"deviceId"`
+	Tags     []struct {
+		ID          string      `json:"id"`
+		DataFormat  int         `json:"dataFormat"`
+		Temperature float64     `json:"temperature"`
+		Humidity    float64     `json:"humidity"`
+		Pressure    float64     `json:"pressure"` // Pa, hPa in older versions
+		Voltage     float64     `json:"voltage"`  // V
+		UpdateAt    stationTime `json:"updateAt"`
+	} `json:"tags"`
+}
+
+// Ruuvi Station leaves out the colon of the zone offset, e.g. 2019-11-18T13:13:36+0200
+type stationTime struct {
+	time.Time
+}
+
+func (t *stationTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.Parse("2006-01-02T15:04:05-0700", s)
+	if err != nil {
+		parsed, err = time.Parse(time.RFC3339, s)
+	}
+	t.Time = parsed
+	return err
+}
+
+// Unix seconds in the JSON of a Ruuvi Gateway. Older firmware sends them as a string,
+// e.g. "ts": "1659365222", newer firmware as a number.
+type unixSeconds int64
+
+func (s *unixSeconds) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	text := strings.Trim(string(data), `"`)
+	if text == "" {
+		*s = 0
+		return nil
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid timestamp %s", data)
+	}
+	*s = unixSeconds(n)
+	return nil
+}
+
+// Parse an MQTT payload, either the raw manufacturer data of the tag or the JSON of a Ruuvi Gateway
+func parseRuuviPayload(payload []byte) (TagReading, error) {
+	trimmed := bytes.TrimSpace(payload)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return parseAdvertisement(payload, 0)
+	}
+	var msg RuuviGatewayMessage
+	if err := json.Unmarshal(trimmed, &msg); err != nil {
+		return TagReading{}, fmt.Errorf("invalid gateway JSON: %w", err)
+	}
+	advertisement, err := hex.DecodeString(msg.Data)
+	if err != nil {
+		return TagReading{}, fmt.Errorf("invalid gateway data: %w", err)
+	}
+	return parseAdvertisement(advertisement, int64(msg.Timestamp))
+}
+
+// Parse the JSON batch of a Ruuvi Gateway or Ruuvi Station. Tags with invalid data are
+// skipped, an error is only returned if the batch itself cannot be read.
+func parseGatewayBatch(body []byte) ([]TagReading, error) {
+	// The gateway sends an object under data, the station a list of tags
+	var probe struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(body, &probe); err != nil {
+		return nil, fmt.Errorf("invalid gateway JSON: %w", err)
+	}
+
+	var readings []TagReading
+	if probe.Data != nil {
+		var batch RuuviGatewayBatch
+		if err := json.Unmarshal(body, &batch); err != nil {
+			return nil, fmt.Errorf("invalid gateway JSON: %w", err)
+		}
+		for mac, tag := range batch.Data.Tags {
+			timestamp := tag.Timestamp
+			if timestamp == 0 {
+				timestamp = batch.Data.Timestamp
+			}
+			advertisement, err := hex.DecodeString(tag.Data)
+			if err != nil {
+				log.Printf("Ignoring tag %s from gateway %s: invalid data: %v\n", mac, batch.Data.GatewayMAC, err)
+				continue
+			}
+			reading, err := parseAdvertisement(advertisement, int64(timestamp))
+			if err != nil {
+				log.Printf("Ignoring tag %s from gateway %s: %v\n", mac, batch.Data.GatewayMAC, err)
+				continue
+			}
+			reading.MAC = strings.ToUpper(mac)
+			readings = append(readings, reading)
+		}
+		return readings, nil
+	}
+
+	var batch RuuviStationBatch
+	if err := json.Unmarshal(body, &batch); err != nil {
+		return nil, fmt.Errorf("invalid station JSON: %w", err)
+	}
+	for _, tag := range batch.Tags {
+		if tag.DataFormat != 5 {
+			log.Printf("Ignoring tag %s from station %s: data format %d\n", tag.ID, batch.DeviceID, tag.DataFormat)
+			continue
+		}
+		pressure := tag.Pressure
+		if pressure < 2000 {
+			pressure *= 100
+		}
+		readings = append(readings, TagReading{
+			MAC: strings.ToUpper(tag.ID),
+			Data: ruuvitag.RAWv2{
+				DataFormat:  5,
+				Temperature: tag.Temperature,
+				Humidity:    tag.Humidity,
+				Pressure:    uint32(math.Round(pressure)),
+				Battery:     uint16(math.Round(tag.Voltage * 1000)),
+			},
+			Time: tag.UpdateAt.Time,
+		})
+	}
+	return readings, nil
+}
+
+// Parse a BLE advertisement or the manufacturer data of the tag, timestamp is in Unix seconds or zero
+func parseAdvertisement(advertisement []byte, timestamp int64) (TagReading, error) {
+	data, err := manufacturerData(advertisement)
+	if err != nil {
+		return TagReading{}, err
+	}
+	tag, err := ruuvitag.ParseRAWv2(data)
+	if err != nil {
+		return TagReading{}, err
+	}
+	reading := TagReading{MAC: formatMAC(tag.MAC), Data: tag}
+	if timestamp > 0 {
+		reading.Time = time.Unix(timestamp, 0)
+	}
+	return reading, nil
+}
+
+func formatMAC(mac [6]byte) string {
+	return fmt.Sprintf("%02X:%02X:%02X:%02X:%02X:%02X", mac[0], mac[1], mac[2], mac[3], mac[4], mac[5])
+}
+
+// Find the Ruuvi manufacturer data in a BLE advertisement. Data that already starts
+// with the company id is returned as is.
+func manufacturerData(advertisement []byte) ([]byte, error) {
+	if ruuvitag.IsRAWv2(advertisement) {
+		return advertisement, nil
+	}
+	// The advertisement is a list of length, type, data structures
+	for i := 0; i+1 < len(advertisement); {
+		length := int(advertisement[i])
+		if length == 0 || i+1+length > len(advertisement) {
+			break
+		}
+		structure := advertisement[i+1 : i+1+length]
+		if structure[0] == adTypeManufacturerData && len(structure) >= 3 &&
+			int(structure[1])|int(structure[2])<<8 == ruuviCompanyID {
+			return structure[1:], nil
+		}
+		i += 1 + length
+	}
+	return nil, errors.New("no Ruuvi manufacturer data in the advertisement")
+}
+
+// Feed a reading of the tag to the sauna: the history, the notifications and the other checks
+func processReading(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, subs *Subscriptions, langs *Languages, ruuviTag ruuvitag.RAWv2, now time.Time) {
+	ingestMu.Lock()
+	defer ingestMu.Unlock()
+
+	recordReading(kiuas, ruuviTag, now)
+	checkReading(b, ctx, kiuas, config, subs, langs, now)
+}
+
+// Update the state of the sauna with a reading taken at the given time
+func recordReading(kiuas *Kiuas, ruuviTag ruuvitag.RAWv2, t time.Time) {
+	kiuas.Temperature = ruuviTag.Temperature
+	kiuas.Humidity = ruuviTag.Humidity
+	kiuas.Battery = ruuviTag.Battery
+	kiuas.Pressure = ruuviTag.Pressure
+	fmt.Printf("Received new temperature value: %.1f °C, Humidity: %.1f%%, Voltage: %d mV\n", kiuas.Temperature, kiuas.Humidity, kiuas.Battery)
+
+	kiuas.LastReadingTime = t
+	if t.After(kiuas.LastDataReceived) {
+		kiuas.LastDataReceived = t
+	}
+	kiuas.AddTemperatureRecord(kiuas.Temperature, t)
+	kiuas.AddSample(kiuas.Temperature, kiuas.Humidity, kiuas.Pressure, t)
+	if err := kiuas.History.Add(HistoryReading{Time: t, Temperature: kiuas.Temperature, Humidity: kiuas.Humidity}); err != nil {
+		log.Printf("Failed to save history: %v\n", err)
+	}
+}
+
+// Send the notifications and publish the state after the latest reading
+func checkReading(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, subs *Subscriptions, langs *Languages, now time.Time) {
+	checkAndNotify(b, ctx, kiuas, config, subs, langs, now)
+	checkEvents(b, ctx, kiuas, config, langs, now)
+	checkSafety(b, ctx, kiuas, config, langs, now)
+	checkBattery(b, ctx, kiuas, config, langs, now)
+
+	kiuas.MQTT.PublishReading(kiuas, now)
+	kiuas.MQTT.PublishState(saunaState(kiuas, config))
+}
+
+// Process the readings of the sauna tag in time order and return how many were used.
+// Readings of other tags are skipped, without ruuvi_tag_mac the sauna tag is the first tag
+// seen. So are readings timestamped in the future by a device with a wrong clock. Readings
+// not newer than the latest one, e.g. buffered by the proxy while a live reading got through,
+// are only merged into the history, which also drops the ones the proxy sends again if it did
+// not get the response. Readings older than backfillAge are only recorded, the notifications
+// would be stale by now.
+func processReadings(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, subs *Subscriptions, langs *Languages, readings []TagReading, now time.Time) int {
+	readings = slices.DeleteFunc(slices.Clone(readings), func(r TagReading) bool {
+		return config.RuuviTagMAC != "" && !strings.EqualFold(r.MAC, config.RuuviTagMAC)
+	})
+	for i := range readings {
+		if readings[i].Time.IsZero() {
+			readings[i].Time = now
+		}
+	}
+	slices.SortStableFunc(readings, func(a, b TagReading) int { return a.Time.Compare(b.Time) })
+
+	ingestMu.Lock()
+	defer ingestMu.Unlock()
+
+	processed := 0
+	for _, r := range readings {
+		if config.RuuviTagMAC == "" && r.MAC != "" {
+			if kiuas.TagMAC == "" {
+				kiuas.TagMAC = r.MAC
+			} else if !strings.EqualFold(r.MAC, kiuas.TagMAC) {
+				log.Printf("Ignoring reading of %s, the sauna tag is %s. Set ruuvi_tag_mac if that is wrong.\n", r.MAC, kiuas.TagMAC)
+				continue
+			}
+		}
+		if r.Time.After(now.Add(maxClockSkew)) {
+			log.Printf("Ignoring reading of %s from the future: %s\n", r.MAC, r.Time)
+			continue
+		}
+		if !r.Time.After(kiuas.LastReadingTime) {
+			if kiuas.History.Merge(HistoryReading{Time: r.Time, Temperature: r.Data.Temperature, Humidity: r.Data.Humidity}) {
+				processed++
+			}
+			continue
+		}
+		recordReading(kiuas, r.Data, r.Time)
+		if now.Sub(r.Time) <= backfillAge {
+			checkReading(b, ctx, kiuas, config, subs, langs, r.Time)
+		}
+		processed++
+	}
+	return processed
+}
+
+// Handle a message from the MQTT ingest topic, invalid payloads are dropped
+func handleMQTTReading(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, subs *Subscriptions, langs *Languages, topic string, payload []byte) {
+	reading, err := parseRuuviPayload(payload)
+	if err != nil {
+		log.Printf("Ignoring MQTT message on %s: %v\n", topic, err)
+		return
+	}
+	processReadings(b, ctx, kiuas, config, subs, langs, []TagReading{reading}, time.Now())
+}
+
+// ReadingBatch is the payload of the batch endpoint, the readings buffered by the proxy
+// while it could not reach the server
+type ReadingBatch struct {
+	Readings []struct {
+		Timestamp int64  `json:"ts"`   // Unix seconds when the tag was read, zero if unknown
+		Data      string `json:"data"` // manufacturer data or the whole advertisement in hex
+	} `json:"readings"`
+}
+
+// Read the body of an ingest request, decompressing it if needed. On failure the
+// error response has been written.
+func readIngestBody(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	defer r.Body.Close()
+	body, err := batch.NewReader(r.Body, r.Header.Get("Content-Encoding"), maxIngestBody)
+	if errors.Is(err, batch.ErrUnsupportedEncoding) {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return nil, false
+	} else if err != nil {
+		// A corrupt gzip header is a bad body, not an unsupported encoding
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	data, err := io.ReadAll(body)
+	if errors.Is(err, batch.ErrTooLarge) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, "Failed to read request body: "+err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return data, true
+}
+
+// Handle a batch of buffered readings, JSON or CBOR, responds with the number of readings used
+func handleReceiveBatch(w http.ResponseWriter, r *http.Request, b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, subs *Subscriptions, langs *Languages) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	body, ok := readIngestBody(w, r)
+	if !ok {
+		return
+	}
+	receiveBatch(w, r, body, b, ctx, kiuas, config, subs, langs)
+}
+
+func receiveBatch(w http.ResponseWriter, r *http.Request, body []byte, b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, subs *Subscriptions, langs *Languages) {
+	version, err := batch.ParseVersion(r.Header.Get(batch.VersionHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var entries []batch.Reading
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == batch.ContentType {
+		entries, err = batch.Decode(body, version)
+	} else {
+		entries, err = decodeJSONBatch(body)
+	}
+	if err != nil {
+		http.Error(w, "Invalid batch: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var readings []TagReading
+	for i, entry := range entries {
+		var timestamp int64
+		if !entry.Time.IsZero() {
+			timestamp = entry.Time.Unix()
+		}
+		reading, err := parseAdvertisement(entry.Data, timestamp)
+		if err != nil {
+			log.Printf("Ignoring reading %d of the batch: %v\n", i, err)
+			continue
+		}
+		readings = append(readings, reading)
+	}
+
+	processed := processReadings(b, ctx, kiuas, config, subs, langs, readings, time.Now())
+	fmt.Printf("Received a batch of %d readings, %d processed\n", len(entries), processed)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"received": len(entries), "processed": processed})
+}
+
+// Decode the JSON batch format. Readings with invalid hex are kept with empty data,
+// so that they are counted as received.
+func decodeJSONBatch(body []byte) ([]batch.Reading, error) {
+	var b ReadingBatch
+	if err := json.Unmarshal(body, &b); err != nil {
+		return nil, err
+	}
+	entries := make([]batch.Reading, len(b.Readings))
+	for i, entry := range b.Readings {
+		data, _ := hex.DecodeString(entry.Data)
+		entries[i].Data = data
+		if entry.Timestamp > 0 {
+			entries[i].Time = time.Unix(entry.Timestamp, 0)
+		}
+	}
+	return entries, nil
+}
+
+// Handle the JSON batch of a Ruuvi Gateway or Ruuvi Station posted to the ingest endpoint
+func handleGatewayBatch(w http.ResponseWriter, body []byte, b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, subs *Subscriptions, langs *Languages) {
+	readings, err := parseGatewayBatch(body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	// A gateway reports every tag it hears, mixing an outdoor or fridge tag into the sauna
+	// would trigger false alerts
+	if config.RuuviTagMAC == "" {
+		macs := make(map[string]bool)
+		for _, r := range readings {
+			macs[r.MAC] = true
+		}
+		if len(macs) > 1 {
+			log.Printf("Rejected a gateway batch of %d tags, ruuvi_tag_mac is not set\n", len(macs))
+			http.Error(w, fmt.Sprintf("The batch has readings of %d tags, set ruuvi_tag_mac to the MAC of the sauna tag", len(macs)), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+	processed := processReadings(b, ctx, kiuas, config, subs, langs, readings, time.Now())
+	fmt.Printf("Received %d tags from a gateway, %d readings processed\n", len(readings), processed)
+}
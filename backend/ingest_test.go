@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/peterhellberg/ruuvitag"
+
+	"bt-telegram/batch"
+)
+
+// Data format 5 example from the Ruuvi documentation: 24.3 °C, 53.49 %, 100044 Pa, 2977 mV
+const (
+	ruuviTestData          = "99040512FC5394C37C0004FFFC040CAC364200CDCBB8334C884F"
+	ruuviTestAdvertisement = "0201061BFF" + ruuviTestData
+)
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	t.Helper()
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// Advertisement of a tag with the given temperature and the last byte of the MAC
+func ruuviAdvertisement(temperature float64, mac byte) string {
+	data := make([]byte, 24)
+	data[0] = 5
+	binary.BigEndian.PutUint16(data[1:], uint16(int16(math.Round(temperature/0.005))))
+	binary.BigEndian.PutUint16(data[3:], 20000)             // 50 %
+	binary.BigEndian.PutUint16(data[5:], 51000)             // 101000 Pa
+	binary.BigEndian.PutUint16(data[13:], (2900-1600)<<5|4) // 2900 mV
+	copy(data[18:], []byte{0xCB, 0xB8, 0x33, 0x4C, 0x88, mac})
+	return "0201061BFF9904" + hex.EncodeToString(data)
+}
+
+func TestParseRuuviPayload(t *testing.T) {
+	valid := map[string][]byte{
+		"raw bytes":            mustDecodeHex(t, ruuviTestData),
+		"gateway":              []byte(`{"gw_mac":"AA:BB:CC:DD:EE:FF","rssi":-62,"ts":1735063200,"data":"` + ruuviTestAdvertisement + `"}`),
+		"manufacturer data":    []byte(`{"data":"` + ruuviTestData + `"}`),
+		"gateway with newline": []byte("\n{\"data\":\"" + ruuviTestAdvertisement + "\"}\n"),
+	}
+	for name, payload := range valid {
+		reading, err := parseRuuviPayload(payload)
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", name, err)
+			continue
+		}
+		if reading.MAC != "CB:B8:33:4C:88:4F" || reading.Data.Temperature != 24.3 || reading.Data.Pressure != 100044 || reading.Data.Battery != 2977 {
+			t.Errorf("%s: unexpected reading %+v", name, reading)
+		}
+	}
+
+	// Older gateway firmware quotes the timestamps, newer sends numbers
+	for _, payload := range []string{
+		`{"gw_mac":"A1:B2:C3:D4:E5:F6","rssi":-62,"aoa":[],"gwts":"1659365432","ts":"1659365222","data":"` + ruuviTestAdvertisement + `","coords":""}`,
+		`{"gw_mac":"A1:B2:C3:D4:E5:F6","rssi":-62,"aoa":[],"gwts":1659365432,"ts":1659365222,"data":"` + ruuviTestAdvertisement + `","coords":""}`,
+	} {
+		reading, err := parseRuuviPayload([]byte(payload))
+		if err != nil || reading.Time.Unix() != 1659365222 {
+			t.Errorf("Expected the gateway timestamp of %s, got %v, %v", payload, reading.Time, err)
+		}
+	}
+
+	invalid := map[string][]byte{
+		"bad timestamp":     []byte(`{"ts":"eilen","data":"` + ruuviTestAdvertisement + `"}`),
+		"empty":             nil,
+		"truncated":         mustDecodeHex(t, ruuviTestData[:20]),
+		"broken JSON":       []byte(`{"data":`),
+		"not hex":           []byte(`{"data":"sauna"}`),
+		"other manufacture": []byte(`{"data":"0201061BFF4C000512FC5394C37C0004FFFC040CAC364200CDCBB8334C884F"}`),
+		"bad length":        []byte(`{"data":"020106FFFF99040512"}`),
+	}
+	for name, payload := range invalid {
+		if _, err := parseRuuviPayload(payload); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestParseGatewayBatch(t *testing.T) {
+	gateway := `{"data": {
+		"gw_mac": "C8:25:2D:8E:9C:2C",
+		"timestamp": 1735063260,
+		"tags": {
+			"cb:b8:33:4c:88:4f": {"rssi": -62, "timestamp": 1735063200, "data": "` + ruuviTestAdvertisement + `"},
+			"CB:B8:33:4C:88:01": {"rssi": -80, "data": "` + ruuviAdvertisement(60, 0x01) + `"},
+			"CB:B8:33:4C:88:02": {"rssi": -90, "data": "0201061AFF4C00"}
+		}
+	}}`
+	readings, err := parseGatewayBatch([]byte(gateway))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	checkGateway := func(readings []TagReading) {
+		t.Helper()
+		slices.SortFunc(readings, func(a, b TagReading) int { return strings.Compare(a.MAC, b.MAC) })
+		if len(readings) != 2 {
+			t.Fatalf("Expected the tag with invalid data to be skipped, got %+v", readings)
+		}
+		if readings[0].MAC != "CB:B8:33:4C:88:01" || readings[0].Data.Temperature != 60 || readings[0].Time.Unix() != 1735063260 {
+			t.Errorf("Expected the gateway timestamp for a tag without one, got %+v", readings[0])
+		}
+		if readings[1].MAC != "CB:B8:33:4C:88:4F" || readings[1].Data.Temperature != 24.3 || readings[1].Time.Unix() != 1735063200 {
+			t.Errorf("Unexpected reading %+v", readings[1])
+		}
+	}
+	checkGateway(readings)
+
+	// Older gateway firmware quotes the timestamps
+	quoted := strings.NewReplacer(`"timestamp": 1735063260`, `"timestamp": "1735063260"`, `"timestamp": 1735063200`, `"timestamp": "1735063200"`).Replace(gateway)
+	readings, err = parseGatewayBatch([]byte(quoted))
+	if err != nil {
+		t.Fatalf("Unexpected error with quoted timestamps: %v", err)
+	}
+	checkGateway(readings)
+
+	station := `{
+		"deviceId": "puhelin",
+		"time": "2024-12-24T20:00:00+0200",
+		"tags": [
+			{"id": "CB:B8:33:4C:88:4F", "dataFormat": 5, "temperature": 71.5, "humidity": 12.25, "pressure": 100500.0, "voltage": 2.977, "updateAt": "2024-12-24T19:59:30+0200"},
+			{"id": "CB:B8:33:4C:88:03", "dataFormat": 3, "temperature": 20.0, "pressure": 1005.0, "updateAt": "2024-12-24T19:59:30+0200"}
+		]
+	}`
+	readings, err = parseGatewayBatch([]byte(station))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	want := TagReading{MAC: "CB:B8:33:4C:88:4F", Data: ruuvitag.RAWv2{DataFormat: 5, Temperature: 71.5, Humidity: 12.25, Pressure: 100500, Battery: 2977}, Time: time.Date(2024, 12, 24, 17, 59, 30, 0, time.UTC)}
+	if len(readings) != 1 || readings[0].MAC != want.MAC || readings[0].Data != want.Data || !readings[0].Time.Equal(want.Time) {
+		t.Errorf("Expected %+v, got %+v", want, readings)
+	}
+
+	for _, body := range []string{"", "[1, 2]", `{"data": "sauna"}`, `{"tags": [{"updateAt": "eilen"}]}`, `{"data": {"timestamp": "eilen"}}`} {
+		if _, err := parseGatewayBatch([]byte(body)); err == nil {
+			t.Errorf("Expected %q to be rejected", body)
+		}
+	}
+}
+
+func TestHandleReceiveBT_GatewayJSON(t *testing.T) {
+	now := time.Now()
+	body := fmt.Sprintf(`{"data": {"gw_mac": "C8:25:2D:8E:9C:2C", "timestamp": %d, "tags": {
+		"CB:B8:33:4C:88:4F": {"timestamp": %d, "data": "%s"},
+		"CB:B8:33:4C:88:01": {"timestamp": %d, "data": "%s"},
+		"CB:B8:33:4C:88:02": {"timestamp": %d, "data": "%s"}
+	}}}`, now.Unix(),
+		now.Unix(), ruuviAdvertisement(45, 0x4F),
+		now.Add(-time.Minute).Unix(), ruuviAdvertisement(40, 0x4F),
+		now.Add(time.Hour).Unix(), ruuviAdvertisement(99, 0x4F))
+
+	post := func(kiuas *Kiuas, config *Config, body string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/api/receive-bt", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json; charset=utf-8")
+		recorder := httptest.NewRecorder()
+		handleReceiveBT(recorder, request, &MockTelegramBot{}, context.Background(), kiuas, config, nil, nil)
+		return recorder
+	}
+
+	// Without ruuvi_tag_mac the batch of several tags is rejected instead of mixing them
+	kiuas := &Kiuas{}
+	config := &Config{ReadyThreshold: 70, ResetThreshold: 30, LowerBound: 0.01}
+	if recorder := post(kiuas, config, body); recorder.Code != http.StatusUnprocessableEntity || !strings.Contains(recorder.Body.String(), "ruuvi_tag_mac") {
+		t.Errorf("Expected 422 asking for ruuvi_tag_mac, got %d: %s", recorder.Code, recorder.Body)
+	}
+	if !kiuas.LastDataReceived.IsZero() {
+		t.Errorf("Expected no readings to be processed, got %v", kiuas.Temperature)
+	}
+
+	// Only the configured tag is used
+	for mac, want := range map[string]float64{"CB:B8:33:4C:88:4F": 45, "cb:b8:33:4c:88:01": 40} {
+		kiuas := &Kiuas{}
+		config.RuuviTagMAC = mac
+		if recorder := post(kiuas, config, body); recorder.Code != http.StatusOK {
+			t.Fatalf("Expected 200, got %d: %s", recorder.Code, recorder.Body)
+		}
+		if kiuas.Temperature != want {
+			t.Errorf("Expected the reading %v of %s, got %v", want, mac, kiuas.Temperature)
+		}
+	}
+
+	// The reading from the future is dropped
+	kiuas = &Kiuas{}
+	config.RuuviTagMAC = "CB:B8:33:4C:88:02"
+	post(kiuas, config, body)
+	if !kiuas.LastDataReceived.IsZero() {
+		t.Errorf("Expected the reading from the future to be dropped, got %v", kiuas.Temperature)
+	}
+
+	// A batch of a single tag needs no configuration
+	config.RuuviTagMAC = ""
+	single := fmt.Sprintf(`{"data": {"timestamp": %d, "tags": {"CB:B8:33:4C:88:4F": {"data": "%s"}}}}`, now.Unix(), ruuviAdvertisement(45, 0x4F))
+	if recorder := post(kiuas, config, single); recorder.Code != http.StatusOK || kiuas.Temperature != 45 {
+		t.Errorf("Expected the single tag to be used, got %d and %v", recorder.Code, kiuas.Temperature)
+	}
+
+	if recorder := post(kiuas, config, "{"); recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for invalid JSON, got %d", recorder.Code)
+	}
+}
+
+func TestHandleMQTTReading_SingleTag(t *testing.T) {
+	kiuas := &Kiuas{}
+	config := &Config{ReadyThreshold: 70, ResetThreshold: 30, LowerBound: 0.01}
+	start := time.Now().Add(-time.Minute)
+	send := func(age time.Duration, temperature float64, mac byte) {
+		payload := fmt.Sprintf(`{"ts": %d, "data": "%s"}`, start.Add(age).Unix(), ruuviAdvertisement(temperature, mac))
+		handleMQTTReading(&MockTelegramBot{}, context.Background(), kiuas, config, nil, nil, "ruuvi/gw", []byte(payload))
+	}
+
+	// Without ruuvi_tag_mac the first tag is the sauna and the others are ignored
+	send(0, 60, 0x4F)
+	send(10*time.Second, 5, 0x01)
+	if kiuas.Temperature != 60 || kiuas.TagMAC != "CB:B8:33:4C:88:4F" {
+		t.Errorf("Expected the second tag to be ignored, got %v from %s", kiuas.Temperature, kiuas.TagMAC)
+	}
+
+	config.RuuviTagMAC = "CB:B8:33:4C:88:01"
+	send(20*time.Second, 6, 0x01)
+	if kiuas.Temperature != 6 {
+		t.Errorf("Expected the configured tag to be used, got %v", kiuas.Temperature)
+	}
+}
+
+func postBatch(t *testing.T, kiuas *Kiuas, config *Config, mockBot *MockTelegramBot, body string) map[string]int {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	handleReceiveBatch(recorder, httptest.NewRequest(http.MethodPost, "/api/receive-bt/batch", strings.NewReader(body)), mockBot, context.Background(), kiuas, config, nil, nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", recorder.Code, recorder.Body)
+	}
+	var counts map[string]int
+	if err := json.Unmarshal(recorder.Body.Bytes(), &counts); err != nil {
+		t.Fatal(err)
+	}
+	return counts
+}
+
+func TestHandleReceiveBatch(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	kiuas := &Kiuas{LastReadingTime: now.Add(-time.Hour)}
+	config := &Config{ReadyThreshold: 75, WarmingThreshold: 30, LowerBound: 0.001, ResetThreshold: 40}
+	mockBot := &MockTelegramBot{}
+	entry := func(age time.Duration, temperature float64) string {
+		return fmt.Sprintf(`{"ts": %d, "data": "%s"}`, now.Add(-age).Unix(), ruuviAdvertisement(temperature, 0x4F))
+	}
+
+	// Readings buffered during an outage, out of order and one already received before it
+	counts := postBatch(t, kiuas, config, mockBot, `{"readings": [`+
+		entry(30*time.Minute, 50)+`, `+entry(40*time.Minute, 30)+`, `+entry(2*time.Hour, 20)+`, `+
+		entry(20*time.Minute, 76)+`, {"ts": 0, "data": "sauna"}]}`)
+
+	if counts["received"] != 5 || counts["processed"] != 3 {
+		t.Errorf("Expected 3 of 5 readings to be processed, got %v", counts)
+	}
+	if kiuas.TemperatureRecords != [3]float64{30, 50, 76} || !kiuas.TimestampRecords[2].Equal(now.Add(-20*time.Minute)) {
+		t.Errorf("Expected the rate model to get the readings in time order, got %v at %v", kiuas.TemperatureRecords, kiuas.TimestampRecords)
+	}
+	// The sauna was ready twenty minutes ago, telling it now would be stale
+	if len(mockBot.SentMessages) != 0 || kiuas.ReadyNotificationSent {
+		t.Errorf("Expected no notifications for backfilled readings, got %v", mockBot.SentMessages)
+	}
+
+	// The live reading after the backfill is notified as usual
+	counts = postBatch(t, kiuas, config, mockBot, `{"readings": [`+entry(20*time.Minute, 76)+`, `+entry(0, 78)+`]}`)
+	if counts["processed"] != 1 {
+		t.Errorf("Expected the resent reading to be skipped, got %v", counts)
+	}
+	if len(mockBot.SentMessages) != 1 || !kiuas.ReadyNotificationSent {
+		t.Errorf("Expected the ready notification, got %v", mockBot.SentMessages)
+	}
+
+	recorder := httptest.NewRecorder()
+	handleReceiveBatch(recorder, httptest.NewRequest(http.MethodPost, "/api/receive-bt/batch", strings.NewReader(`{"readings": {}}`)), mockBot, context.Background(), kiuas, config, nil, nil)
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an invalid batch, got %d", recorder.Code)
+	}
+}
+
+func TestHandleReceiveBatch_AfterNewerReading(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	config := &Config{ReadyThreshold: 75, WarmingThreshold: 30, LowerBound: 0.001, ResetThreshold: 40}
+	entry := func(age time.Duration, temperature float64) string {
+		return fmt.Sprintf(`{"ts": %d, "data": "%s"}`, now.Add(-age).Unix(), ruuviAdvertisement(temperature, 0x4F))
+	}
+	outage := `{"readings": [` + entry(30*time.Minute, 40) + `, ` + entry(20*time.Minute, 60) + `, ` + entry(10*time.Minute, 70) + `]}`
+	newKiuas := func() *Kiuas {
+		kiuas := &Kiuas{}
+		if err := kiuas.LoadHistory(&Config{DataDir: t.TempDir()}); err != nil {
+			t.Fatal(err)
+		}
+		return kiuas
+	}
+
+	// After a restart the bot has no readings yet, only the no data alert starts from now
+	kiuas := newKiuas()
+	kiuas.LastDataReceived = now
+	if counts := postBatch(t, kiuas, config, &MockTelegramBot{}, outage); counts["processed"] != 3 {
+		t.Errorf("Expected the readings of the outage to be processed after a restart, got %v", counts)
+	}
+	if len(kiuas.History.Readings) != 3 || kiuas.Temperature != 70 || !kiuas.LastDataReceived.Equal(now) {
+		t.Errorf("Expected the outage in the history without moving the last data time back, got %v", kiuas.History.Readings)
+	}
+
+	// A live reading got through before the proxy sent its buffer
+	kiuas = newKiuas()
+	processReading(&MockTelegramBot{}, context.Background(), kiuas, config, nil, nil, ruuvitag.RAWv2{Temperature: 72}, now)
+	if counts := postBatch(t, kiuas, config, &MockTelegramBot{}, outage); counts["processed"] != 3 {
+		t.Errorf("Expected the older readings to be merged into the history, got %v", counts)
+	}
+	var temperatures []float64
+	for _, r := range kiuas.History.Since(time.Time{}) {
+		temperatures = append(temperatures, r.Temperature)
+	}
+	if !slices.Equal(temperatures, []float64{40, 60, 70, 72}) || kiuas.Temperature != 72 || kiuas.TemperatureRecords[2] != 72 {
+		t.Errorf("Expected the history in time order and the live reading as the state, got %v and %v", temperatures, kiuas.TemperatureRecords)
+	}
+	// Sent again when the proxy did not get the response
+	if counts := postBatch(t, kiuas, config, &MockTelegramBot{}, outage); counts["processed"] != 0 {
+		t.Errorf("Expected the resent readings to be skipped, got %v", counts)
+	}
+}
+
+func TestHandleReceiveBT_CompactBatch(t *testing.T) {
+	post := func(handler http.HandlerFunc, body []byte, header map[string]string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/api/receive-bt", bytes.NewReader(body))
+		for name, value := range header {
+			request.Header.Set(name, value)
+		}
+		recorder := httptest.NewRecorder()
+		handler(recorder, request)
+		return recorder
+	}
+	config := &Config{ReadyThreshold: 70, ResetThreshold: 30, LowerBound: 0.01}
+	raw := mustDecodeHex(t, ruuviTestData)
+
+	// The current raw format is the reference
+	reference := &Kiuas{}
+	post(func(w http.ResponseWriter, r *http.Request) {
+		handleReceiveBT(w, r, &MockTelegramBot{}, context.Background(), reference, config, nil, nil)
+	}, raw, nil)
+
+	encoded, err := batch.Encode([]batch.Reading{{Time: time.Now(), Data: raw}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed, err := batch.Gzip(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressedRaw, err := batch.Gzip(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bomb, err := batch.Gzip(make([]byte, maxIngestBody+1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		name   string
+		batch  bool // posted to the batch endpoint
+		body   []byte
+		header map[string]string
+	}{
+		{"gzip raw", false, compressedRaw, map[string]string{"Content-Encoding": "gzip"}},
+		{"cbor", false, encoded, map[string]string{"Content-Type": batch.ContentType}},
+		{"gzip cbor", false, compressed, map[string]string{"Content-Type": batch.ContentType, "Content-Encoding": "gzip"}},
+		{"gzip cbor batch", true, compressed, map[string]string{"Content-Type": batch.ContentType, "Content-Encoding": "gzip", batch.VersionHeader: "1"}},
+	}
+	for _, tc := range cases {
+		kiuas := &Kiuas{}
+		recorder := post(func(w http.ResponseWriter, r *http.Request) {
+			if tc.batch {
+				handleReceiveBatch(w, r, &MockTelegramBot{}, context.Background(), kiuas, config, nil, nil)
+			} else {
+				handleReceiveBT(w, r, &MockTelegramBot{}, context.Background(), kiuas, config, nil, nil)
+			}
+		}, tc.body, tc.header)
+
+		if recorder.Code != http.StatusOK {
+			t.Errorf("%s: expected 200, got %d: %s", tc.name, recorder.Code, recorder.Body)
+			continue
+		}
+		if kiuas.Temperature != reference.Temperature || kiuas.Humidity != reference.Humidity || kiuas.Pressure != reference.Pressure || kiuas.Battery != reference.Battery {
+			t.Errorf("%s: expected the same reading as the raw format, got %+v", tc.name, kiuas)
+		}
+	}
+
+	rejected := []struct {
+		name   string
+		body   []byte
+		header map[string]string
+		code   int
+	}{
+		{"future version", encoded, map[string]string{"Content-Type": batch.ContentType, batch.VersionHeader: "2"}, http.StatusBadRequest},
+		{"broken cbor", raw, map[string]string{"Content-Type": batch.ContentType}, http.StatusBadRequest},
+		{"unknown encoding", encoded, map[string]string{"Content-Encoding": "br"}, http.StatusUnsupportedMediaType},
+		{"corrupt gzip", raw, map[string]string{"Content-Encoding": "gzip"}, http.StatusBadRequest},
+		{"truncated gzip", compressed[:len(compressed)-4], map[string]string{"Content-Encoding": "gzip"}, http.StatusBadRequest},
+		{"too large", make([]byte, maxIngestBody+1), nil, http.StatusRequestEntityTooLarge},
+		{"too large gzip", bomb, map[string]string{"Content-Encoding": "gzip"}, http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range rejected {
+		recorder := post(func(w http.ResponseWriter, r *http.Request) {
+			handleReceiveBT(w, r, &MockTelegramBot{}, context.Background(), &Kiuas{}, config, nil, nil)
+		}, tc.body, tc.header)
+		if recorder.Code != tc.code {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.code, recorder.Code)
+		}
+	}
+}
+
+func TestMQTTIngest(t *testing.T) {
+	broker := startMQTTBroker(t)
+	config := DefaultConfig()
+	config.MQTTBroker = broker
+	config.MQTTDiscoveryPrefix = ""
+	config.MQTTIngestTopic = "ruuvi/+/+"
+	config.DataDir = t.TempDir()
+
+	kiuas := &Kiuas{}
+	kiuas.MQTT = ConnectMQTT(config)
+	defer kiuas.MQTT.Close()
+	// Subscribing before the connection is up is renewed when it connects
+	kiuas.MQTT.Subscribe(config.MQTTIngestTopic, func(topic string, payload []byte) {
+		handleMQTTReading(&MockTelegramBot{}, context.Background(), kiuas, config, nil, nil, topic, payload)
+	})
+
+	client := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(broker).SetClientID("test-gateway"))
+	if token := client.Connect(); !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("Failed to connect: %v", token.Error())
+	}
+	defer client.Disconnect(0)
+	messages := subscribeMQTT(t, broker)
+
+	// The subscription is made asynchronously, keep publishing until the reading is processed
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		client.Publish("ruuvi/AA:BB:CC:DD:EE:FF/sauna", 1, false, "not a reading").Wait()
+		client.Publish("ruuvi/AA:BB:CC:DD:EE:FF/sauna", 1, false, `{"data":"`+ruuviTestAdvertisement+`"}`).Wait()
+		time.Sleep(20 * time.Millisecond)
+
+		ingestMu.Lock()
+		temperature := kiuas.Temperature
+		ingestMu.Unlock()
+		if temperature == 24.3 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the reading to be processed, temperature is %v", temperature)
+		}
+	}
+
+	// The reading goes through the same pipeline as the HTTP endpoint
+	ingestMu.Lock()
+	if kiuas.LastDataReceived.IsZero() || kiuas.Battery != 2977 || len(kiuas.Samples) == 0 {
+		t.Errorf("Expected the reading to be recorded, got %+v", kiuas)
+	}
+	ingestMu.Unlock()
+	waitMQTT(t, messages, "saunatonttu/reading", "saunatonttu/state")
+}
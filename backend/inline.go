@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// How long Telegram may cache the inline results, in seconds
+const inlineCacheTime = 30
+
+// Text of /kiuas and the status inline result
+func statusText(kiuas *Kiuas, config *Config, reservations *Reservations, locale Locale, now time.Time) string {
+	text := locale.T("status", GetSaunaStatus(kiuas.IsOn(config), locale), kiuas.Temperature, kiuas.Humidity)
+	if res, ok := reservations.Current(now); ok {
+		text += locale.T("status_reservation", res.Start.Format("15:04"), res.End.Format("15:04"), res.Name)
+	}
+	return text
+}
+
+func etaText(kiuas *Kiuas, locale Locale) string {
+	switch {
+	case kiuas.ReadyNotificationSent:
+		return locale.T("eta_ready", kiuas.Temperature)
+	case kiuas.WarmingNotificationSent && !kiuas.EstimatedReadyTime.IsZero():
+		return locale.T("eta_warming", kiuas.EstimatedReadyTime.Format("15:04"), kiuas.Temperature)
+	case kiuas.WarmingNotificationSent:
+		return locale.T("eta_no_estimate", kiuas.Temperature)
+	}
+	return locale.T("eta_off")
+}
+
+// Today's finished and ongoing sessions and reservations. Reservations are shown
+// without names because anyone can use the bot in inline mode.
+func todayText(kiuas *Kiuas, reservations *Reservations, locale Locale, now time.Time) string {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	tomorrow := today.AddDate(0, 0, 1)
+
+	var lines []string
+	for _, session := range kiuas.SessionsSnapshot() {
+		if session.End.Before(today) {
+			continue
+		}
+		lines = append(lines, locale.T("today_session", session.Start.Format("15:04"), session.End.Format("15:04"), session.MaxTemperature))
+	}
+	if kiuas.WarmingNotificationSent || kiuas.ReadyNotificationSent {
+		start := kiuas.WarmingStartTime
+		if start.IsZero() {
+			start = kiuas.ReadyTime
+		}
+		lines = append(lines, locale.T("today_now", start.Format("15:04")))
+	}
+	for _, res := range reservations.Upcoming(today) {
+		if res.Start.Before(tomorrow) {
+			lines = append(lines, locale.T("today_reserved", res.Start.Format("15:04"), res.End.Format("15:04")))
+		}
+	}
+
+	if len(lines) == 0 {
+		return locale.T("today_none")
+	}
+	return locale.T("today", strings.Join(lines, "\n"))
+}
+
+func inlineArticle(id, title, text string) *models.InlineQueryResultArticle {
+	return &models.InlineQueryResultArticle{
+		ID:                  id,
+		Title:               title,
+		Description:         strings.SplitN(text, "\n", 2)[0],
+		InputMessageContent: &models.InputTextMessageContent{MessageText: text},
+	}
+}
+
+// Answer an inline query (@bot in any chat) with the status, the estimated ready time and today's sessions
+// in the language chosen by the user
+func handleInlineQuery(ctx context.Context, b TelegramBot, kiuas *Kiuas, config *Config, reservations *Reservations, langs *Languages, update *models.Update, now time.Time) {
+	var userID int64
+	if update.InlineQuery.From != nil {
+		userID = update.InlineQuery.From.ID
+	}
+	locale := langs.For(config, userID)
+	err := b.AnswerInlineQuery(ctx, &bot.AnswerInlineQueryParams{
+		InlineQueryID: update.InlineQuery.ID,
+		Results: []models.InlineQueryResult{
+			// Without reservations the status does not show the name of the current reservation
+			inlineArticle("status", locale.T("inline_status"), statusText(kiuas, config, nil, locale, now)),
+			inlineArticle("eta", locale.T("inline_eta"), etaText(kiuas, locale)),
+			inlineArticle("today", locale.T("inline_today"), todayText(kiuas, reservations, locale, now)),
+		},
+		CacheTime: inlineCacheTime,
+	})
+	if err != nil {
+		fmt.Printf("Failed to answer inline query: %v\n", err)
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+)
+
+func TestEtaText(t *testing.T) {
+	kiuas := &Kiuas{Temperature: 55}
+	if got := etaText(kiuas, LocaleFi); got != "Sauna ei ole päällä." {
+		t.Errorf("Unexpected text when off: %q", got)
+	}
+	kiuas.WarmingNotificationSent = true
+	kiuas.EstimatedReadyTime = time.Date(2024, 12, 24, 18, 30, 0, 0, time.UTC)
+	if got := etaText(kiuas, LocaleFi); !strings.Contains(got, "klo 18:30") {
+		t.Errorf("Expected the estimated ready time, got %q", got)
+	}
+	kiuas.ReadyNotificationSent = true
+	if got := etaText(kiuas, LocaleFi); !strings.HasPrefix(got, "Sauna on valmis") {
+		t.Errorf("Expected ready text, got %q", got)
+	}
+}
+
+func TestTodayText(t *testing.T) {
+	now := time.Date(2024, 12, 24, 20, 0, 0, 0, time.UTC)
+	kiuas := &Kiuas{
+		Sessions: []SessionRecord{
+			{Start: now.Add(-30 * time.Hour), End: now.Add(-27 * time.Hour), MaxTemperature: 80},
+			{Start: now.Add(-6 * time.Hour), End: now.Add(-4 * time.Hour), MaxTemperature: 85.5},
+		},
+		ReadyNotificationSent: true,
+		WarmingStartTime:      now.Add(-time.Hour),
+	}
+	reservations := &Reservations{Reservations: []Reservation{
+		{ID: 1, Name: "@tonttu", Start: now.Add(time.Hour), End: now.Add(2 * time.Hour)},
+		{ID: 2, Name: "@huomenna", Start: now.Add(20 * time.Hour), End: now.Add(21 * time.Hour)},
+	}}
+
+	expected := "Tänään saunassa:\n14:00-16:00 lämmitetty, korkein 85.5 °C\n19:00- päällä nyt\n21:00-22:00 varattu"
+	if got := todayText(kiuas, reservations, LocaleFi, now); got != expected {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+	if got := todayText(&Kiuas{}, &Reservations{}, LocaleFi, now); got != "Tänään ei ole vielä saunottu." {
+		t.Errorf("Unexpected text without sessions: %q", got)
+	}
+}
+
+func TestHandleInlineQuery(t *testing.T) {
+	now := time.Date(2024, 12, 24, 20, 0, 0, 0, time.UTC)
+	kiuas := &Kiuas{Temperature: 80, ReadyNotificationSent: true}
+	config := &Config{ReadyThreshold: 70}
+	reservations := &Reservations{Reservations: []Reservation{
+		{ID: 1, Name: "@tonttu", Start: now.Add(-time.Hour), End: now.Add(time.Hour)},
+	}}
+	mockBot := &MockTelegramBot{}
+
+	handleInlineQuery(context.Background(), mockBot, kiuas, config, reservations, nil, &models.Update{InlineQuery: &models.InlineQuery{ID: "q"}}, now)
+	if len(mockBot.InlineAnswers) != 1 {
+		t.Fatalf("Expected the inline query to be answered")
+	}
+	answer := mockBot.InlineAnswers[0]
+	if answer.InlineQueryID != "q" || len(answer.Results) != 3 {
+		t.Fatalf("Expected three results, got %+v", answer)
+	}
+	status := answer.Results[0].(*models.InlineQueryResultArticle)
+	text := status.InputMessageContent.(*models.InputTextMessageContent).MessageText
+	if !strings.HasPrefix(text, "Sauna on päällä") || strings.Contains(text, "@tonttu") {
+		t.Errorf("Expected status without reservation names, got %q", text)
+	}
+}
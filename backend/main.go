@@ -3,33 +3,61 @@ package main
 import (
 	"context"
 	"fmt"
-	"io"
 	"log"
+	"mime"
 	"net/http"
 	"os"
 	"os/signal"
-	"strconv"
+	"sync"
 	"time"
-	"strings"
 
 	"github.com/go-telegram/bot"
 	"github.com/go-telegram/bot/models"
 	"github.com/joho/godotenv"
 	"github.com/peterhellberg/ruuvitag"
+
+	"bt-telegram/batch"
+	"bt-telegram/format"
 )
 
 import _ "time/tzdata"
 
 type Kiuas struct {
-	Temperature             float64
-	Humidity                float64
-	Battery                 uint16
-	WarmingNotificationSent bool
-	ReadyNotificationSent   bool
-	LastDataReceived        time.Time
-	TemperatureRecords      [3]float64
-	TimestampRecords        [3]time.Time
-	WarmingStartTime        [3]time.Time
+	Temperature              float64
+	Humidity                 float64
+	Battery                  uint16
+	WarmingNotificationSent  bool
+	ReadyNotificationSent    bool
+	LastDataReceived         time.Time
+	LastReadingTime          time.Time // when the latest reading was taken, readings up to it are only merged into the history
+	TemperatureRecords       [3]float64
+	TimestampRecords         [3]time.Time
+	WarmingStartTime         time.Time
+	Pressure                 uint32
+	Samples                  []Sample
+	LoylyCount               int
+	LastLoylyTime            time.Time
+	DoorOpenNotificationSent bool
+	ReadyTime                time.Time
+	SessionAlertCount        int
+	LastSessionAlert         time.Time
+	LastReadingChange        time.Time
+	SafetyAlerts             map[SafetyAlert]*SafetyAlertState
+	BatteryHistory           []BatteryReading
+	BatteryLowAlertSent      bool
+	LastBatteryReminder      time.Time
+	NoDataAlertSent          bool
+	NoDataEscalated          bool
+	NoDataSince              time.Time
+	SessionMaxTemperature    float64
+	Sessions                 []SessionRecord
+	sessionsMu               sync.RWMutex // Sessions are also read by the HTTP and bot handlers
+	RSVP                     *RSVP
+	EstimatedReadyTime       time.Time
+	History                  *History
+	Webhooks                 *WebhookLog
+	MQTT                     *MQTTPublisher
+	TagMAC                   string // the sauna tag when ruuvi_tag_mac is not set, the first tag seen
 }
 
 func (k *Kiuas) IsOn(config *Config) bool {
@@ -69,7 +97,8 @@ func (k *Kiuas) tempChangeRate() float64 {
 func (k *Kiuas) IsWarming(config *Config) bool {
 	tempChangeRate := k.tempChangeRate()
 
-	return tempChangeRate > 0 && tempChangeRate >= config.LowerBound && k.Temperature < config.ReadyThreshold
+	return tempChangeRate > 0 && tempChangeRate >= config.LowerBound &&
+		k.Temperature >= config.WarmingThreshold && k.Temperature < config.ReadyThreshold
 
 }
 
@@ -94,16 +123,21 @@ func (k *Kiuas) AddTemperatureRecord(newTemp float64, newTime time.Time) {
 	k.TimestampRecords[2] = newTime
 }
 
-func GetSaunaStatus(isOn bool) string {
+func GetSaunaStatus(isOn bool, locale Locale) string {
 	if isOn {
-		return "päällä"
+		return locale.T("status_on")
 	}
-	return "pois päältä"
+	return locale.T("status_off")
 }
 
 func (k *Kiuas) ResetNotifications() {
 	k.WarmingNotificationSent = false
 	k.ReadyNotificationSent = false
+	k.DoorOpenNotificationSent = false
+	k.LoylyCount = 0
+	k.ReadyTime = time.Time{}
+	k.SessionAlertCount = 0
+	k.LastSessionAlert = time.Time{}
 }
 
 type TelegramBot interface {
@@ -111,6 +145,10 @@ type TelegramBot interface {
 	RegisterHandler(handlerType bot.HandlerType, pattern string, matchType bot.MatchType, handler bot.HandlerFunc)
 	Start(ctx context.Context)
 	SetMyCommands(ctx context.Context, params *bot.SetMyCommandsParams) error
+	EditMessageText(ctx context.Context, params *bot.EditMessageTextParams) (*models.Message, error)
+	AnswerCallbackQuery(ctx context.Context, params *bot.AnswerCallbackQueryParams) error
+	SendPhoto(ctx context.Context, params *bot.SendPhotoParams) (*models.Message, error)
+	AnswerInlineQuery(ctx context.Context, params *bot.AnswerInlineQueryParams) error
 }
 
 type BotWrapper struct {
@@ -134,65 +172,127 @@ func (b *BotWrapper) SetMyCommands(ctx context.Context, params *bot.SetMyCommand
 	return err
 }
 
-type Config struct {
-	ReadyThreshold     float64
-	ChangeThreshold    float64
-	LowerBound         float64
-	ResetThreshold     float64
-	MaintenanceChatID  int64
-	NotificationChatID int64
-	ServerPort         string
-	TelegramBotToken   string
+func (b *BotWrapper) EditMessageText(ctx context.Context, params *bot.EditMessageTextParams) (*models.Message, error) {
+	return b.Bot.EditMessageText(ctx, params)
+}
+
+func (b *BotWrapper) AnswerCallbackQuery(ctx context.Context, params *bot.AnswerCallbackQueryParams) error {
+	_, err := b.Bot.AnswerCallbackQuery(ctx, params)
+	return err
+}
+
+func (b *BotWrapper) SendPhoto(ctx context.Context, params *bot.SendPhotoParams) (*models.Message, error) {
+	return b.Bot.SendPhoto(ctx, params)
+}
+
+func (b *BotWrapper) AnswerInlineQuery(ctx context.Context, params *bot.AnswerInlineQueryParams) error {
+	_, err := b.Bot.AnswerInlineQuery(ctx, params)
+	return err
 }
 
-func InitializeTelegramBot(ctx context.Context, token string, kiuas *Kiuas, config *Config) (TelegramBot, error) {
-	opts := []bot.Option{}
+func InitializeTelegramBot(ctx context.Context, token string, kiuas *Kiuas, configs *ConfigStore, auth *Authorizer, subs *Subscriptions, reservations *Reservations, calendarTokens *CalendarTokens, langs *Languages) (TelegramBot, error) {
+	var botWrapper *BotWrapper
+
+	opts := []bot.Option{
+		// Handlers can only be registered for messages and callback queries, inline queries end up here
+		bot.WithDefaultHandler(func(ctx context.Context, _ *bot.Bot, update *models.Update) {
+			if update.InlineQuery != nil {
+				handleInlineQuery(ctx, botWrapper, kiuas, configs.Load(), reservations, langs, update, time.Now())
+			}
+		}),
+	}
 
 	botInstance, err := bot.New(token, opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	botWrapper := &BotWrapper{Bot: botInstance}
+	botWrapper = &BotWrapper{Bot: botInstance}
 
 	botWrapper.RegisterHandler(bot.HandlerTypeMessageText, "/kiuas", bot.MatchTypePrefix, func(ctx context.Context, _ *bot.Bot, update *models.Update) {
+		config := configs.Load()
 		_, err := botWrapper.SendMessage(ctx, &bot.SendMessageParams{
 			ChatID: update.Message.Chat.ID,
-			Text:   fmt.Sprintf("Sauna on %s\nLämpötila: %.1f °C\nKosteus: %.1f%%", GetSaunaStatus(kiuas.IsOn(config)), kiuas.Temperature, kiuas.Humidity),
+			Text:   statusText(kiuas, config, reservations, langs.For(config, update.Message.Chat.ID), time.Now()),
 		})
 		if err != nil {
 			fmt.Printf("Failed to send message: %v\n", err)
 		}
 	})
 
-	botWrapper.RegisterHandler(bot.HandlerTypeMessageText, "/info", bot.MatchTypePrefix, func(ctx context.Context, _ *bot.Bot, update *models.Update) {
-		if update.Message.Chat.ID == config.MaintenanceChatID {
-			loc, err := time.LoadLocation("Europe/Bucharest")
-			if err != nil {
-				fmt.Printf("Error loading location: %v", err)
-			}
-			_, err = botWrapper.SendMessage(ctx, &bot.SendMessageParams{
-				ChatID: update.Message.Chat.ID,
-				Text: fmt.Sprintf(
-					"Sauna Info:\nTemperature: %.1f °C\nHumidity: %.1f%%\nBattery: %d V\nLast Data Received: %s",
-					kiuas.Temperature,
-					kiuas.Humidity,
-					kiuas.Battery,
-					kiuas.LastDataReceived.In(loc))})
-			if err != nil {
-				fmt.Printf("Failed to send message: %v\n", err)
-			}
+	botWrapper.RegisterHandler(bot.HandlerTypeMessageText, "/info", bot.MatchTypePrefix, RequireRole(auth, RoleMaintainer, func(ctx context.Context, _ *bot.Bot, update *models.Update) {
+		loc, err := time.LoadLocation("Europe/Bucharest")
+		if err != nil {
+			fmt.Printf("Error loading location: %v", err)
 		}
-	})
+		config := configs.Load()
+		locale := langs.For(config, update.Message.Chat.ID)
+		_, err = botWrapper.SendMessage(ctx, &bot.SendMessageParams{
+			ChatID: update.Message.Chat.ID,
+			Text: locale.T(
+				"info",
+				kiuas.Temperature,
+				kiuas.Humidity,
+				kiuas.BatteryStatus(config),
+				kiuas.LastDataReceived.In(loc)) + kiuas.Webhooks.summary(locale, loc)})
+		if err != nil {
+			fmt.Printf("Failed to send message: %v\n", err)
+		}
+	}))
+
+	// Both /aseta and /asetukset match the prefix, handlers are not matched in a fixed order
+	botWrapper.RegisterHandler(bot.HandlerTypeMessageText, "/aseta", bot.MatchTypePrefix, RequireRole(auth, RoleAdmin, func(ctx context.Context, _ *bot.Bot, update *models.Update) {
+		switch commandName(update.Message.Text) {
+		case "/aseta":
+			handleSetCommand(ctx, botWrapper, configs, langs, update)
+		case "/asetukset":
+			handleSettingsCommand(ctx, botWrapper, configs.Load(), langs, update)
+		}
+	}))
+
+	botWrapper.RegisterHandler(bot.HandlerTypeMessageText, "/roolit", bot.MatchTypePrefix, RequireRole(auth, RoleAdmin, func(ctx context.Context, _ *bot.Bot, update *models.Update) {
+		handleRolesCommand(ctx, botWrapper, configs.Load(), auth, langs, update)
+	}))
+
+	botWrapper.RegisterHandler(bot.HandlerTypeMessageText, "/tilaa", bot.MatchTypePrefix, RequireRole(auth, RoleMember, func(ctx context.Context, _ *bot.Bot, update *models.Update) {
+		handleSubscribeCommand(ctx, botWrapper, configs.Load(), subs, langs, update)
+	}))
+
+	// Both /peru and /peruvaraus match the prefix
+	botWrapper.RegisterHandler(bot.HandlerTypeMessageText, "/peru", bot.MatchTypePrefix, RequireRole(auth, RoleMember, func(ctx context.Context, _ *bot.Bot, update *models.Update) {
+		switch commandName(update.Message.Text) {
+		case "/peru":
+			handleUnsubscribeCommand(ctx, botWrapper, configs.Load(), subs, langs, update)
+		case "/peruvaraus":
+			handleCancelReservationCommand(ctx, botWrapper, configs.Load(), auth, reservations, langs, update)
+		}
+	}))
 
-	err = botWrapper.SetMyCommands(ctx, &bot.SetMyCommandsParams{
-		Commands: []models.BotCommand{
-			{
-				Command:     "kiuas",
-				Description: "Näytä saunan tila",
-			},
-		},
-	})
+	botWrapper.RegisterHandler(bot.HandlerTypeMessageText, "/varaa", bot.MatchTypePrefix, RequireRole(auth, RoleMember, func(ctx context.Context, _ *bot.Bot, update *models.Update) {
+		handleReserveCommand(ctx, botWrapper, configs.Load(), reservations, langs, update, time.Now())
+	}))
+
+	botWrapper.RegisterHandler(bot.HandlerTypeMessageText, "/varaukset", bot.MatchTypePrefix, RequireRole(auth, RoleMember, func(ctx context.Context, _ *bot.Bot, update *models.Update) {
+		handleReservationsCommand(ctx, botWrapper, configs.Load(), reservations, langs, update, time.Now())
+	}))
+
+	botWrapper.RegisterHandler(bot.HandlerTypeMessageText, "/kalenteri", bot.MatchTypePrefix, RequireRole(auth, RoleMember, func(ctx context.Context, _ *bot.Bot, update *models.Update) {
+		handleCalendarCommand(ctx, botWrapper, configs.Load(), calendarTokens, langs, update)
+	}))
+
+	botWrapper.RegisterHandler(bot.HandlerTypeMessageText, "/graafi", bot.MatchTypePrefix, RequireRole(auth, RoleMember, func(ctx context.Context, _ *bot.Bot, update *models.Update) {
+		handleChartCommand(ctx, botWrapper, kiuas, configs.Load(), langs, update, time.Now())
+	}))
+
+	botWrapper.RegisterHandler(bot.HandlerTypeMessageText, "/kieli", bot.MatchTypePrefix, RequireRole(auth, RoleMember, func(ctx context.Context, _ *bot.Bot, update *models.Update) {
+		handleLanguageCommand(ctx, botWrapper, configs.Load(), auth, langs, update)
+	}))
+
+	botWrapper.RegisterHandler(bot.HandlerTypeCallbackQueryData, rsvpCallbackPrefix, bot.MatchTypePrefix, RequireRole(auth, RoleMember, func(ctx context.Context, _ *bot.Bot, update *models.Update) {
+		handleRSVPCallback(ctx, botWrapper, kiuas, configs.Load(), langs, update)
+	}))
+
+	err = setBotCommands(ctx, botWrapper, configs.Load())
 	if err != nil {
 		return nil, err
 	}
@@ -200,12 +300,17 @@ func InitializeTelegramBot(ctx context.Context, token string, kiuas *Kiuas, conf
 	return botWrapper, nil
 }
 
-func FmtTelegram(input string) string {
-	return strings.NewReplacer(
-	  ".", "\\.",
-	).Replace(input)
-  }
+// Parse mode of the notifications, MarkdownV2 unless HTML is configured
+func (c *Config) parseMode() format.Mode {
+	mode, err := format.ParseMode(c.ParseMode)
+	if err != nil {
+		return format.MarkdownV2
+	}
+	return mode
+}
 
+// Send a message rendered with Locale.Format, to the notification chat by default.
+// The message goes through the outbox when b is one.
 func SendTelegramMessage(b TelegramBot, ctx context.Context, config *Config, message string, chatID ...int64) {
 	var targetChatID int64
 
@@ -215,16 +320,21 @@ func SendTelegramMessage(b TelegramBot, ctx context.Context, config *Config, mes
 		targetChatID = config.NotificationChatID
 	}
 
-	_, err := b.SendMessage(ctx, &bot.SendMessageParams{
+	_, err := sendOrQueue(b, ctx, &OutboxMessage{
 		ChatID:    targetChatID,
-		Text:      FmtTelegram(message),
-		ParseMode: "MarkdownV2",
+		Text:      message,
+		ParseMode: models.ParseMode(config.parseMode()),
 	})
 	if err != nil {
 		fmt.Printf("Failed to send message: %v\n", err)
 	}
 }
 
+// Send the message with the given key to a chat in the language of the chat
+func sendLocalized(b TelegramBot, ctx context.Context, config *Config, langs *Languages, chatID int64, key string, args ...any) {
+	SendTelegramMessage(b, ctx, config, langs.For(config, chatID).Format(config.parseMode(), key, args...), chatID)
+}
+
 func main() {
 	os.Setenv("TZ", "Europe/Bucharest")
 
@@ -236,116 +346,152 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
 	defer cancel()
 
-	botToken := os.Getenv("TELEGRAM_BOT_TOKEN")
-	if botToken == "" {
-		log.Fatalf("TELEGRAM_BOT_TOKEN is not set in the environment")
+	configPath := os.Getenv("CONFIG_FILE")
+	if configPath == "" {
+		configPath = "config.yaml"
 	}
 
-	readyThreshold, err := strconv.ParseFloat(os.Getenv("SAUNA_READY_THRESHOLD"), 64)
+	config, err := LoadConfig(configPath)
 	if err != nil {
-		log.Fatalf("Error parsing SAUNA_READY_THRESHOLD: %v", err)
+		log.Fatalf("Error loading config: %v", err)
 	}
 
-	maintenanceChatID, err := strconv.ParseInt(os.Getenv("MAINTENANCE_CHAT_ID"), 10, 64)
+	// Goroutines take a snapshot of the config with configs.Load, reloads replace it
+	configs := NewConfigStore(config)
+	go watchConfig(ctx, configPath, configs)
+
+	auth, err := LoadAuthorizer(configs)
 	if err != nil {
-		log.Fatalf("Error parsing MAINTENANCE_CHAT_ID: %v", err)
+		log.Fatalf("Error loading roles: %v", err)
 	}
 
-	notificationChatID, err := strconv.ParseInt(os.Getenv("NOTIFICATION_CHAT_ID"), 10, 64)
+	subs, err := LoadSubscriptions(config)
 	if err != nil {
-		log.Fatalf("Error parsing NOTIFICATION_CHAT_ID: %v", err)
+		log.Fatalf("Error loading subscriptions: %v", err)
 	}
 
-	port := os.Getenv("SERVER_PORT")
-	if port == "" {
-		port = "1337"
+	reservations, err := LoadReservations(config)
+	if err != nil {
+		log.Fatalf("Error loading reservations: %v", err)
 	}
 
-	config := &Config{
-		ReadyThreshold:     readyThreshold,
-		ChangeThreshold:    0.0123,
-		LowerBound:         0.0123 * 0.9,
-		ResetThreshold:     40.0,
-		MaintenanceChatID:  maintenanceChatID,
-		NotificationChatID: notificationChatID,
-		ServerPort:         port,
-		TelegramBotToken:   botToken,
+	calendarTokens, err := LoadCalendarTokens(config)
+	if err != nil {
+		log.Fatalf("Error loading calendar tokens: %v", err)
+	}
+
+	langs, err := LoadLanguages(config)
+	if err != nil {
+		log.Fatalf("Error loading languages: %v", err)
 	}
 
 	kiuas := &Kiuas{
 		TemperatureRecords: [3]float64{0.0, 0.0, 0.0},
 		TimestampRecords:   [3]time.Time{time.Now(), time.Now(), time.Now()},
+		LastDataReceived:   time.Now(),
+		Webhooks:           &WebhookLog{},
+		MQTT:               ConnectMQTT(config),
+	}
+	if err := kiuas.LoadSessions(config); err != nil {
+		log.Fatalf("Error loading sessions: %v", err)
+	}
+	if err := kiuas.LoadHistory(config); err != nil {
+		log.Fatalf("Error loading history: %v", err)
+	}
+	if err := kiuas.LoadBatteryHistory(config); err != nil {
+		log.Fatalf("Error loading battery history: %v", err)
 	}
 
-	botInstance, err := InitializeTelegramBot(ctx, botToken, kiuas, config)
+	botInstance, err := InitializeTelegramBot(ctx, config.TelegramBotToken, kiuas, configs, auth, subs, reservations, calendarTokens, langs)
 	if err != nil {
 		log.Fatalf("Failed to initialize Telegram bot: %v", err)
 	}
 
 	go botInstance.Start(ctx)
 
-	go startHTTPServer(botInstance, ctx, kiuas, config)
+	// Notifications are sent through the outbox, replies to commands go directly to the bot
+	outbox, err := LoadOutbox(botInstance, config)
+	if err != nil {
+		log.Fatalf("Error loading outbox: %v", err)
+	}
+	go outbox.Run(ctx)
+
+	if config.MQTTIngestTopic != "" {
+		kiuas.MQTT.Subscribe(config.MQTTIngestTopic, func(topic string, payload []byte) {
+			handleMQTTReading(outbox, ctx, kiuas, configs.Load(), subs, langs, topic, payload)
+		})
+	}
+
+	go startHTTPServer(outbox, ctx, kiuas, configs, auth, subs, reservations, calendarTokens, langs)
 
-	go monitorDataReception(botInstance, ctx, kiuas, config)
+	go monitorDataReception(outbox, ctx, kiuas, configs, langs)
+
+	go monitorReservations(outbox, ctx, configs, langs, reservations)
 
 	<-ctx.Done()
 	fmt.Println("Shutting down...")
+	background.Wait()
+	kiuas.MQTT.Close()
+	if err := kiuas.History.Save(); err != nil {
+		log.Printf("Failed to save history: %v\n", err)
+	}
 }
 
-func startHTTPServer(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config) {
+func startHTTPServer(b TelegramBot, ctx context.Context, kiuas *Kiuas, configs *ConfigStore, auth *Authorizer, subs *Subscriptions, reservations *Reservations, calendarTokens *CalendarTokens, langs *Languages) {
 	http.HandleFunc("/api/receive-bt", func(w http.ResponseWriter, r *http.Request) {
-		handleReceiveBT(w, r, b, ctx, kiuas, config)
+		handleReceiveBT(w, r, b, ctx, kiuas, configs.Load(), subs, langs)
 	})
 
-	if err := http.ListenAndServe(":"+config.ServerPort, nil); err != nil {
+	http.HandleFunc("/api/receive-bt/batch", func(w http.ResponseWriter, r *http.Request) {
+		handleReceiveBatch(w, r, b, ctx, kiuas, configs.Load(), subs, langs)
+	})
+
+	http.HandleFunc("/api/calendar.ics", func(w http.ResponseWriter, r *http.Request) {
+		handleCalendar(w, r, kiuas, configs.Load(), auth, reservations, calendarTokens)
+	})
+
+	if err := http.ListenAndServe(":"+configs.Load().ServerPort, nil); err != nil {
 		log.Fatalf("Failed to start HTTP server: %v", err)
 	}
 }
 
-func handleReceiveBT(w http.ResponseWriter, r *http.Request, b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config) {
+func handleReceiveBT(w http.ResponseWriter, r *http.Request, b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, subs *Subscriptions, langs *Languages) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	body, err := io.ReadAll(r.Body)
-	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+	body, ok := readIngestBody(w, r)
+	if !ok {
+		return
+	}
+
+	// Gateways post JSON, our own proxy the raw manufacturer data or a compact batch
+	switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+	case "application/json":
+		handleGatewayBatch(w, body, b, ctx, kiuas, config, subs, langs)
+		return
+	case batch.ContentType:
+		receiveBatch(w, r, body, b, ctx, kiuas, config, subs, langs)
 		return
 	}
-	defer r.Body.Close()
 
 	ruuviTag, err := ruuvitag.ParseRAWv2(body)
 	if err != nil {
 		fmt.Println("Failed to parse RuuviTag data. Are all the sensors enabled?", err)
 	}
 
-	kiuas.Temperature = ruuviTag.Temperature
-	kiuas.Humidity = ruuviTag.Humidity
-	kiuas.Battery = ruuviTag.Battery
-	fmt.Printf("Received new temperature value: %.1f °C, Humidity: %.1f%%, Voltage: %d V\n", kiuas.Temperature, kiuas.Humidity, kiuas.Battery)
-
-	kiuas.LastDataReceived = time.Now()
-	kiuas.AddTemperatureRecord(kiuas.Temperature, time.Now())
-
-	checkAndNotify(b, ctx, kiuas, config, time.Now())
+	processReading(b, ctx, kiuas, config, subs, langs, ruuviTag, time.Now())
 }
 
-func monitorDataReception(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config) {
-	ticker := time.NewTicker(1 * time.Minute)
+func monitorDataReception(b TelegramBot, ctx context.Context, kiuas *Kiuas, configs *ConfigStore, langs *Languages) {
+	ticker := time.NewTicker(configs.Load().NoDataCheckInterval)
 	defer ticker.Stop()
 
-	notificationSent := false
-
 	for {
 		select {
 		case <-ticker.C:
-			if time.Since(kiuas.LastDataReceived) > time.Hour && !notificationSent {
-				SendTelegramMessage(b, ctx, config, "No data received for over 1 hour", config.MaintenanceChatID)
-				notificationSent = true
-			} else if time.Since(kiuas.LastDataReceived) <= time.Hour {
-				notificationSent = false
-			}
+			checkDataReception(b, ctx, kiuas, configs.Load(), langs, time.Now())
 		case <-ctx.Done():
 			return
 		}
@@ -353,15 +499,44 @@ func monitorDataReception(b TelegramBot, ctx context.Context, kiuas *Kiuas, conf
 }
 
 // Function to check temperature change and send notifications
-func checkAndNotify(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, currentTime time.Time) {
+func checkAndNotify(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, subs *Subscriptions, langs *Languages, currentTime time.Time) {
+	locale := langs.For(config, config.NotificationChatID)
+	// Check the outbox before committing, a message finished in between is committed then
+	warmingPending, readyPending := isPending(b, EventWarming), isPending(b, EventReady)
+	commitDelivered(b, kiuas)
+
+	if kiuas.WarmingNotificationSent || kiuas.ReadyNotificationSent {
+		kiuas.SessionMaxTemperature = max(kiuas.SessionMaxTemperature, kiuas.Temperature)
+	}
 
 	// Ready notification check
 	if kiuas.Temperature >= config.ReadyThreshold {
-		if !kiuas.ReadyNotificationSent {
-			SendTelegramMessage(b, ctx, config, fmt.Sprintf("*Sauna valmis\\!*🔥\nLämpötila: %.1f °C 🌡️", kiuas.Temperature))
-			kiuas.ReadyNotificationSent = true
+		// The flag is set once the message has been delivered, see commitDelivered
+		if !kiuas.ReadyNotificationSent && !readyPending {
+			n := Notification{Event: EventReady, Key: "ready", Args: []any{kiuas.Temperature}, Time: currentTime}
+			subscribers := subscriberNotifiers(b, config, subs, langs, EventReady, currentTime)
+			if config.WarmingUpdateInterval > 0 && kiuas.RSVP != nil && kiuas.RSVP.MessageID != 0 {
+				// Turn the live warming message into the ready message instead of sending a new one
+				live := &RSVPNotifier{Bot: b, Config: config, RSVP: kiuas.RSVP}
+				notifyWith(b, ctx, kiuas, config, langs, n, append([]Notifier{live}, subscribers...)...)
+				kiuas.ReadyNotificationSent = live.Edited
+				if !live.Edited {
+					// The edit is not retried, queue a separate ready message so that it is not lost
+					chat := &TelegramNotifier{Bot: b, Config: config, Langs: langs, ChatID: config.NotificationChatID, Tagged: true}
+					if err := chat.Notify(ctx, n); err != nil {
+						log.Printf("Failed to send %s notification: %v\n", n.Event, err)
+					}
+					kiuas.ReadyNotificationSent = chat.Sent
+				}
+			} else {
+				chat := &TelegramNotifier{Bot: b, Config: config, Langs: langs, ChatID: config.NotificationChatID, Tagged: true}
+				notifyWith(b, ctx, kiuas, config, langs, n, append([]Notifier{chat}, subscribers...)...)
+				kiuas.ReadyNotificationSent = chat.Sent
+			}
+			sendReadyChart(b, ctx, kiuas, config, langs, currentTime)
+			kiuas.ReadyTime = currentTime
 		}
-	} else if !kiuas.WarmingNotificationSent && !kiuas.ReadyNotificationSent {
+	} else if !kiuas.WarmingNotificationSent && !kiuas.ReadyNotificationSent && !warmingPending {
 		if kiuas.IsWarming(config) {
 			// Check if warming started, if not, initialize warming start time
 			if kiuas.WarmingStartTime.IsZero() {
@@ -376,9 +551,16 @@ func checkAndNotify(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Co
 			estimatedReadyTimeStr := estimatedReadyTime.Format("15:04")
 			fmt.Printf("Estimated ready time string: %s\n", estimatedReadyTimeStr)
 
-			SendTelegramMessage(b, ctx, config, fmt.Sprintf("🔥*Sauna lämpiää\\!*🔥\nValmis klo %s", estimatedReadyTimeStr))
-			kiuas.WarmingNotificationSent = true
+			// The message in the notification chat gets the RSVP buttons, direct messages are sent as is
+			rsvp := &RSVPNotifier{Bot: b, Config: config, Locale: locale}
+			notifyWith(b, ctx, kiuas, config, langs, Notification{Event: EventWarming, Key: "warming", Args: []any{estimatedReadyTimeStr}, Time: currentTime},
+				append([]Notifier{rsvp}, subscriberNotifiers(b, config, subs, langs, EventWarming, currentTime)...)...)
+			kiuas.RSVP = rsvp.RSVP
+			kiuas.WarmingNotificationSent = kiuas.RSVP != nil && kiuas.RSVP.MessageID != 0
+			kiuas.EstimatedReadyTime = estimatedReadyTime
 		}
+	} else {
+		updateWarmingMessage(b, ctx, kiuas, config, currentTime)
 	}
 
 	// Check if 2 hours have passed since warming started and temperature is below ReadyThreshold
@@ -386,17 +568,23 @@ func checkAndNotify(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Co
 	if !kiuas.ReadyNotificationSent && !kiuas.WarmingStartTime.IsZero() {
 		if currentTime.Sub(kiuas.WarmingStartTime) > 2*time.Hour {
 
-			SendTelegramMessage(b, ctx, config, "⚠️ *Sauna ei saavuttanut tavoitelämpötilaa kahdessa tunnissa\\!* Tarkista kiuas.")
+			notify(b, ctx, kiuas, config, langs, Notification{Event: EventStalled, Key: "stalled", Time: currentTime}, config.NotificationChatID)
 			// Reset notifications and warming start time
+			closeRSVP(b, ctx, kiuas)
 			kiuas.ResetNotifications()
 			kiuas.WarmingStartTime = time.Time{}
 
 		}
 	}
 
+	checkSessionLength(b, ctx, kiuas, config, langs, currentTime)
+
 	// Reset notifications if temperature has cooled down
 	if kiuas.Temperature < config.ResetThreshold {
 		if kiuas.WarmingNotificationSent && kiuas.ReadyNotificationSent {
+			kiuas.EndSession(config, currentTime)
+			notify(b, ctx, kiuas, config, langs, Notification{Event: EventCooled, Key: "cooled", Args: []any{kiuas.Temperature}, Time: currentTime})
+			closeRSVP(b, ctx, kiuas)
 			kiuas.ResetNotifications()
 			kiuas.WarmingStartTime = time.Time{} // Ensure warming start time is reset
 		}
@@ -12,12 +12,52 @@ import (
 )
 
 type MockTelegramBot struct {
-	SentMessages []string
+	SentMessages    []string
+	SentChatIDs     []any
+	EditedMessages  []*bot.EditMessageTextParams
+	CallbackAnswers []string
+	SentPhotos      []*bot.SendPhotoParams
+	InlineAnswers   []*bot.AnswerInlineQueryParams
+	Commands        []*bot.SetMyCommandsParams
+	// Errors returned by the next calls to SendMessage and EditMessageText
+	SendErrors []error
+	EditErrors []error
 }
 
 func (m *MockTelegramBot) SendMessage(ctx context.Context, params *bot.SendMessageParams) (*models.Message, error) {
+	if len(m.SendErrors) > 0 {
+		err := m.SendErrors[0]
+		m.SendErrors = m.SendErrors[1:]
+		return nil, err
+	}
 	m.SentMessages = append(m.SentMessages, params.Text)
-	return &models.Message{}, nil
+	m.SentChatIDs = append(m.SentChatIDs, params.ChatID)
+	return &models.Message{ID: len(m.SentMessages)}, nil
+}
+
+func (m *MockTelegramBot) EditMessageText(ctx context.Context, params *bot.EditMessageTextParams) (*models.Message, error) {
+	if len(m.EditErrors) > 0 {
+		err := m.EditErrors[0]
+		m.EditErrors = m.EditErrors[1:]
+		return nil, err
+	}
+	m.EditedMessages = append(m.EditedMessages, params)
+	return &models.Message{ID: params.MessageID}, nil
+}
+
+func (m *MockTelegramBot) AnswerCallbackQuery(ctx context.Context, params *bot.AnswerCallbackQueryParams) error {
+	m.CallbackAnswers = append(m.CallbackAnswers, params.Text)
+	return nil
+}
+
+func (m *MockTelegramBot) SendPhoto(ctx context.Context, params *bot.SendPhotoParams) (*models.Message, error) {
+	m.SentPhotos = append(m.SentPhotos, params)
+	return &models.Message{ID: len(m.SentMessages) + len(m.SentPhotos)}, nil
+}
+
+func (m *MockTelegramBot) AnswerInlineQuery(ctx context.Context, params *bot.AnswerInlineQueryParams) error {
+	m.InlineAnswers = append(m.InlineAnswers, params)
+	return nil
 }
 
 func (m *MockTelegramBot) RegisterHandler(handlerType bot.HandlerType, pattern string, matchType bot.MatchType, handler bot.HandlerFunc) {
@@ -29,7 +69,7 @@ func (m *MockTelegramBot) Start(ctx context.Context) {
 }
 
 func (m *MockTelegramBot) SetMyCommands(ctx context.Context, params *bot.SetMyCommandsParams) error {
-	// No-op for testing
+	m.Commands = append(m.Commands, params)
 	return nil
 }
 
@@ -69,7 +109,7 @@ func TestCheckAndNotify_SaunaReady(t *testing.T) {
 
 	currentTime := time.Now()
 
-	checkAndNotify(mockBot, context.Background(), kiuas, config, currentTime)
+	checkAndNotify(mockBot, context.Background(), kiuas, config, nil, nil, currentTime)
 
 	if !kiuas.ReadyNotificationSent {
 		t.Errorf("Expected ReadyNotificationSent to be true")
@@ -107,7 +147,7 @@ func TestCheckAndNotify_SaunaWarming(t *testing.T) {
 		ResetThreshold: 40.0,
 	}
 
-	checkAndNotify(mockBot, context.Background(), kiuas, config, currentTime)
+	checkAndNotify(mockBot, context.Background(), kiuas, config, nil, nil, currentTime)
 
 	if !kiuas.WarmingNotificationSent {
 		t.Errorf("Expected WarmingNotificationSent to be true")
@@ -156,7 +196,7 @@ func TestCheckAndNotify_NoNotification(t *testing.T) {
 		ResetThreshold: 40.0,
 	}
 
-	checkAndNotify(mockBot, context.Background(), kiuas, config, currentTime)
+	checkAndNotify(mockBot, context.Background(), kiuas, config, nil, nil, currentTime)
 
 	if kiuas.WarmingNotificationSent || kiuas.ReadyNotificationSent {
 		t.Errorf("No notifications should be sent")
@@ -194,7 +234,7 @@ func TestCheckAndNotify_WarmingNotificationSentOnlyOnce(t *testing.T) {
 	for i := 0; i < 5; i++ {
 		kiuas.Temperature += 2.0
 		kiuas.AddTemperatureRecord(kiuas.Temperature, currentTime.Add(time.Duration(i)*time.Minute))
-		checkAndNotify(mockBot, ctx, kiuas, config, currentTime.Add(time.Duration(i)*time.Minute))
+		checkAndNotify(mockBot, ctx, kiuas, config, nil, nil, currentTime.Add(time.Duration(i)*time.Minute))
 	}
 
 	if !kiuas.WarmingNotificationSent {
@@ -235,7 +275,7 @@ func TestCheckAndNotify_ResetNotifications(t *testing.T) {
 	kiuas.Temperature = 35.0
 	kiuas.AddTemperatureRecord(kiuas.Temperature, currentTime)
 
-	checkAndNotify(mockBot, ctx, kiuas, config, currentTime)
+	checkAndNotify(mockBot, ctx, kiuas, config, nil, nil, currentTime)
 
 	if kiuas.WarmingNotificationSent || kiuas.ReadyNotificationSent {
 		t.Errorf("Expected notifications to be reset")
@@ -275,7 +315,7 @@ func TestCheckAndNotify_WarmingStoppedBeforeReady_ResetNotifications(t *testing.
 	kiuas.Temperature = 35.0
 	kiuas.AddTemperatureRecord(kiuas.Temperature, currentTime)
 
-	checkAndNotify(mockBot, ctx, kiuas, config, currentTime)
+	checkAndNotify(mockBot, ctx, kiuas, config, nil, nil, currentTime)
 
 	if kiuas.WarmingNotificationSent && kiuas.ReadyNotificationSent {
 		t.Errorf("Expected notifications to be reset")
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+)
+
+// How long a publish may take before it is given up
+const mqttTimeout = 5 * time.Second
+
+// States of the sauna published to the state topic
+const (
+	SaunaStateOff     = "off"
+	SaunaStateWarming = "warming"
+	SaunaStateReady   = "ready"
+)
+
+// MQTTReading is the JSON payload of the reading topic
+type MQTTReading struct {
+	Temperature float64   `json:"temperature"`
+	Humidity    float64   `json:"humidity"`
+	Pressure    uint32    `json:"pressure"` // Pa
+	Battery     uint16    `json:"battery"`  // mV
+	Time        time.Time `json:"time"`
+}
+
+// MQTTPublisher publishes the readings and the state of the sauna to an MQTT broker:
+//
+//	<prefix>/reading       every reading as JSON, QoS 0
+//	<prefix>/state         off, warming or ready, retained
+//	<prefix>/availability  online or offline, retained, offline is the last will
+//
+// With a discovery prefix the sensors are announced to Home Assistant. The topics
+// are fixed when connecting, changing them requires a restart. The same connection
+// is used to receive readings from the ingest topic, see Subscribe.
+type MQTTPublisher struct {
+	client          mqtt.Client
+	prefix          string
+	discoveryPrefix string
+	nodeID          string
+
+	mu            sync.Mutex
+	lastState     string
+	subscriptions map[string]mqtt.MessageHandler
+}
+
+// ConnectMQTT connects to the broker in the config, or returns nil if MQTT is not configured.
+// The connection is retried in the background, so an unreachable broker does not stop the bot.
+func ConnectMQTT(config *Config) *MQTTPublisher {
+	if config.MQTTBroker == "" {
+		return nil
+	}
+
+	p := &MQTTPublisher{
+		prefix:          strings.TrimSuffix(config.MQTTTopicPrefix, "/"),
+		discoveryPrefix: strings.TrimSuffix(config.MQTTDiscoveryPrefix, "/"),
+		nodeID:          mqttNodeID(config.MQTTClientID),
+		subscriptions:   make(map[string]mqtt.MessageHandler),
+	}
+	opts := mqtt.NewClientOptions().
+		AddBroker(config.MQTTBroker).
+		SetClientID(config.MQTTClientID).
+		SetUsername(config.MQTTUsername).
+		SetPassword(config.MQTTPassword).
+		SetWill(p.topic("availability"), "offline", 1, true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		// The handlers publish and wait, which would block the in-order delivery
+		SetOrderMatters(false).
+		SetOnConnectHandler(p.onConnect).
+		SetConnectionLostHandler(func(_ mqtt.Client, err error) {
+			log.Printf("MQTT connection lost: %v\n", err)
+		})
+	p.client = mqtt.NewClient(opts)
+	p.client.Connect()
+	return p
+}
+
+// Announce the bot, republish the state and renew the subscriptions after every (re)connect
+func (p *MQTTPublisher) onConnect(_ mqtt.Client) {
+	log.Println("Connected to the MQTT broker")
+	p.publish(p.topic("availability"), true, []byte("online"))
+	if p.discoveryPrefix != "" {
+		p.publishDiscovery()
+	}
+
+	p.mu.Lock()
+	state := p.lastState
+	subscriptions := maps.Clone(p.subscriptions)
+	p.mu.Unlock()
+	if state != "" {
+		p.publish(p.topic("state"), true, []byte(state))
+	}
+	for topic, handler := range subscriptions {
+		p.subscribe(topic, handler)
+	}
+}
+
+// Subscribe calls the handler with the messages of the topic, also after reconnecting
+func (p *MQTTPublisher) Subscribe(topic string, handler func(topic string, payload []byte)) {
+	if p == nil {
+		return
+	}
+	messageHandler := func(_ mqtt.Client, msg mqtt.Message) {
+		handler(msg.Topic(), msg.Payload())
+	}
+	p.mu.Lock()
+	p.subscriptions[topic] = messageHandler
+	p.mu.Unlock()
+
+	if p.client.IsConnectionOpen() {
+		p.subscribe(topic, messageHandler)
+	}
+}
+
+func (p *MQTTPublisher) subscribe(topic string, handler mqtt.MessageHandler) {
+	token := p.client.Subscribe(topic, 1, handler)
+	if !token.WaitTimeout(mqttTimeout) {
+		log.Printf("Subscribing to MQTT topic %s timed out\n", topic)
+	} else if err := token.Error(); err != nil {
+		log.Printf("Failed to subscribe to MQTT topic %s: %v\n", topic, err)
+	}
+}
+
+// Close marks the bot offline and disconnects
+func (p *MQTTPublisher) Close() {
+	if p == nil {
+		return
+	}
+	if p.client.IsConnected() {
+		p.publish(p.topic("availability"), true, []byte("offline"))
+	}
+	p.client.Disconnect(uint(mqttTimeout.Milliseconds()))
+}
+
+// PublishReading publishes the latest reading of the sauna
+func (p *MQTTPublisher) PublishReading(kiuas *Kiuas, now time.Time) {
+	if p == nil {
+		return
+	}
+	payload, err := json.Marshal(MQTTReading{
+		Temperature: kiuas.Temperature,
+		Humidity:    kiuas.Humidity,
+		Pressure:    kiuas.Pressure,
+		Battery:     kiuas.Battery,
+		Time:        now,
+	})
+	if err != nil {
+		log.Printf("Failed to encode MQTT reading: %v\n", err)
+		return
+	}
+	p.publishLive(p.topic("reading"), 0, false, payload)
+}
+
+// PublishState publishes the state of the sauna when it has changed
+func (p *MQTTPublisher) PublishState(state string) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	changed := state != p.lastState
+	p.lastState = state
+	p.mu.Unlock()
+
+	if changed {
+		p.publishLive(p.topic("state"), 1, true, []byte(state))
+	}
+}
+
+func (p *MQTTPublisher) topic(name string) string {
+	return p.prefix + "/" + name
+}
+
+func (p *MQTTPublisher) publish(topic string, retained bool, payload []byte) {
+	token := p.client.Publish(topic, 1, retained, payload)
+	if !token.WaitTimeout(mqttTimeout) {
+		log.Printf("Publishing to MQTT topic %s timed out\n", topic)
+	} else if err := token.Error(); err != nil {
+		log.Printf("Failed to publish to MQTT topic %s: %v\n", topic, err)
+	}
+}
+
+// Publish without waiting for the broker, the readings must never wait for MQTT. Nothing is
+// queued while the connection is down: a reading is only useful live and onConnect republishes
+// the state.
+func (p *MQTTPublisher) publishLive(topic string, qos byte, retained bool, payload []byte) {
+	if !p.client.IsConnectionOpen() {
+		return
+	}
+	token := p.client.Publish(topic, qos, retained, payload)
+	go func() {
+		if !token.WaitTimeout(mqttTimeout) {
+			log.Printf("Publishing to MQTT topic %s timed out\n", topic)
+		} else if err := token.Error(); err != nil {
+			log.Printf("Failed to publish to MQTT topic %s: %v\n", topic, err)
+		}
+	}()
+}
+
+// Home Assistant MQTT discovery, see https://www.home-assistant.io/integrations/mqtt/#mqtt-discovery
+type haSensor struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	StateTopic        string   `json:"state_topic"`
+	ValueTemplate     string   `json:"value_template,omitempty"`
+	DeviceClass       string   `json:"device_class,omitempty"`
+	StateClass        string   `json:"state_class,omitempty"`
+	UnitOfMeasurement string   `json:"unit_of_measurement,omitempty"`
+	Options           []string `json:"options,omitempty"`
+	AvailabilityTopic string   `json:"availability_topic"`
+	Device            haDevice `json:"device"`
+}
+
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model"`
+}
+
+// Sensors announced to Home Assistant, keyed by object id
+func (p *MQTTPublisher) haSensors() map[string]haSensor {
+	reading := func(name, field, deviceClass, unit string) haSensor {
+		return haSensor{
+			Name:              name,
+			StateTopic:        p.topic("reading"),
+			ValueTemplate:     fmt.Sprintf("{{ value_json.%s }}", field),
+			DeviceClass:       deviceClass,
+			StateClass:        "measurement",
+			UnitOfMeasurement: unit,
+		}
+	}
+	return map[string]haSensor{
+		"temperature": reading("Lämpötila", "temperature", "temperature", "°C"),
+		"humidity":    reading("Kosteus", "humidity", "humidity", "%"),
+		"pressure":    reading("Ilmanpaine", "pressure", "atmospheric_pressure", "Pa"),
+		"battery":     reading("Pariston jännite", "battery", "voltage", "mV"),
+		"state": {
+			Name:        "Tila",
+			StateTopic:  p.topic("state"),
+			DeviceClass: "enum",
+			Options:     []string{SaunaStateOff, SaunaStateWarming, SaunaStateReady},
+		},
+	}
+}
+
+func (p *MQTTPublisher) publishDiscovery() {
+	device := haDevice{
+		Identifiers:  []string{p.nodeID},
+		Name:         "Saunatonttu",
+		Manufacturer: "Ruuvi",
+		Model:        "RuuviTag",
+	}
+	for objectID, sensor := range p.haSensors() {
+		sensor.UniqueID = p.nodeID + "_" + objectID
+		sensor.AvailabilityTopic = p.topic("availability")
+		sensor.Device = device
+		payload, err := json.Marshal(sensor)
+		if err != nil {
+			log.Printf("Failed to encode discovery config of %s: %v\n", objectID, err)
+			continue
+		}
+		p.publish(fmt.Sprintf("%s/sensor/%s/%s/config", p.discoveryPrefix, p.nodeID, objectID), true, payload)
+	}
+}
+
+// Home Assistant node ids may only contain letters, digits, underscores and dashes
+func mqttNodeID(clientID string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, clientID)
+}
+
+// State of the sauna for MQTT. A session stays ready until the sauna has cooled down.
+func saunaState(kiuas *Kiuas, config *Config) string {
+	switch {
+	case kiuas.ReadyNotificationSent || kiuas.Temperature >= config.ReadyThreshold:
+		return SaunaStateReady
+	case kiuas.WarmingNotificationSent || kiuas.IsWarming(config):
+		return SaunaStateWarming
+	}
+	return SaunaStateOff
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"slices"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	mqttserver "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+)
+
+// Start an in-process MQTT broker and return its URL
+func startMQTTBroker(t *testing.T) string {
+	t.Helper()
+	server := mqttserver.New(&mqttserver.Options{Logger: slog.New(slog.NewTextHandler(io.Discard, nil))})
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+	tcp := listeners.NewTCP(listeners.Config{ID: "test", Address: "127.0.0.1:0"})
+	if err := server.AddListener(tcp); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return "tcp://" + tcp.Address()
+}
+
+// Subscribe to every topic with a separate client, retained messages are delivered first
+func subscribeMQTT(t *testing.T, broker string) <-chan mqtt.Message {
+	t.Helper()
+	messages := make(chan mqtt.Message, 100)
+	client := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(broker).SetClientID("test-subscriber"))
+	if token := client.Connect(); !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("Failed to connect: %v", token.Error())
+	}
+	t.Cleanup(func() { client.Disconnect(0) })
+	token := client.Subscribe("#", 1, func(_ mqtt.Client, msg mqtt.Message) { messages <- msg })
+	if !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+		t.Fatalf("Failed to subscribe: %v", token.Error())
+	}
+	return messages
+}
+
+// Wait for a message on each of the topics, in any order, skipping the other topics
+func waitMQTT(t *testing.T, messages <-chan mqtt.Message, topics ...string) map[string]mqtt.Message {
+	t.Helper()
+	received := make(map[string]mqtt.Message)
+	timeout := time.After(5 * time.Second)
+	for len(received) < len(topics) {
+		select {
+		case msg := <-messages:
+			if slices.Contains(topics, msg.Topic()) {
+				received[msg.Topic()] = msg
+			}
+		case <-timeout:
+			t.Fatalf("Expected messages on %v, got %d", topics, len(received))
+		}
+	}
+	return received
+}
+
+func TestMQTTPublisher(t *testing.T) {
+	broker := startMQTTBroker(t)
+	config := DefaultConfig()
+	config.MQTTBroker = broker
+	config.MQTTClientID = "sauna.osakunta"
+
+	publisher := ConnectMQTT(config)
+	defer publisher.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for !publisher.client.IsConnectionOpen() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	when := time.Date(2024, 12, 24, 18, 0, 0, 0, time.UTC)
+	publisher.PublishReading(&Kiuas{Temperature: 75.5, Humidity: 12, Pressure: 100500, Battery: 2900}, when)
+	publisher.PublishState(SaunaStateWarming)
+	publisher.PublishState(SaunaStateReady)
+	publisher.PublishState(SaunaStateReady)
+
+	// A client connecting afterwards gets the retained state, availability and discovery
+	messages := subscribeMQTT(t, broker)
+	discovery := "homeassistant/sensor/sauna_osakunta/temperature/config"
+	retained := waitMQTT(t, messages, "saunatonttu/state", "saunatonttu/availability", discovery)
+	if msg := retained["saunatonttu/state"]; string(msg.Payload()) != SaunaStateReady || !msg.Retained() {
+		t.Errorf("Expected the retained state ready, got %q", msg.Payload())
+	}
+	if msg := retained["saunatonttu/availability"]; string(msg.Payload()) != "online" {
+		t.Errorf("Expected the bot to be online, got %q", msg.Payload())
+	}
+	var sensor haSensor
+	if err := json.Unmarshal(retained[discovery].Payload(), &sensor); err != nil {
+		t.Fatal(err)
+	}
+	if sensor.UniqueID != "sauna_osakunta_temperature" || sensor.StateTopic != "saunatonttu/reading" || sensor.UnitOfMeasurement != "°C" || sensor.AvailabilityTopic != "saunatonttu/availability" {
+		t.Errorf("Unexpected discovery config %+v", sensor)
+	}
+
+	// Readings are not retained, only sent to the current subscribers
+	publisher.PublishReading(&Kiuas{Temperature: 80.25, Humidity: 15}, when)
+	var reading MQTTReading
+	if err := json.Unmarshal(waitMQTT(t, messages, "saunatonttu/reading")["saunatonttu/reading"].Payload(), &reading); err != nil {
+		t.Fatal(err)
+	}
+	if reading.Temperature != 80.25 || reading.Humidity != 15 || !reading.Time.Equal(when) {
+		t.Errorf("Unexpected reading %+v", reading)
+	}
+
+	// An unchanged state is not published again
+	publisher.PublishState(SaunaStateReady)
+	publisher.PublishState(SaunaStateOff)
+	if msg := waitMQTT(t, messages, "saunatonttu/state")["saunatonttu/state"]; string(msg.Payload()) != SaunaStateOff {
+		t.Errorf("Expected the state off, got %q", msg.Payload())
+	}
+}
+
+func TestMQTTPublisher_Unreachable(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := "tcp://" + listener.Addr().String()
+	listener.Close()
+
+	config := DefaultConfig()
+	config.MQTTBroker = broker
+	publisher := ConnectMQTT(config)
+	defer publisher.Close()
+
+	// Paho reports the client as connected while it retries, the readings must not wait for it
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		publisher.PublishReading(&Kiuas{Temperature: 60}, start)
+		publisher.PublishState(SaunaStateWarming)
+		publisher.PublishState(SaunaStateReady)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected publishing to return right away, took %s", elapsed)
+	}
+	if publisher.lastState != SaunaStateReady {
+		t.Errorf("Expected the state to be kept for the reconnect, got %q", publisher.lastState)
+	}
+}
+
+func TestMQTTPublisher_Disabled(t *testing.T) {
+	publisher := ConnectMQTT(DefaultConfig())
+	if publisher != nil {
+		t.Fatalf("Expected no publisher without a broker")
+	}
+	// A nil publisher ignores everything
+	publisher.PublishReading(&Kiuas{}, time.Now())
+	publisher.PublishState(SaunaStateOff)
+	publisher.Close()
+}
+
+func TestSaunaState(t *testing.T) {
+	config := &Config{ReadyThreshold: 70, WarmingThreshold: 30, LowerBound: 0.01}
+	now := time.Now()
+
+	tests := []struct {
+		name  string
+		kiuas *Kiuas
+		want  string
+	}{
+		{"cold", &Kiuas{Temperature: 22}, SaunaStateOff},
+		{"warming", &Kiuas{Temperature: 50, TemperatureRecords: [3]float64{40, 45, 50}, TimestampRecords: [3]time.Time{now, now.Add(time.Minute), now.Add(2 * time.Minute)}}, SaunaStateWarming},
+		{"warming notified", &Kiuas{Temperature: 50, WarmingNotificationSent: true}, SaunaStateWarming},
+		{"ready", &Kiuas{Temperature: 72}, SaunaStateReady},
+		{"cooling after ready", &Kiuas{Temperature: 60, WarmingNotificationSent: true, ReadyNotificationSent: true}, SaunaStateReady},
+	}
+	for _, tt := range tests {
+		if got := saunaState(tt.kiuas, config); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.name, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// Check if the given time is within the quiet hours. The range may wrap over midnight.
+func inQuietHours(t time.Time, start, end int) bool {
+	if start == end {
+		return false
+	}
+	hour := t.Hour()
+	if start < end {
+		return hour >= start && hour < end
+	}
+	return hour >= start || hour < end
+}
+
+// Format a duration as hours and minutes, e.g. "2h 15min"
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+	if hours == 0 {
+		return fmt.Sprintf("%dmin", minutes)
+	}
+	return fmt.Sprintf("%dh %dmin", hours, minutes)
+}
+
+// Function to alert the maintenance chat when no data has been received for NoDataThreshold,
+// escalate to NoDataEscalationChatID after NoDataEscalationThreshold and report the recovery.
+// The escalation chat is opt-in, without it the escalation only goes to the notifiers of the
+// event. Alerts are deferred during quiet hours.
+func checkDataReception(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, langs *Languages, currentTime time.Time) {
+	outage := currentTime.Sub(kiuas.LastDataReceived)
+
+	if outage <= config.NoDataThreshold {
+		if kiuas.NoDataAlertSent {
+			duration := formatDuration(kiuas.LastDataReceived.Sub(kiuas.NoDataSince))
+			log.Printf("Data reception recovered after %s\n", duration)
+			chatIDs := []int64{config.MaintenanceChatID}
+			if kiuas.NoDataEscalated {
+				chatIDs = append(chatIDs, escalationChatIDs(config)...)
+			}
+			notify(b, ctx, kiuas, config, langs, Notification{Event: EventNoDataRecovered, Key: "no_data_recovered", Args: []any{duration}, Time: currentTime}, chatIDs...)
+		}
+		kiuas.NoDataAlertSent = false
+		kiuas.NoDataEscalated = false
+		return
+	}
+
+	if inQuietHours(currentTime, config.QuietHoursStart, config.QuietHoursEnd) {
+		return
+	}
+
+	if !kiuas.NoDataAlertSent {
+		log.Printf("No data received for %s\n", formatDuration(outage))
+		notify(b, ctx, kiuas, config, langs, Notification{Event: EventNoData, Key: "no_data", Args: []any{formatDuration(outage)}, Time: currentTime}, config.MaintenanceChatID)
+		kiuas.NoDataAlertSent = true
+		kiuas.NoDataSince = kiuas.LastDataReceived
+	}
+
+	if config.NoDataEscalationThreshold > 0 && outage > config.NoDataEscalationThreshold && !kiuas.NoDataEscalated {
+		log.Printf("No data received for %s, escalating\n", formatDuration(outage))
+		notify(b, ctx, kiuas, config, langs, Notification{Event: EventNoDataEscalated, Key: "no_data_escalated", Args: []any{formatDuration(outage)}, Time: currentTime}, escalationChatIDs(config)...)
+		kiuas.NoDataEscalated = true
+	}
+}
+
+func escalationChatIDs(config *Config) []int64 {
+	if config.NoDataEscalationChatID == 0 {
+		return nil
+	}
+	return []int64{config.NoDataEscalationChatID}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestInQuietHours(t *testing.T) {
+	day := time.Date(2024, 12, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		hour       int
+		start, end int
+		expected   bool
+	}{
+		{23, 23, 8, true},
+		{3, 23, 8, true},
+		{8, 23, 8, false},
+		{12, 23, 8, false},
+		{12, 9, 17, true},
+		{18, 9, 17, false},
+		{12, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		if got := inQuietHours(day.Add(time.Duration(tt.hour)*time.Hour), tt.start, tt.end); got != tt.expected {
+			t.Errorf("inQuietHours(%d, %d, %d) = %v, expected %v", tt.hour, tt.start, tt.end, got, tt.expected)
+		}
+	}
+}
+
+func TestCheckDataReception_AlertEscalationAndRecovery(t *testing.T) {
+	lastData := time.Date(2024, 12, 1, 10, 0, 0, 0, time.Local)
+	kiuas := &Kiuas{LastDataReceived: lastData}
+
+	mockBot := &MockTelegramBot{}
+
+	config := &Config{
+		MaintenanceChatID:         1,
+		NoDataThreshold:           time.Hour,
+		NoDataEscalationThreshold: 3 * time.Hour,
+		NoDataEscalationChatID:    3,
+	}
+
+	ctx := context.Background()
+
+	checkDataReception(mockBot, ctx, kiuas, config, nil, lastData.Add(30*time.Minute))
+	if len(mockBot.SentMessages) != 0 {
+		t.Fatalf("Expected 0 messages before the threshold, got %d", len(mockBot.SentMessages))
+	}
+
+	checkDataReception(mockBot, ctx, kiuas, config, nil, lastData.Add(61*time.Minute))
+	checkDataReception(mockBot, ctx, kiuas, config, nil, lastData.Add(62*time.Minute))
+	if len(mockBot.SentMessages) != 1 || mockBot.SentChatIDs[0] != config.MaintenanceChatID {
+		t.Fatalf("Expected 1 message to the maintenance chat, got %d", len(mockBot.SentMessages))
+	}
+
+	checkDataReception(mockBot, ctx, kiuas, config, nil, lastData.Add(4*time.Hour))
+	if len(mockBot.SentMessages) != 2 || mockBot.SentChatIDs[1] != config.NoDataEscalationChatID {
+		t.Fatalf("Expected escalation to the second chat, got %d messages", len(mockBot.SentMessages))
+	}
+
+	kiuas.LastDataReceived = lastData.Add(5 * time.Hour)
+	checkDataReception(mockBot, ctx, kiuas, config, nil, lastData.Add(5*time.Hour))
+	if len(mockBot.SentMessages) != 4 {
+		t.Fatalf("Expected recovery messages to both chats, got %d messages", len(mockBot.SentMessages))
+	}
+	if !strings.Contains(mockBot.SentMessages[2], "5h 0min") {
+		t.Errorf("Expected outage duration in the recovery message, got: %s", mockBot.SentMessages[2])
+	}
+}
+
+func TestCheckDataReception_NoEscalationChat(t *testing.T) {
+	lastData := time.Date(2024, 12, 1, 10, 0, 0, 0, time.Local)
+	kiuas := &Kiuas{LastDataReceived: lastData}
+	mockBot := &MockTelegramBot{}
+	config := &Config{
+		MaintenanceChatID:         1,
+		NotificationChatID:        2,
+		NoDataThreshold:           time.Hour,
+		NoDataEscalationThreshold: 3 * time.Hour,
+	}
+
+	checkDataReception(mockBot, context.Background(), kiuas, config, nil, lastData.Add(2*time.Hour))
+	checkDataReception(mockBot, context.Background(), kiuas, config, nil, lastData.Add(4*time.Hour))
+	kiuas.LastDataReceived = lastData.Add(5 * time.Hour)
+	checkDataReception(mockBot, context.Background(), kiuas, config, nil, lastData.Add(5*time.Hour))
+
+	// Only the alert and the recovery to the maintenance chat, never to the members
+	if len(mockBot.SentMessages) != 2 || slices.Contains(mockBot.SentChatIDs, any(config.NotificationChatID)) {
+		t.Errorf("Expected only the maintenance chat to be alerted, got %v", mockBot.SentChatIDs)
+	}
+}
+
+func TestCheckDataReception_DeferredDuringQuietHours(t *testing.T) {
+	lastData := time.Date(2024, 12, 1, 22, 0, 0, 0, time.Local)
+	kiuas := &Kiuas{LastDataReceived: lastData}
+
+	mockBot := &MockTelegramBot{}
+
+	config := &Config{
+		NoDataThreshold: time.Hour,
+		QuietHoursStart: 23,
+		QuietHoursEnd:   8,
+	}
+
+	ctx := context.Background()
+
+	checkDataReception(mockBot, ctx, kiuas, config, nil, lastData.Add(3*time.Hour))
+	if len(mockBot.SentMessages) != 0 {
+		t.Fatalf("Expected alert to be deferred, got %d messages", len(mockBot.SentMessages))
+	}
+
+	checkDataReception(mockBot, ctx, kiuas, config, nil, lastData.Add(10*time.Hour))
+	if len(mockBot.SentMessages) != 1 {
+		t.Fatalf("Expected alert after quiet hours, got %d messages", len(mockBot.SentMessages))
+	}
+}
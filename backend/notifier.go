@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"net/smtp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+
+	"bt-telegram/format"
+)
+
+// Timeout of the HTTP requests to webhooks
+const notifierTimeout = 10 * time.Second
+
+// Notification is a message about a sauna event. The text is rendered from the message
+// catalog by each channel in its own language and format.
+type Notification struct {
+	Event SaunaEvent
+	Key   string
+	Args  []any
+	Time  time.Time
+	// State of the sauna at the time of the event, filled in by notify
+	Temperature float64
+	Humidity    float64
+}
+
+// Notifier sends notifications to a channel such as a Telegram chat or a webhook
+type Notifier interface {
+	Notify(ctx context.Context, n Notification) error
+}
+
+// NotifierConfig is a notification channel in the config
+type NotifierConfig struct {
+	Type string `yaml:"type"` // telegram, webhook, discord, slack or email
+	// Events sent to the channel, all events if empty
+	Events   []SaunaEvent `yaml:"events"`
+	URL      string       `yaml:"url"`      // webhook, discord and slack
+	Secret   string       `yaml:"secret"`   // webhook, HMAC key of the signature header
+	ChatID   int64        `yaml:"chat_id"`  // telegram
+	To       []string     `yaml:"to"`       // email
+	Language string       `yaml:"language"` // defaults to the language of the bot
+}
+
+// SMTPConfig is the mail server used by the email notifiers
+type SMTPConfig struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+	From     string `yaml:"from"`
+}
+
+func (nc NotifierConfig) validate(config *Config) error {
+	for _, event := range nc.Events {
+		if !slices.Contains(saunaEvents, event) {
+			return fmt.Errorf("unknown event %q", event)
+		}
+	}
+	if nc.Language != "" {
+		if _, err := ParseLocale(nc.Language); err != nil {
+			return err
+		}
+	}
+
+	switch nc.Type {
+	case "telegram":
+		if nc.ChatID == 0 {
+			return errors.New("chat_id is required")
+		}
+	case "webhook", "discord", "slack":
+		if !strings.HasPrefix(nc.URL, "http://") && !strings.HasPrefix(nc.URL, "https://") {
+			return fmt.Errorf("url must be an http or https URL, got %q", nc.URL)
+		}
+	case "email":
+		if len(nc.To) == 0 {
+			return errors.New("to is required")
+		}
+		if config.SMTP.Host == "" || config.SMTP.From == "" {
+			return errors.New("smtp host and from are required")
+		}
+	default:
+		return fmt.Errorf("unknown type %q", nc.Type)
+	}
+	return nil
+}
+
+func (nc NotifierConfig) wants(event SaunaEvent) bool {
+	return len(nc.Events) == 0 || slices.Contains(nc.Events, event)
+}
+
+// Build the notifier of the channel
+func (nc NotifierConfig) notifier(b TelegramBot, kiuas *Kiuas, config *Config, langs *Languages) Notifier {
+	language := nc.Language
+	if language == "" {
+		language = config.Language
+	}
+	locale, err := ParseLocale(language)
+	if err != nil {
+		locale = LocaleFi
+	}
+	client := &http.Client{Timeout: notifierTimeout}
+
+	switch nc.Type {
+	case "telegram":
+		return &TelegramNotifier{Bot: b, Config: config, Langs: langs, ChatID: nc.ChatID}
+	case "webhook":
+		return &WebhookNotifier{URL: nc.URL, Secret: nc.Secret, Locale: locale, Client: client, Log: kiuas.Webhooks}
+	case "discord":
+		return &ChatWebhookNotifier{URL: nc.URL, Field: "content", Locale: locale, Client: client}
+	case "slack":
+		return &ChatWebhookNotifier{URL: nc.URL, Field: "text", Locale: locale, Client: client}
+	case "email":
+		return &EmailNotifier{SMTP: config.SMTP, To: nc.To, Locale: locale}
+	}
+	return nil
+}
+
+// Send a notification to the given Telegram chats and to the channels configured for its event
+func notify(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, langs *Languages, n Notification, chatIDs ...int64) {
+	var notifiers []Notifier
+	for _, chatID := range chatIDs {
+		notifiers = append(notifiers, &TelegramNotifier{Bot: b, Config: config, Langs: langs, ChatID: chatID})
+	}
+	notifyWith(b, ctx, kiuas, config, langs, n, notifiers...)
+}
+
+// Send a notification with the given notifiers and to the channels configured for its event.
+// Telegram messages are sent or queued in the outbox right away, the caller reads their result.
+// The other channels may take up to notifierTimeout and are sent in the background.
+func notifyWith(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, langs *Languages, n Notification, notifiers ...Notifier) {
+	n.Temperature = kiuas.Temperature
+	n.Humidity = kiuas.Humidity
+
+	for _, nc := range config.Notifiers {
+		if nc.wants(n.Event) {
+			notifiers = append(notifiers, nc.notifier(b, kiuas, config, langs))
+		}
+	}
+
+	send := func(notifier Notifier) {
+		if err := notifier.Notify(ctx, n); err != nil {
+			log.Printf("Failed to send %s notification: %v\n", n.Event, err)
+		}
+	}
+	for _, notifier := range notifiers {
+		switch notifier.(type) {
+		case *TelegramNotifier, *RSVPNotifier:
+			send(notifier)
+		default:
+			goBackground(func() { send(notifier) })
+		}
+	}
+}
+
+// TelegramNotifier sends notifications to a Telegram chat in the language of the chat
+type TelegramNotifier struct {
+	Bot    TelegramBot
+	Config *Config
+	Langs  *Languages
+	ChatID int64
+	// Tag the message with the event, the outbox commits the flag of the event on delivery
+	Tagged bool
+	// Set by Notify when the message was sent right away instead of queued in the outbox
+	Sent bool
+}
+
+func (t *TelegramNotifier) Notify(ctx context.Context, n Notification) error {
+	mode := t.Config.parseMode()
+	msg := &OutboxMessage{
+		ChatID:    t.ChatID,
+		Text:      t.Langs.For(t.Config, t.ChatID).Format(mode, n.Key, n.Args...),
+		ParseMode: models.ParseMode(mode),
+	}
+	if t.Tagged {
+		msg.Event = n.Event
+	}
+	sent, err := sendOrQueue(t.Bot, ctx, msg)
+	t.Sent = sent != nil
+	return err
+}
+
+// Post a JSON payload, any 2xx response is a success
+func postJSON(ctx context.Context, client *http.Client, url string, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return post(ctx, client, url, body, nil)
+}
+
+// Post a JSON body with extra headers, any 2xx response is a success
+func post(ctx context.Context, client *http.Client, url string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// ChatWebhookNotifier posts the notifications to a Discord or Slack incoming webhook,
+// which only differ in the name of the text field
+type ChatWebhookNotifier struct {
+	URL    string
+	Field  string
+	Locale Locale
+	Client *http.Client
+}
+
+func (c *ChatWebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	return postJSON(ctx, c.Client, c.URL, map[string]string{c.Field: c.Locale.Format(format.Plain, n.Key, n.Args...)})
+}
+
+// EmailNotifier sends the notifications as plain text email, the first line is the subject
+type EmailNotifier struct {
+	SMTP   SMTPConfig
+	To     []string
+	Locale Locale
+	// Time limit of the whole SMTP exchange, defaults to notifierTimeout
+	Timeout time.Duration
+}
+
+func (e *EmailNotifier) Notify(ctx context.Context, n Notification) error {
+	text := e.Locale.Format(format.Plain, n.Key, n.Args...)
+	subject, _, _ := strings.Cut(text, "\n")
+
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", e.SMTP.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", strings.Join(e.To, ", "))
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", n.Time.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n")
+	msg.WriteString(strings.ReplaceAll(text, "\n", "\r\n"))
+	msg.WriteString("\r\n")
+
+	timeout := e.Timeout
+	if timeout == 0 {
+		timeout = notifierTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	return e.send(ctx, []byte(msg.String()))
+}
+
+// smtp.SendMail with a deadline, it has no timeout of its own and a hanging mail server
+// would block the notifications
+func (e *EmailNotifier) send(ctx context.Context, msg []byte) error {
+	port := e.SMTP.Port
+	if port == 0 {
+		port = 587
+	}
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(e.SMTP.Host, strconv.Itoa(port)))
+	if err != nil {
+		return err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+	c, err := smtp.NewClient(conn, e.SMTP.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: e.SMTP.Host}); err != nil {
+			return err
+		}
+	}
+	if e.SMTP.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", e.SMTP.Username, e.SMTP.Password, e.SMTP.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(e.SMTP.From); err != nil {
+		return err
+	}
+	for _, to := range e.To {
+		if err := c.Rcpt(to); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(msg); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Collects the JSON bodies posted to it by path
+type webhookRecorder struct {
+	mu     sync.Mutex
+	bodies map[string][]map[string]any
+}
+
+func newWebhookServer(t *testing.T) (*httptest.Server, *webhookRecorder) {
+	rec := &webhookRecorder{bodies: make(map[string][]map[string]any)}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Invalid JSON posted to %s: %v", r.URL.Path, err)
+		}
+		rec.mu.Lock()
+		rec.bodies[r.URL.Path] = append(rec.bodies[r.URL.Path], body)
+		rec.mu.Unlock()
+		if r.URL.Path == "/broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, rec
+}
+
+func TestNotify_ChannelsPerEvent(t *testing.T) {
+	server, rec := newWebhookServer(t)
+	config := &Config{
+		NotificationChatID: -100,
+		Language:           "fi",
+		Notifiers: []NotifierConfig{
+			{Type: "webhook", URL: server.URL + "/webhook", Events: []SaunaEvent{EventReady}},
+			{Type: "discord", URL: server.URL + "/discord", Language: "en"},
+			{Type: "slack", URL: server.URL + "/slack", Events: []SaunaEvent{EventNoData}},
+			{Type: "webhook", URL: server.URL + "/broken"},
+		},
+	}
+	mockBot := &MockTelegramBot{}
+	when := time.Date(2024, 12, 24, 18, 0, 0, 0, time.UTC)
+
+	notify(mockBot, context.Background(), &Kiuas{}, config, nil, Notification{Event: EventReady, Key: "ready", Args: []any{75.0}, Time: when}, config.NotificationChatID)
+	background.Wait()
+
+	if len(mockBot.SentMessages) != 1 || mockBot.SentMessages[0] != "*Sauna valmis\\!*🔥\nLämpötila: 75\\.0 °C 🌡️" {
+		t.Errorf("Expected the Telegram message in MarkdownV2, got %v", mockBot.SentMessages)
+	}
+
+	webhook := rec.bodies["/webhook"]
+	if len(webhook) != 1 || webhook[0]["event"] != "ready" || webhook[0]["text"] != "Sauna valmis!🔥\nLämpötila: 75.0 °C 🌡️" || webhook[0]["time"] != "2024-12-24T18:00:00Z" {
+		t.Errorf("Unexpected webhook payload %v", webhook)
+	}
+	discord := rec.bodies["/discord"]
+	if len(discord) != 1 || !strings.HasPrefix(discord[0]["content"].(string), "Sauna is ready!") {
+		t.Errorf("Expected the Discord message in English, got %v", discord)
+	}
+	if len(rec.bodies["/slack"]) != 0 {
+		t.Errorf("Expected Slack to get only the no data events")
+	}
+	// A failing channel does not stop the others
+	if len(rec.bodies["/broken"]) != 1 {
+		t.Errorf("Expected the broken webhook to be tried")
+	}
+}
+
+func TestCheckDataReception_Notifiers(t *testing.T) {
+	server, rec := newWebhookServer(t)
+	now := time.Date(2024, 12, 24, 18, 0, 0, 0, time.UTC)
+	kiuas := &Kiuas{LastDataReceived: now.Add(-2 * time.Hour)}
+	config := &Config{
+		MaintenanceChatID: -300,
+		NoDataThreshold:   time.Hour,
+		Notifiers:         []NotifierConfig{{Type: "slack", URL: server.URL + "/slack", Events: []SaunaEvent{EventNoData, EventNoDataRecovered}}},
+	}
+
+	checkDataReception(&MockTelegramBot{}, context.Background(), kiuas, config, nil, now)
+	background.Wait()
+	kiuas.LastDataReceived = now.Add(time.Minute)
+	checkDataReception(&MockTelegramBot{}, context.Background(), kiuas, config, nil, now.Add(time.Minute))
+	background.Wait()
+
+	slack := rec.bodies["/slack"]
+	if len(slack) != 2 || slack[0]["text"] != "Anturilta ei ole tullut dataa (2h 0min)" || !strings.HasPrefix(slack[1]["text"].(string), "Datan vastaanotto palautui") {
+		t.Errorf("Expected the outage and the recovery on Slack, got %v", slack)
+	}
+}
+
+func TestNotifierConfig_Validate(t *testing.T) {
+	config := &Config{SMTP: SMTPConfig{Host: "mail.example.org", From: "tonttu@example.org"}}
+	valid := []NotifierConfig{
+		{Type: "telegram", ChatID: -100},
+		{Type: "webhook", URL: "https://example.org/hook", Events: []SaunaEvent{EventReady, EventStalled}},
+		{Type: "discord", URL: "https://discord.com/api/webhooks/1/abc", Language: "en"},
+		{Type: "email", To: []string{"huolto@example.org"}},
+	}
+	for _, nc := range valid {
+		if err := nc.validate(config); err != nil {
+			t.Errorf("Expected %+v to be valid, got %v", nc, err)
+		}
+	}
+
+	invalid := []NotifierConfig{
+		{Type: "telegram"},
+		{Type: "slack", URL: "ftp://example.org"},
+		{Type: "webhook", URL: "https://example.org", Events: []SaunaEvent{"sauna_exploded"}},
+		{Type: "webhook", URL: "https://example.org", Language: "de"},
+		{Type: "email", To: []string{"huolto@example.org"}},
+		{Type: "pigeon"},
+	}
+	for i, nc := range invalid {
+		c := config
+		if nc.Type == "email" {
+			c = &Config{}
+		}
+		if err := nc.validate(c); err == nil {
+			t.Errorf("Expected invalid notifier %d %+v to fail validation", i, nc)
+		}
+	}
+}
+
+// Minimal SMTP server that accepts a single mail
+func startSMTPServer(t *testing.T) (port int, mail <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+
+		reply("220 localhost ESMTP")
+		var data strings.Builder
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			switch cmd := strings.ToUpper(strings.TrimSpace(line)); {
+			case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+				reply("250 localhost")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 go ahead")
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil || line == ".\r\n" {
+						break
+					}
+					data.WriteString(line)
+				}
+				received <- data.String()
+				reply("250 ok")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 bye")
+				return
+			default:
+				reply("250 ok")
+			}
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port, received
+}
+
+func TestEmailNotifier(t *testing.T) {
+	port, mail := startSMTPServer(t)
+	notifier := &EmailNotifier{
+		SMTP:   SMTPConfig{Host: "127.0.0.1", Port: port, From: "tonttu@example.org"},
+		To:     []string{"huolto@example.org"},
+		Locale: LocaleFi,
+	}
+
+	err := notifier.Notify(context.Background(), Notification{Event: EventStalled, Key: "stalled", Time: time.Now()})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	select {
+	case body := <-mail:
+		if !strings.Contains(body, "To: huolto@example.org\r\n") || !strings.Contains(body, "Subject: =?utf-8?q?") {
+			t.Errorf("Unexpected headers in %q", body)
+		}
+		if !strings.Contains(body, "\r\n\r\n⚠️ Sauna ei saavuttanut tavoitelämpötilaa kahdessa tunnissa! Tarkista kiuas.") {
+			t.Errorf("Expected the plain text message in the body, got %q", body)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("No mail received on port " + strconv.Itoa(port))
+	}
+}
+
+func TestEmailNotifier_Timeout(t *testing.T) {
+	// The server accepts the connection but never sends the greeting
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}
+	}()
+
+	notifier := &EmailNotifier{
+		SMTP:    SMTPConfig{Host: "127.0.0.1", Port: listener.Addr().(*net.TCPAddr).Port, From: "tonttu@example.org"},
+		To:      []string{"huolto@example.org"},
+		Locale:  LocaleFi,
+		Timeout: 100 * time.Millisecond,
+	}
+	start := time.Now()
+	if err := notifier.Notify(context.Background(), Notification{Event: EventStalled, Key: "stalled", Time: start}); err == nil {
+		t.Errorf("Expected a timeout error")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Expected the send to give up after the timeout, took %s", elapsed)
+	}
+}
+
+func TestNotify_SlowChannelsInBackground(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	config := &Config{
+		NotificationChatID: -100,
+		Notifiers:          []NotifierConfig{{Type: "slack", URL: server.URL}, {Type: "telegram", ChatID: -300}},
+	}
+	mockBot := &MockTelegramBot{}
+
+	done := make(chan struct{})
+	go func() {
+		notify(mockBot, context.Background(), &Kiuas{}, config, nil, Notification{Event: EventReady, Key: "ready", Args: []any{75.0}, Time: time.Now()}, config.NotificationChatID)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected a hanging webhook not to block the notification")
+	}
+	// The Telegram messages are sent before notify returns
+	if len(mockBot.SentMessages) != 2 {
+		t.Errorf("Expected the Telegram messages to be sent right away, got %v", mockBot.SentMessages)
+	}
+	close(release)
+	background.Wait()
+}
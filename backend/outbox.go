@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+const (
+	// Delay before the first retry of a failed message, doubled on every attempt
+	outboxRetryDelay = 5 * time.Second
+	// Longest delay between two attempts
+	outboxMaxRetryDelay = 10 * time.Minute
+	// Messages still undelivered after this are dropped, they are no longer useful
+	outboxMaxAge = 6 * time.Hour
+	// Minimum time between two messages to a private chat and to a group,
+	// Telegram allows about one message per second to a chat and 20 per minute to a group
+	outboxPrivateInterval = time.Second
+	outboxGroupInterval   = 3 * time.Second
+)
+
+// OutboxMessage is a message waiting in the outbox
+type OutboxMessage struct {
+	ID        int64                        `json:"id"`
+	ChatID    int64                        `json:"chat_id"`
+	Text      string                       `json:"text"`
+	ParseMode models.ParseMode             `json:"parse_mode,omitempty"`
+	Keyboard  *models.InlineKeyboardMarkup `json:"keyboard,omitempty"`
+	// Notification chat messages of an event set the flag of the event on the Kiuas once delivered
+	Event       SaunaEvent `json:"event,omitempty"`
+	Created     time.Time  `json:"created"`
+	Attempts    int        `json:"attempts"`
+	NextAttempt time.Time  `json:"next_attempt"`
+}
+
+func (m *OutboxMessage) params() *bot.SendMessageParams {
+	params := &bot.SendMessageParams{ChatID: m.ChatID, Text: m.Text, ParseMode: m.ParseMode}
+	if m.Keyboard != nil {
+		params.ReplyMarkup = m.Keyboard
+	}
+	return params
+}
+
+// OutboxDelivery is a delivered or dropped message of an event
+type OutboxDelivery struct {
+	Event     SaunaEvent
+	ChatID    int64
+	MessageID int
+	Dropped   bool // the message was given up, it must not be queued again
+}
+
+// Outbox sends messages to Telegram in the background. Failed messages are retried with
+// exponential backoff, a 429 response pauses sending for the time Telegram asks and every
+// chat is rate limited. The messages to a chat are delivered in order, and pending messages
+// are saved to the data directory so that they survive a restart.
+//
+// Outbox is a TelegramBot, everything except the messages given to Enqueue goes directly to the wrapped bot.
+type Outbox struct {
+	TelegramBot `json:"-"`
+	mu          sync.Mutex
+	path        string
+	lastSent    map[int64]time.Time
+	pausedUntil time.Time
+	delivered   []OutboxDelivery
+	wake        chan struct{}
+	NextID      int64            `json:"next_id"`
+	Pending     []*OutboxMessage `json:"pending"`
+}
+
+// LoadOutbox reads the pending messages from the data directory
+func LoadOutbox(b TelegramBot, config *Config) (*Outbox, error) {
+	o := &Outbox{
+		TelegramBot: b,
+		path:        filepath.Join(config.DataDir, "outbox.json"),
+		lastSent:    make(map[int64]time.Time),
+		wake:        make(chan struct{}, 1),
+	}
+	if err := loadJSON(o.path, o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// Enqueue adds a message to the outbox and saves the outbox
+func (o *Outbox) Enqueue(msg *OutboxMessage, now time.Time) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.NextID++
+	msg.ID = o.NextID
+	msg.Created = now
+	o.Pending = append(o.Pending, msg)
+
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+	return saveJSON(o.path, o)
+}
+
+// IsPending reports whether a message of the event is waiting for delivery
+func (o *Outbox) IsPending(event SaunaEvent) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, msg := range o.Pending {
+		if msg.Event == event {
+			return true
+		}
+	}
+	return false
+}
+
+// TakeDelivered returns the messages of events delivered or dropped since the previous call
+func (o *Outbox) TakeDelivered() []OutboxDelivery {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	delivered := o.delivered
+	o.delivered = nil
+	return delivered
+}
+
+func chatInterval(chatID int64) time.Duration {
+	if chatID < 0 {
+		return outboxGroupInterval
+	}
+	return outboxPrivateInterval
+}
+
+// Pick the next message that can be sent now. Only the oldest message of a chat is
+// considered to keep the order. Otherwise returns how long to wait for the next one.
+func (o *Outbox) next(now time.Time) (*OutboxMessage, time.Duration) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	wait := outboxMaxRetryDelay
+	if now.Before(o.pausedUntil) {
+		return nil, o.pausedUntil.Sub(now)
+	}
+
+	seen := make(map[int64]bool)
+	for _, msg := range o.Pending {
+		if seen[msg.ChatID] {
+			continue
+		}
+		seen[msg.ChatID] = true
+
+		due := msg.NextAttempt
+		if last, ok := o.lastSent[msg.ChatID]; ok && last.Add(chatInterval(msg.ChatID)).After(due) {
+			due = last.Add(chatInterval(msg.ChatID))
+		}
+		if !due.After(now) {
+			return msg, 0
+		}
+		wait = min(wait, due.Sub(now))
+	}
+	return nil, wait
+}
+
+// Record the result of sending a message
+func (o *Outbox) finish(msg *OutboxMessage, sent *models.Message, err error, now time.Time) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	var tooMany *bot.TooManyRequestsError
+	switch {
+	case err == nil:
+		o.lastSent[msg.ChatID] = now
+		if msg.Event != "" {
+			o.delivered = append(o.delivered, OutboxDelivery{Event: msg.Event, ChatID: msg.ChatID, MessageID: sent.ID})
+		}
+		o.remove(msg)
+	case errors.As(err, &tooMany):
+		log.Printf("Telegram rate limit hit, retrying after %d s\n", tooMany.RetryAfter)
+		o.pausedUntil = now.Add(time.Duration(tooMany.RetryAfter) * time.Second)
+	case errors.Is(err, bot.ErrorBadRequest) || errors.Is(err, bot.ErrorForbidden) || errors.Is(err, bot.ErrorNotFound):
+		// Sending the same message again would fail the same way
+		fmt.Printf("Failed to send message: %v\n", err)
+		o.drop(msg)
+	case now.Sub(msg.Created) > outboxMaxAge:
+		log.Printf("Dropping message %d to chat %d after %d attempts: %v\n", msg.ID, msg.ChatID, msg.Attempts+1, err)
+		o.drop(msg)
+	default:
+		msg.Attempts++
+		delay := min(outboxRetryDelay<<(msg.Attempts-1), outboxMaxRetryDelay)
+		msg.NextAttempt = now.Add(delay)
+		log.Printf("Failed to send message %d (attempt %d), retrying in %s: %v\n", msg.ID, msg.Attempts, delay, err)
+	}
+
+	if err := saveJSON(o.path, o); err != nil {
+		log.Printf("Failed to save outbox: %v\n", err)
+	}
+}
+
+// Remove a message that will not be delivered. A dropped event message is reported like a
+// delivered one, otherwise the next reading would queue the same notification again.
+func (o *Outbox) drop(msg *OutboxMessage) {
+	if msg.Event != "" {
+		o.delivered = append(o.delivered, OutboxDelivery{Event: msg.Event, ChatID: msg.ChatID, Dropped: true})
+	}
+	o.remove(msg)
+}
+
+func (o *Outbox) remove(msg *OutboxMessage) {
+	for i, m := range o.Pending {
+		if m == msg {
+			o.Pending = append(o.Pending[:i], o.Pending[i+1:]...)
+			return
+		}
+	}
+}
+
+// Send every message that is due now, returns how long to wait for the next one
+func (o *Outbox) flush(ctx context.Context, now func() time.Time) time.Duration {
+	for {
+		msg, wait := o.next(now())
+		if msg == nil {
+			return wait
+		}
+		sent, err := o.TelegramBot.SendMessage(ctx, msg.params())
+		o.finish(msg, sent, err, now())
+	}
+}
+
+// Run sends the messages until the context is cancelled
+func (o *Outbox) Run(ctx context.Context) {
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-o.wake:
+		case <-timer.C:
+		}
+		timer.Reset(o.flush(ctx, time.Now))
+	}
+}
+
+// Send a message through the outbox when b is one, otherwise right away.
+// The returned message is nil when the message was queued.
+func sendOrQueue(b TelegramBot, ctx context.Context, msg *OutboxMessage) (*models.Message, error) {
+	if outbox, ok := b.(*Outbox); ok {
+		return nil, outbox.Enqueue(msg, time.Now())
+	}
+	return b.SendMessage(ctx, msg.params())
+}
+
+// Check whether a notification of the event is waiting in the outbox
+func isPending(b TelegramBot, event SaunaEvent) bool {
+	outbox, ok := b.(*Outbox)
+	return ok && outbox.IsPending(event)
+}
+
+// Commit the notification flags of the messages the outbox has delivered or dropped since the
+// last call, a dropped notification is not sent again during the session. A delivered warming
+// message also gets its ID so that it can be edited.
+func commitDelivered(b TelegramBot, kiuas *Kiuas) {
+	outbox, ok := b.(*Outbox)
+	if !ok {
+		return
+	}
+	for _, d := range outbox.TakeDelivered() {
+		switch d.Event {
+		case EventWarming:
+			kiuas.WarmingNotificationSent = true
+			if kiuas.RSVP != nil && kiuas.RSVP.MessageID == 0 && !d.Dropped {
+				kiuas.RSVP.MessageID = d.MessageID
+			}
+		case EventReady:
+			kiuas.ReadyNotificationSent = true
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+)
+
+func newTestOutbox(t *testing.T, b TelegramBot) *Outbox {
+	t.Helper()
+	outbox, err := LoadOutbox(b, &Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return outbox
+}
+
+func at(t time.Time) func() time.Time {
+	return func() time.Time { return t }
+}
+
+func TestOutbox_RetryWithBackoff(t *testing.T) {
+	start := time.Date(2024, 12, 24, 17, 0, 0, 0, time.UTC)
+	mockBot := &MockTelegramBot{SendErrors: []error{errors.New("connection reset"), errors.New("connection reset")}}
+	outbox := newTestOutbox(t, mockBot)
+	ctx := context.Background()
+
+	outbox.Enqueue(&OutboxMessage{ChatID: 42, Text: "Sauna valmis"}, start)
+
+	if wait := outbox.flush(ctx, at(start)); wait != 5*time.Second {
+		t.Errorf("Expected first retry after 5s, got %s", wait)
+	}
+	if wait := outbox.flush(ctx, at(start.Add(5*time.Second))); wait != 10*time.Second {
+		t.Errorf("Expected second retry after 10s, got %s", wait)
+	}
+	outbox.flush(ctx, at(start.Add(15*time.Second)))
+
+	if len(mockBot.SentMessages) != 1 || len(outbox.Pending) != 0 {
+		t.Errorf("Expected the message to be delivered on the third attempt, sent %v, pending %d", mockBot.SentMessages, len(outbox.Pending))
+	}
+}
+
+func TestOutbox_TooManyRequests(t *testing.T) {
+	start := time.Date(2024, 12, 24, 17, 0, 0, 0, time.UTC)
+	mockBot := &MockTelegramBot{SendErrors: []error{&bot.TooManyRequestsError{Message: "too many requests", RetryAfter: 30}}}
+	outbox := newTestOutbox(t, mockBot)
+	ctx := context.Background()
+
+	outbox.Enqueue(&OutboxMessage{ChatID: 1, Text: "first"}, start)
+	outbox.Enqueue(&OutboxMessage{ChatID: 2, Text: "second"}, start)
+
+	if wait := outbox.flush(ctx, at(start)); wait != 30*time.Second {
+		t.Errorf("Expected to wait retry_after, got %s", wait)
+	}
+	if len(mockBot.SentMessages) != 0 {
+		t.Errorf("Expected nothing to be sent while paused, got %v", mockBot.SentMessages)
+	}
+
+	outbox.flush(ctx, at(start.Add(30*time.Second)))
+	if len(mockBot.SentMessages) != 2 || mockBot.SentMessages[0] != "first" {
+		t.Errorf("Expected both messages in order after the pause, got %v", mockBot.SentMessages)
+	}
+}
+
+func TestOutbox_ChatRateLimit(t *testing.T) {
+	start := time.Date(2024, 12, 24, 17, 0, 0, 0, time.UTC)
+	mockBot := &MockTelegramBot{}
+	outbox := newTestOutbox(t, mockBot)
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		outbox.Enqueue(&OutboxMessage{ChatID: -100, Text: fmt.Sprintf("group %d", i)}, start)
+	}
+	outbox.Enqueue(&OutboxMessage{ChatID: 42, Text: "private"}, start)
+
+	if wait := outbox.flush(ctx, at(start)); wait != outboxGroupInterval {
+		t.Errorf("Expected to wait for the group interval, got %s", wait)
+	}
+	if len(mockBot.SentMessages) != 2 || mockBot.SentMessages[0] != "group 1" || mockBot.SentMessages[1] != "private" {
+		t.Fatalf("Expected one message to each chat, got %v", mockBot.SentMessages)
+	}
+
+	outbox.flush(ctx, at(start.Add(time.Second)))
+	if len(mockBot.SentMessages) != 2 {
+		t.Errorf("Expected the group to be rate limited, got %v", mockBot.SentMessages)
+	}
+	outbox.flush(ctx, at(start.Add(outboxGroupInterval)))
+	outbox.flush(ctx, at(start.Add(2*outboxGroupInterval)))
+	if len(mockBot.SentMessages) != 4 || mockBot.SentMessages[3] != "group 3" {
+		t.Errorf("Expected the group messages in order, got %v", mockBot.SentMessages)
+	}
+}
+
+func TestOutbox_DropsUndeliverable(t *testing.T) {
+	start := time.Date(2024, 12, 24, 17, 0, 0, 0, time.UTC)
+	mockBot := &MockTelegramBot{SendErrors: []error{
+		fmt.Errorf("%w, can't parse entities", bot.ErrorBadRequest),
+		errors.New("connection reset"),
+	}}
+	outbox := newTestOutbox(t, mockBot)
+	ctx := context.Background()
+
+	outbox.Enqueue(&OutboxMessage{ChatID: 1, Text: "broken"}, start)
+	outbox.flush(ctx, at(start))
+	if len(outbox.Pending) != 0 {
+		t.Errorf("Expected a bad request not to be retried")
+	}
+
+	outbox.Enqueue(&OutboxMessage{ChatID: 1, Text: "old"}, start)
+	outbox.flush(ctx, at(start.Add(outboxMaxAge+time.Minute)))
+	if len(outbox.Pending) != 0 || len(mockBot.SentMessages) != 0 {
+		t.Errorf("Expected a message older than outboxMaxAge to be dropped")
+	}
+}
+
+func TestOutbox_Persistence(t *testing.T) {
+	start := time.Date(2024, 12, 24, 17, 0, 0, 0, time.UTC)
+	outbox := newTestOutbox(t, &MockTelegramBot{})
+	outbox.Enqueue(&OutboxMessage{ChatID: -100, Text: "Sauna valmis", Event: EventReady}, start)
+
+	mockBot := &MockTelegramBot{}
+	loaded, err := LoadOutbox(mockBot, &Config{DataDir: filepath.Dir(outbox.path)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Pending) != 1 || !loaded.IsPending(EventReady) {
+		t.Fatalf("Expected the pending message to be loaded, got %+v", loaded.Pending)
+	}
+
+	loaded.flush(context.Background(), at(start))
+	if len(mockBot.SentMessages) != 1 {
+		t.Errorf("Expected the loaded message to be sent")
+	}
+	loaded.Enqueue(&OutboxMessage{ChatID: 1, Text: "next"}, start)
+	if loaded.Pending[0].ID != 2 {
+		t.Errorf("Expected message IDs to continue after a restart, got %d", loaded.Pending[0].ID)
+	}
+}
+
+func TestCheckAndNotify_FlagsCommittedAfterDelivery(t *testing.T) {
+	currentTime := time.Date(2024, 12, 24, 18, 0, 0, 0, time.UTC)
+	kiuas := &Kiuas{Temperature: 80.0}
+	config := &Config{ReadyThreshold: 75.0, ResetThreshold: 40.0, NotificationChatID: -100}
+	mockBot := &MockTelegramBot{SendErrors: []error{errors.New("connection reset")}}
+	outbox := newTestOutbox(t, mockBot)
+	ctx := context.Background()
+
+	checkAndNotify(outbox, ctx, kiuas, config, nil, nil, currentTime)
+	if kiuas.ReadyNotificationSent || !outbox.IsPending(EventReady) {
+		t.Fatalf("Expected the ready notification to wait in the outbox")
+	}
+
+	// Sending fails, the flag stays unset and the notification is not queued again
+	outbox.flush(ctx, at(currentTime))
+	checkAndNotify(outbox, ctx, kiuas, config, nil, nil, currentTime.Add(time.Second))
+	if kiuas.ReadyNotificationSent || len(outbox.Pending) != 1 {
+		t.Fatalf("Expected one undelivered notification, got %d", len(outbox.Pending))
+	}
+
+	outbox.flush(ctx, at(currentTime.Add(outboxRetryDelay)))
+	checkAndNotify(outbox, ctx, kiuas, config, nil, nil, currentTime.Add(outboxRetryDelay))
+	if !kiuas.ReadyNotificationSent || len(mockBot.SentMessages) != 1 {
+		t.Errorf("Expected the flag to be set after delivery, sent %v", mockBot.SentMessages)
+	}
+}
+
+func TestCheckAndNotify_WarmingMessageIDAfterDelivery(t *testing.T) {
+	currentTime := time.Now()
+	kiuas := &Kiuas{
+		Temperature:        60.0,
+		TemperatureRecords: [3]float64{50.0, 55.0, 60.0},
+		TimestampRecords:   [3]time.Time{currentTime.Add(-3 * time.Minute), currentTime.Add(-2 * time.Minute), currentTime.Add(-1 * time.Minute)},
+	}
+	config := &Config{ReadyThreshold: 70.0, WarmingThreshold: 30.0, LowerBound: 0.001, ResetThreshold: 25.0, NotificationChatID: -100}
+	mockBot := &MockTelegramBot{}
+	outbox := newTestOutbox(t, mockBot)
+	ctx := context.Background()
+
+	checkAndNotify(outbox, ctx, kiuas, config, nil, nil, currentTime)
+	if kiuas.WarmingNotificationSent || kiuas.RSVP == nil || kiuas.RSVP.MessageID != 0 {
+		t.Fatalf("Expected a pending warming message, got %+v", kiuas.RSVP)
+	}
+
+	outbox.flush(ctx, at(currentTime))
+	checkAndNotify(outbox, ctx, kiuas, config, nil, nil, currentTime)
+	if !kiuas.WarmingNotificationSent || kiuas.RSVP.MessageID != 1 || len(mockBot.SentMessages) != 1 {
+		t.Errorf("Expected the delivered message to be used for the RSVP, got %+v", kiuas.RSVP)
+	}
+}
+
+func TestCheckAndNotify_FailedReadyEditQueued(t *testing.T) {
+	currentTime := time.Date(2024, 12, 24, 18, 0, 0, 0, time.UTC)
+	kiuas := &Kiuas{Temperature: 80.0, WarmingNotificationSent: true, RSVP: &RSVP{ChatID: -100, MessageID: 7}}
+	config := &Config{ReadyThreshold: 75.0, ResetThreshold: 40.0, NotificationChatID: -100, WarmingUpdateInterval: time.Minute}
+	mockBot := &MockTelegramBot{EditErrors: []error{errors.New("connection reset")}}
+	outbox := newTestOutbox(t, mockBot)
+	ctx := context.Background()
+
+	// The live message cannot be edited, the ready message is queued instead of being lost
+	checkAndNotify(outbox, ctx, kiuas, config, nil, nil, currentTime)
+	if kiuas.ReadyNotificationSent || !outbox.IsPending(EventReady) {
+		t.Fatalf("Expected the ready message to wait in the outbox after the failed edit")
+	}
+
+	outbox.flush(ctx, at(currentTime))
+	checkAndNotify(outbox, ctx, kiuas, config, nil, nil, currentTime.Add(time.Second))
+	if !kiuas.ReadyNotificationSent || len(mockBot.SentMessages) != 1 || !strings.Contains(mockBot.SentMessages[0], "Sauna valmis") {
+		t.Errorf("Expected the ready message to be delivered once, got %v", mockBot.SentMessages)
+	}
+}
+
+func TestCheckAndNotify_DroppedNotificationNotRepeated(t *testing.T) {
+	currentTime := time.Date(2024, 12, 24, 18, 0, 0, 0, time.UTC)
+	kiuas := &Kiuas{Temperature: 80.0}
+	config := &Config{ReadyThreshold: 75.0, ResetThreshold: 40.0, NotificationChatID: -100}
+	mockBot := &MockTelegramBot{SendErrors: []error{fmt.Errorf("%w, can't parse entities", bot.ErrorBadRequest)}}
+	outbox := newTestOutbox(t, mockBot)
+	ctx := context.Background()
+
+	checkAndNotify(outbox, ctx, kiuas, config, nil, nil, currentTime)
+	outbox.flush(ctx, at(currentTime))
+	if len(outbox.Pending) != 0 {
+		t.Fatalf("Expected the bad request to be dropped")
+	}
+
+	// The dropped notification counts as sent for the rest of the session
+	checkAndNotify(outbox, ctx, kiuas, config, nil, nil, currentTime.Add(time.Second))
+	if !kiuas.ReadyNotificationSent || len(outbox.Pending) != 0 {
+		t.Errorf("Expected the ready notification not to be queued again, got %d pending", len(outbox.Pending))
+	}
+
+	// A warming message that is too old is dropped the same way, without an ID for the RSVP
+	outbox.Enqueue(&OutboxMessage{ChatID: -100, Text: "Sauna lämpiää", Event: EventWarming}, currentTime)
+	mockBot.SendErrors = []error{errors.New("connection reset")}
+	outbox.flush(ctx, at(currentTime.Add(outboxMaxAge+time.Minute)))
+	kiuas.RSVP = &RSVP{}
+	commitDelivered(outbox, kiuas)
+	if !kiuas.WarmingNotificationSent || kiuas.RSVP.MessageID != 0 {
+		t.Errorf("Expected the dropped warming message to set the flag only, got %+v", kiuas.RSVP)
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// How long past reservations are kept
+const reservationHistoryLength = 30 * 24 * time.Hour
+
+// Reservation is a private turn in the sauna
+type Reservation struct {
+	ID       int       `json:"id"`
+	UserID   int64     `json:"user_id"`
+	Name     string    `json:"name"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	Reminded bool      `json:"reminded"`
+}
+
+func (r Reservation) String() string {
+	return fmt.Sprintf("#%d %s %s-%s %s", r.ID, r.Start.Format("2.1."), r.Start.Format("15:04"), r.End.Format("15:04"), r.Name)
+}
+
+// Reservations are saved to the data directory
+type Reservations struct {
+	mu           sync.RWMutex
+	path         string
+	NextID       int           `json:"next_id"`
+	Reservations []Reservation `json:"reservations"`
+}
+
+var (
+	ErrReservationConflict = errors.New("reservation overlaps an existing one")
+	ErrReservationNotFound = errors.New("reservation not found")
+)
+
+// LoadReservations reads the saved reservations from the data directory
+func LoadReservations(config *Config) (*Reservations, error) {
+	r := &Reservations{
+		path:   filepath.Join(config.DataDir, "reservations.json"),
+		NextID: 1,
+	}
+	if err := loadJSON(r.path, r); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Add a reservation if it does not overlap an existing one
+func (r *Reservations) Add(res Reservation, now time.Time) (Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.Reservations {
+		if res.Start.Before(existing.End) && existing.Start.Before(res.End) {
+			return existing, ErrReservationConflict
+		}
+	}
+
+	res.ID = r.NextID
+	r.NextID++
+	r.Reservations = append(r.Reservations, res)
+	slices.SortFunc(r.Reservations, func(a, b Reservation) int { return a.Start.Compare(b.Start) })
+	r.prune(now)
+	return res, saveJSON(r.path, r)
+}
+
+// Cancel removes a reservation. Only the owner can cancel unless force is set.
+func (r *Reservations) Cancel(id int, userID int64, force bool) (Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, res := range r.Reservations {
+		if res.ID != id {
+			continue
+		}
+		if res.UserID != userID && !force {
+			return res, &MessageError{Key: "reservation_not_owned", Args: []any{id}}
+		}
+		r.Reservations = slices.Delete(r.Reservations, i, i+1)
+		return res, saveJSON(r.path, r)
+	}
+	return Reservation{}, ErrReservationNotFound
+}
+
+// Drop reservations that ended more than reservationHistoryLength ago
+func (r *Reservations) prune(now time.Time) {
+	r.Reservations = slices.DeleteFunc(r.Reservations, func(res Reservation) bool {
+		return now.Sub(res.End) > reservationHistoryLength
+	})
+}
+
+// Upcoming returns the reservations that have not ended yet
+func (r *Reservations) Upcoming(now time.Time) []Reservation {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	var upcoming []Reservation
+	for _, res := range r.Reservations {
+		if res.End.After(now) {
+			upcoming = append(upcoming, res)
+		}
+	}
+	return upcoming
+}
+
+// All returns a copy of every stored reservation, including the past ones
+func (r *Reservations) All() []Reservation {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return slices.Clone(r.Reservations)
+}
+
+// Current returns the reservation in progress at the given time
+func (r *Reservations) Current(now time.Time) (Reservation, bool) {
+	if r == nil {
+		return Reservation{}, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, res := range r.Reservations {
+		if !now.Before(res.Start) && now.Before(res.End) {
+			return res, true
+		}
+	}
+	return Reservation{}, false
+}
+
+// Mark the reservations starting within the given duration as reminded and return them
+func (r *Reservations) dueReminders(now time.Time, before time.Duration) ([]Reservation, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var due []Reservation
+	for i, res := range r.Reservations {
+		if !res.Reminded && res.Start.After(now) && res.Start.Sub(now) <= before {
+			r.Reservations[i].Reminded = true
+			due = append(due, res)
+		}
+	}
+	if len(due) == 0 {
+		return nil, nil
+	}
+	return due, saveJSON(r.path, r)
+}
+
+// Parse a date like 24.12., 24.12.2024, tänään or huomenna, also in Swedish and English
+func parseReservationDate(value string, now time.Time) (time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch strings.ToLower(value) {
+	case "tänään", "tanaan", "idag", "today":
+		return today, nil
+	case "huomenna", "imorgon", "tomorrow":
+		return today.AddDate(0, 0, 1), nil
+	}
+	invalid := &MessageError{Key: "reservation_invalid_date", Args: []any{value}}
+
+	parts := strings.Split(strings.TrimSuffix(value, "."), ".")
+	if len(parts) < 2 || len(parts) > 3 {
+		return time.Time{}, invalid
+	}
+	numbers := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			return time.Time{}, invalid
+		}
+		numbers[i] = n
+	}
+
+	year := now.Year()
+	if len(numbers) == 3 {
+		year = numbers[2]
+	}
+	date := time.Date(year, time.Month(numbers[1]), numbers[0], 0, 0, 0, 0, now.Location())
+	if date.Day() != numbers[0] || int(date.Month()) != numbers[1] {
+		return time.Time{}, invalid
+	}
+	// A date without a year that has already passed means next year
+	if len(numbers) == 2 && date.Before(today) {
+		date = date.AddDate(1, 0, 0)
+	}
+	return date, nil
+}
+
+// Parse a time of day like 18 or 18:30 into an offset from midnight
+func parseClock(value string) (time.Duration, error) {
+	hourStr, minuteStr, hasMinutes := strings.Cut(value, ":")
+	hour, err := strconv.Atoi(hourStr)
+	if err != nil || hour < 0 || hour > 24 {
+		return 0, &MessageError{Key: "reservation_invalid_clock", Args: []any{value}}
+	}
+	minute := 0
+	if hasMinutes {
+		minute, err = strconv.Atoi(minuteStr)
+		if err != nil || minute < 0 || minute > 59 {
+			return 0, &MessageError{Key: "reservation_invalid_clock", Args: []any{value}}
+		}
+	}
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute, nil
+}
+
+// Parse the arguments of /varaa <pvm> <klo>-<klo>
+func parseReservation(date, clock string, now time.Time, config *Config) (start, end time.Time, err error) {
+	day, err := parseReservationDate(date, now)
+	if err != nil {
+		return
+	}
+	startStr, endStr, ok := strings.Cut(clock, "-")
+	if !ok {
+		err = &MessageError{Key: "reservation_clock_format"}
+		return
+	}
+	startOffset, err := parseClock(startStr)
+	if err != nil {
+		return
+	}
+	endOffset, err := parseClock(endStr)
+	if err != nil {
+		return
+	}
+
+	start = day.Add(startOffset)
+	end = day.Add(endOffset)
+	switch {
+	case !end.After(start):
+		err = &MessageError{Key: "reservation_end_before_start"}
+	case end.Before(now):
+		err = &MessageError{Key: "reservation_in_past"}
+	case config.ReservationMaxDuration > 0 && end.Sub(start) > config.ReservationMaxDuration:
+		err = &MessageError{Key: "reservation_too_long", Args: []any{formatDuration(config.ReservationMaxDuration)}}
+	}
+	return
+}
+
+func displayName(user *models.User) string {
+	if user.Username != "" {
+		return "@" + user.Username
+	}
+	return strings.TrimSpace(user.FirstName + " " + user.LastName)
+}
+
+// Handler for /varaa <pvm> <klo>-<klo>
+func handleReserveCommand(ctx context.Context, b TelegramBot, config *Config, reservations *Reservations, langs *Languages, update *models.Update, now time.Time) {
+	if update.Message.From == nil {
+		return
+	}
+	locale := langs.For(config, update.Message.Chat.ID)
+	args := strings.Fields(update.Message.Text)[1:]
+	if len(args) != 2 {
+		replyText(ctx, b, update, locale.T("reserve_usage"))
+		return
+	}
+
+	start, end, err := parseReservation(args[0], args[1], now, config)
+	if err != nil {
+		replyText(ctx, b, update, locale.Error(err))
+		return
+	}
+
+	res, err := reservations.Add(Reservation{
+		UserID: update.Message.From.ID,
+		Name:   displayName(update.Message.From),
+		Start:  start,
+		End:    end,
+	}, now)
+	if errors.Is(err, ErrReservationConflict) {
+		replyText(ctx, b, update, locale.T("reserve_conflict", res))
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to save reservations: %v\n", err)
+		replyText(ctx, b, update, locale.T("reserve_failed"))
+		return
+	}
+
+	log.Printf("Reservation %s added by %s\n", res, userName(update.Message.From))
+	replyText(ctx, b, update, locale.T("reserve_done", res))
+}
+
+// Handler for /varaukset
+func handleReservationsCommand(ctx context.Context, b TelegramBot, config *Config, reservations *Reservations, langs *Languages, update *models.Update, now time.Time) {
+	locale := langs.For(config, update.Message.Chat.ID)
+	upcoming := reservations.Upcoming(now)
+	if len(upcoming) == 0 {
+		replyText(ctx, b, update, locale.T("reservations_none"))
+		return
+	}
+	lines := make([]string, len(upcoming))
+	for i, res := range upcoming {
+		lines[i] = res.String()
+	}
+	replyText(ctx, b, update, locale.T("reservations", strings.Join(lines, "\n")))
+}
+
+// Handler for /peruvaraus <id>. Admins can cancel any reservation.
+func handleCancelReservationCommand(ctx context.Context, b TelegramBot, config *Config, auth *Authorizer, reservations *Reservations, langs *Languages, update *models.Update) {
+	if update.Message.From == nil {
+		return
+	}
+	locale := langs.For(config, update.Message.Chat.ID)
+	args := strings.Fields(update.Message.Text)[1:]
+	id := 0
+	if len(args) == 1 {
+		id, _ = strconv.Atoi(strings.TrimPrefix(args[0], "#"))
+	}
+	if id == 0 {
+		replyText(ctx, b, update, locale.T("cancel_reservation_usage"))
+		return
+	}
+
+	userID, chatID := updateIDs(update)
+	res, err := reservations.Cancel(id, userID, auth.RoleFor(userID, chatID) >= RoleAdmin)
+	if errors.Is(err, ErrReservationNotFound) {
+		replyText(ctx, b, update, locale.T("reservation_not_found", id))
+		return
+	}
+	if err != nil {
+		replyText(ctx, b, update, locale.Error(err))
+		return
+	}
+
+	log.Printf("Reservation %s cancelled by %s\n", res, userName(update.Message.From))
+	replyText(ctx, b, update, locale.T("reservation_cancelled", res))
+}
+
+// Send a direct message to the owner of every reservation that starts within ReservationReminder
+func sendReservationReminders(b TelegramBot, ctx context.Context, config *Config, langs *Languages, reservations *Reservations, now time.Time) {
+	if config.ReservationReminder <= 0 {
+		return
+	}
+	due, err := reservations.dueReminders(now, config.ReservationReminder)
+	if err != nil {
+		log.Printf("Failed to save reservations: %v\n", err)
+	}
+	for _, res := range due {
+		sendLocalized(b, ctx, config, langs, res.UserID, "reservation_reminder", res.Start.Format("15:04"))
+	}
+}
+
+func monitorReservations(b TelegramBot, ctx context.Context, configs *ConfigStore, langs *Languages, reservations *Reservations) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			sendReservationReminders(b, ctx, configs.Load(), langs, reservations, time.Now())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
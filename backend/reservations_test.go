@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestReservations(t *testing.T) *Reservations {
+	t.Helper()
+	reservations, err := LoadReservations(&Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return reservations
+}
+
+func TestParseReservation(t *testing.T) {
+	now := time.Date(2024, 12, 20, 12, 0, 0, 0, time.Local)
+	config := &Config{ReservationMaxDuration: 4 * time.Hour}
+
+	start, end, err := parseReservation("24.12.", "18-20:30", now, config)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !start.Equal(time.Date(2024, 12, 24, 18, 0, 0, 0, time.Local)) || !end.Equal(time.Date(2024, 12, 24, 20, 30, 0, 0, time.Local)) {
+		t.Errorf("Unexpected reservation %s - %s", start, end)
+	}
+
+	// A passed date without a year is next year
+	start, _, err = parseReservation("2.1", "18-20", now, config)
+	if err != nil || start.Year() != 2025 {
+		t.Errorf("Expected reservation next year, got %s (%v)", start, err)
+	}
+
+	start, _, err = parseReservation("huomenna", "17:30-19", now, config)
+	if err != nil || !start.Equal(time.Date(2024, 12, 21, 17, 30, 0, 0, time.Local)) {
+		t.Errorf("Expected reservation tomorrow, got %s (%v)", start, err)
+	}
+
+	invalid := [][2]string{
+		{"24.12.", "20-18"},
+		{"24.12.", "12-18"},
+		{"tänään", "8-10"},
+		{"31.2.", "18-20"},
+		{"joulu", "18-20"},
+		{"24.12.", "18"},
+	}
+	for _, args := range invalid {
+		if _, _, err := parseReservation(args[0], args[1], now, config); err == nil {
+			t.Errorf("Expected %v to be rejected", args)
+		}
+	}
+}
+
+func TestReservations_Conflict(t *testing.T) {
+	reservations := newTestReservations(t)
+	now := time.Date(2024, 12, 20, 12, 0, 0, 0, time.Local)
+	start := time.Date(2024, 12, 24, 18, 0, 0, 0, time.Local)
+
+	if _, err := reservations.Add(Reservation{UserID: 1, Start: start, End: start.Add(2 * time.Hour)}, now); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := reservations.Add(Reservation{UserID: 2, Start: start.Add(time.Hour), End: start.Add(3 * time.Hour)}, now); !errors.Is(err, ErrReservationConflict) {
+		t.Errorf("Expected conflict, got %v", err)
+	}
+	// Back to back reservations are fine
+	if _, err := reservations.Add(Reservation{UserID: 2, Start: start.Add(2 * time.Hour), End: start.Add(3 * time.Hour)}, now); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if current, ok := reservations.Current(start.Add(30 * time.Minute)); !ok || current.UserID != 1 {
+		t.Errorf("Expected current reservation of user 1, got %v", current)
+	}
+}
+
+func TestReservations_Cancel(t *testing.T) {
+	reservations := newTestReservations(t)
+	now := time.Date(2024, 12, 20, 12, 0, 0, 0, time.Local)
+	start := time.Date(2024, 12, 24, 18, 0, 0, 0, time.Local)
+
+	res, err := reservations.Add(Reservation{UserID: 1, Start: start, End: start.Add(2 * time.Hour)}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := reservations.Cancel(res.ID, 2, false); err == nil {
+		t.Errorf("Expected other users not to be able to cancel")
+	}
+	if _, err := reservations.Cancel(res.ID, 1, false); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if _, err := reservations.Cancel(res.ID, 1, false); !errors.Is(err, ErrReservationNotFound) {
+		t.Errorf("Expected not found, got %v", err)
+	}
+}
+
+func TestSendReservationReminders(t *testing.T) {
+	reservations := newTestReservations(t)
+	now := time.Date(2024, 12, 24, 17, 0, 0, 0, time.Local)
+	start := time.Date(2024, 12, 24, 18, 0, 0, 0, time.Local)
+
+	if _, err := reservations.Add(Reservation{UserID: 42, Start: start, End: start.Add(2 * time.Hour)}, now); err != nil {
+		t.Fatal(err)
+	}
+
+	mockBot := &MockTelegramBot{}
+	config := &Config{ReservationReminder: 30 * time.Minute}
+	ctx := context.Background()
+
+	sendReservationReminders(mockBot, ctx, config, nil, reservations, now)
+	if len(mockBot.SentMessages) != 0 {
+		t.Fatalf("Expected no reminder an hour before, got %d", len(mockBot.SentMessages))
+	}
+
+	sendReservationReminders(mockBot, ctx, config, nil, reservations, start.Add(-20*time.Minute))
+	sendReservationReminders(mockBot, ctx, config, nil, reservations, start.Add(-10*time.Minute))
+	if len(mockBot.SentMessages) != 1 || mockBot.SentChatIDs[0] != int64(42) {
+		t.Fatalf("Expected one reminder to the owner, got %v", mockBot.SentChatIDs)
+	}
+}
+
+func TestHandleReserveCommand(t *testing.T) {
+	reservations := newTestReservations(t)
+	now := time.Date(2024, 12, 20, 12, 0, 0, 0, time.Local)
+	mockBot := &MockTelegramBot{}
+	config := &Config{ReservationMaxDuration: 4 * time.Hour}
+	ctx := context.Background()
+
+	handleReserveCommand(ctx, mockBot, config, reservations, nil, newCommandUpdate(42, "/varaa 24.12. 18-20"), now)
+	handleReserveCommand(ctx, mockBot, config, reservations, nil, newCommandUpdate(43, "/varaa 24.12. 19-21"), now)
+
+	upcoming := reservations.Upcoming(now)
+	if len(upcoming) != 1 || upcoming[0].Name != "@tonttu" {
+		t.Fatalf("Expected one reservation by @tonttu, got %v", upcoming)
+	}
+	if len(mockBot.SentMessages) != 2 {
+		t.Errorf("Expected a reply to both commands, got %d", len(mockBot.SentMessages))
+	}
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+// Role of a Telegram user or chat, higher roles include the rights of the lower ones
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleMember
+	RoleMaintainer
+	RoleAdmin
+)
+
+var roleNames = map[Role]string{
+	RoleNone:       "ei roolia",
+	RoleMember:     "jasen",
+	RoleMaintainer: "yllapitaja",
+	RoleAdmin:      "admin",
+}
+
+func (r Role) String() string {
+	return roleNames[r]
+}
+
+func (r Role) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Role) UnmarshalText(text []byte) error {
+	role, err := ParseRole(string(text))
+	if err != nil {
+		return err
+	}
+	*r = role
+	return nil
+}
+
+// ParseRole accepts both the Finnish and the English role names
+func ParseRole(name string) (Role, error) {
+	switch strings.ToLower(name) {
+	case "jasen", "jäsen", "member":
+		return RoleMember, nil
+	case "yllapitaja", "ylläpitäjä", "maintainer":
+		return RoleMaintainer, nil
+	case "admin":
+		return RoleAdmin, nil
+	}
+	return RoleNone, fmt.Errorf("tuntematon rooli %q", name)
+}
+
+// Authorizer maps Telegram user and chat IDs to roles. Group chat IDs are negative,
+// so both share one map. The maintenance chat is always admin and the notification chat member.
+type Authorizer struct {
+	mu      sync.RWMutex
+	configs *ConfigStore
+	Roles   map[int64]Role `json:"roles"`
+}
+
+func rolesPath(config *Config) string {
+	return filepath.Join(config.DataDir, "roles.json")
+}
+
+// LoadAuthorizer reads the saved roles from the data directory
+func LoadAuthorizer(configs *ConfigStore) (*Authorizer, error) {
+	a := &Authorizer{configs: configs, Roles: make(map[int64]Role)}
+	if err := loadJSON(rolesPath(configs.Load()), a); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+func (a *Authorizer) save() error {
+	return saveJSON(rolesPath(a.configs.Load()), a)
+}
+
+// RoleFor returns the highest role of the user and the chat the message was sent in
+func (a *Authorizer) RoleFor(userID, chatID int64) Role {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	config := a.configs.Load()
+	role := max(a.Roles[userID], a.Roles[chatID])
+	switch chatID {
+	case config.MaintenanceChatID:
+		role = max(role, RoleAdmin)
+	case config.NotificationChatID:
+		role = max(role, RoleMember)
+	}
+	return role
+}
+
+// SetRole gives the role to a user or a chat, RoleNone removes it
+func (a *Authorizer) SetRole(id int64, role Role) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if role == RoleNone {
+		delete(a.Roles, id)
+	} else {
+		a.Roles[id] = role
+	}
+	return a.save()
+}
+
+// Return the roles sorted by ID for listing
+func (a *Authorizer) list() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	ids := make([]int64, 0, len(a.Roles))
+	for id := range a.Roles {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+
+	lines := make([]string, 0, len(ids))
+	for _, id := range ids {
+		lines = append(lines, fmt.Sprintf("%d: %s", id, a.Roles[id]))
+	}
+	return lines
+}
+
+// Return the IDs of the sender and the chat of an update
+func updateIDs(update *models.Update) (userID, chatID int64) {
+	switch {
+	case update.Message != nil:
+		if update.Message.From != nil {
+			userID = update.Message.From.ID
+		}
+		return userID, update.Message.Chat.ID
+	case update.CallbackQuery != nil:
+		// The message of a callback query is inaccessible if it is too old
+		if msg := update.CallbackQuery.Message.Message; msg != nil {
+			chatID = msg.Chat.ID
+		}
+		return update.CallbackQuery.From.ID, chatID
+	}
+	return 0, 0
+}
+
+// RequireRole wraps a handler so that it only runs for users or chats with at least the given role
+func RequireRole(auth *Authorizer, role Role, handler bot.HandlerFunc) bot.HandlerFunc {
+	return func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		userID, chatID := updateIDs(update)
+		if (update.Message == nil && update.CallbackQuery == nil) || auth.RoleFor(userID, chatID) < role {
+			log.Printf("Denied update from user %d in chat %d, requires %s\n", userID, chatID, role)
+			return
+		}
+		handler(ctx, b, update)
+	}
+}
+
+// Handler for /roolit, /roolit aseta <id> <rooli> and /roolit poista <id>.
+// When replying to a message the id can be left out to use the sender of that message.
+func handleRolesCommand(ctx context.Context, b TelegramBot, config *Config, auth *Authorizer, langs *Languages, update *models.Update) {
+	locale := langs.For(config, update.Message.Chat.ID)
+	args := strings.Fields(update.Message.Text)[1:]
+
+	if len(args) == 0 {
+		lines := auth.list()
+		if len(lines) == 0 {
+			replyText(ctx, b, update, locale.T("roles_none", locale.T("roles_usage")))
+			return
+		}
+		replyText(ctx, b, update, locale.T("roles", strings.Join(lines, "\n")))
+		return
+	}
+
+	var target int64
+	if reply := update.Message.ReplyToMessage; reply != nil && reply.From != nil {
+		target = reply.From.ID
+	}
+	if (args[0] == "aseta" && len(args) == 3) || (args[0] == "poista" && len(args) == 2) {
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			replyText(ctx, b, update, locale.T("roles_invalid_id", args[1]))
+			return
+		}
+		target = id
+		args = slices.Delete(args, 1, 2)
+	}
+	if target == 0 {
+		replyText(ctx, b, update, locale.T("roles_usage"))
+		return
+	}
+
+	role := RoleNone
+	switch {
+	case args[0] == "aseta" && len(args) == 2:
+		r, err := ParseRole(args[1])
+		if err != nil {
+			replyText(ctx, b, update, locale.T("roles_unknown", args[1]))
+			return
+		}
+		role = r
+	case args[0] == "poista" && len(args) == 1:
+	default:
+		replyText(ctx, b, update, locale.T("roles_usage"))
+		return
+	}
+
+	if err := auth.SetRole(target, role); err != nil {
+		log.Printf("Failed to save roles: %v\n", err)
+		replyText(ctx, b, update, locale.T("roles_failed"))
+		return
+	}
+	log.Printf("Role of %d set to %s by %s\n", target, role, userName(update.Message.From))
+	replyText(ctx, b, update, fmt.Sprintf("%d: %s", target, role))
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+)
+
+func newTestAuthorizer(t *testing.T) *Authorizer {
+	t.Helper()
+	config := &Config{MaintenanceChatID: -100, NotificationChatID: -200, DataDir: t.TempDir()}
+	auth, err := LoadAuthorizer(NewConfigStore(config))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return auth
+}
+
+func TestAuthorizer_RoleFor(t *testing.T) {
+	auth := newTestAuthorizer(t)
+
+	if role := auth.RoleFor(1, -100); role != RoleAdmin {
+		t.Errorf("Expected maintenance chat to be admin, got %s", role)
+	}
+	if role := auth.RoleFor(1, -200); role != RoleMember {
+		t.Errorf("Expected notification chat to be member, got %s", role)
+	}
+	if role := auth.RoleFor(1, 1); role != RoleNone {
+		t.Errorf("Expected unknown user to have no role, got %s", role)
+	}
+
+	if err := auth.SetRole(1, RoleMaintainer); err != nil {
+		t.Fatal(err)
+	}
+	if role := auth.RoleFor(1, 1); role != RoleMaintainer {
+		t.Errorf("Expected user role in a private chat, got %s", role)
+	}
+	if role := auth.RoleFor(1, -100); role != RoleAdmin {
+		t.Errorf("Expected the higher of user and chat role, got %s", role)
+	}
+}
+
+func TestAuthorizer_Persisted(t *testing.T) {
+	auth := newTestAuthorizer(t)
+	if err := auth.SetRole(7, RoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+	if err := auth.SetRole(-300, RoleMember); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadAuthorizer(auth.configs)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if loaded.RoleFor(7, 7) != RoleAdmin || loaded.RoleFor(8, -300) != RoleMember {
+		t.Errorf("Expected roles to be loaded from disk, got %v", loaded.Roles)
+	}
+}
+
+func TestRequireRole(t *testing.T) {
+	auth := newTestAuthorizer(t)
+
+	called := false
+	handler := RequireRole(auth, RoleAdmin, func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		called = true
+	})
+
+	handler(context.Background(), nil, newCommandUpdate(-200, "/aseta valmis 75"))
+	if called {
+		t.Errorf("Expected handler not to be called for a member")
+	}
+
+	handler(context.Background(), nil, newCommandUpdate(-100, "/aseta valmis 75"))
+	if !called {
+		t.Errorf("Expected handler to be called in the maintenance chat")
+	}
+}
+
+func TestHandleRolesCommand(t *testing.T) {
+	auth := newTestAuthorizer(t)
+	mockBot := &MockTelegramBot{}
+	ctx := context.Background()
+
+	handleRolesCommand(ctx, mockBot, auth.configs.Load(), auth, nil, newCommandUpdate(-100, "/roolit aseta 123 yllapitaja"))
+	if auth.RoleFor(123, 123) != RoleMaintainer {
+		t.Errorf("Expected 123 to be maintainer, got %s", auth.RoleFor(123, 123))
+	}
+
+	// Replying to a message uses the sender of that message
+	update := newCommandUpdate(-100, "/roolit aseta jasen")
+	update.Message.ReplyToMessage = &models.Message{From: &models.User{ID: 456}}
+	handleRolesCommand(ctx, mockBot, auth.configs.Load(), auth, nil, update)
+	if auth.RoleFor(456, 456) != RoleMember {
+		t.Errorf("Expected 456 to be member, got %s", auth.RoleFor(456, 456))
+	}
+
+	handleRolesCommand(ctx, mockBot, auth.configs.Load(), auth, nil, newCommandUpdate(-100, "/roolit poista 123"))
+	if auth.RoleFor(123, 123) != RoleNone {
+		t.Errorf("Expected role of 123 to be removed, got %s", auth.RoleFor(123, 123))
+	}
+
+	handleRolesCommand(ctx, mockBot, auth.configs.Load(), auth, nil, newCommandUpdate(-100, "/roolit aseta 123 kuningas"))
+	if auth.RoleFor(123, 123) != RoleNone {
+		t.Errorf("Expected unknown role to be rejected")
+	}
+
+	if len(mockBot.SentMessages) != 4 {
+		t.Errorf("Expected a reply to every command, got %d", len(mockBot.SentMessages))
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"bt-telegram/format"
+)
+
+// Prefix of the callback data of the RSVP buttons
+const rsvpCallbackPrefix = "rsvp:"
+
+// RSVPAnswer is the answer of a user to the warming notification
+type RSVPAnswer string
+
+const (
+	RSVPComing RSVPAnswer = "tulossa"
+	RSVPMaybe  RSVPAnswer = "ehka"
+	RSVPNo     RSVPAnswer = "en"
+)
+
+var rsvpAnswers = []RSVPAnswer{RSVPComing, RSVPMaybe, RSVPNo}
+
+func (a RSVPAnswer) label(locale Locale) string {
+	return locale.T("rsvp_" + string(a))
+}
+
+type rsvpEntry struct {
+	UserID int64
+	Name   string
+	Answer RSVPAnswer
+}
+
+// RSVP is the warming notification of the current session in the notification chat
+// and the answers to it. The message is edited in place until the session ends.
+type RSVP struct {
+	mu        sync.Mutex
+	ChatID    int64
+	MessageID int
+	Locale    Locale
+	Mode      format.Mode
+	// Rendered text of the notification without the attendee list
+	Text    string
+	Entries []rsvpEntry
+	// When the text was last changed
+	Updated time.Time
+}
+
+// SetText replaces the notification text, the attendee list is kept
+func (r *RSVP) SetText(text string, updated time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.Text = text
+	r.Updated = updated
+}
+
+// Answer sets the answer of a user, users are listed in the order they first answered
+func (r *RSVP) Answer(userID int64, name string, answer RSVPAnswer) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.Entries {
+		if r.Entries[i].UserID == userID {
+			r.Entries[i].Name = name
+			r.Entries[i].Answer = answer
+			return
+		}
+	}
+	r.Entries = append(r.Entries, rsvpEntry{UserID: userID, Name: name, Answer: answer})
+}
+
+// Render the notification with the attendee list
+func (r *RSVP) render() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	text := r.Text
+	if len(r.Entries) > 0 {
+		text += "\n"
+	}
+	for _, answer := range rsvpAnswers {
+		var names []string
+		for _, e := range r.Entries {
+			if e.Answer == answer {
+				names = append(names, e.Name)
+			}
+		}
+		if len(names) > 0 {
+			text += format.Sprintf(r.Mode, "\n%s (%d): %s", answer.label(r.Locale), len(names), strings.Join(names, ", "))
+		}
+	}
+	return text
+}
+
+func rsvpKeyboard(locale Locale) *models.InlineKeyboardMarkup {
+	row := make([]models.InlineKeyboardButton, len(rsvpAnswers))
+	for i, answer := range rsvpAnswers {
+		row[i] = models.InlineKeyboardButton{Text: answer.label(locale), CallbackData: rsvpCallbackPrefix + string(answer)}
+	}
+	return &models.InlineKeyboardMarkup{InlineKeyboard: [][]models.InlineKeyboardButton{row}}
+}
+
+// Send the warming notification with the RSVP buttons to the notification chat,
+// the message is rendered for the configured parse mode
+func sendRSVPMessage(b TelegramBot, ctx context.Context, config *Config, locale Locale, message string, currentTime time.Time) (*RSVP, error) {
+	mode := config.parseMode()
+	msg, err := sendOrQueue(b, ctx, &OutboxMessage{
+		ChatID:    config.NotificationChatID,
+		Text:      message,
+		ParseMode: models.ParseMode(mode),
+		Keyboard:  rsvpKeyboard(locale),
+		Event:     EventWarming,
+	})
+	if err != nil {
+		return nil, err
+	}
+	rsvp := &RSVP{ChatID: config.NotificationChatID, Locale: locale, Mode: mode, Text: message, Updated: currentTime}
+	// A queued message gets its ID when the outbox delivers it
+	if msg != nil {
+		rsvp.MessageID = msg.ID
+	}
+	return rsvp, nil
+}
+
+// RSVPNotifier sends the notification to the notification chat as a message with the RSVP
+// buttons. With an RSVP the message of the RSVP is edited instead, which turns the live
+// warming message into the ready message.
+type RSVPNotifier struct {
+	Bot    TelegramBot
+	Config *Config
+	Locale Locale
+	RSVP   *RSVP // set by Notify when a new message is sent
+	// Set by Notify when the message of the RSVP was edited. Edits do not go through the
+	// outbox, a failed one is not retried.
+	Edited bool
+}
+
+func (r *RSVPNotifier) Notify(ctx context.Context, n Notification) error {
+	if r.RSVP != nil {
+		r.RSVP.SetText(r.RSVP.Locale.Format(r.RSVP.Mode, n.Key, n.Args...), n.Time)
+		err := editRSVPMessage(r.Bot, ctx, r.RSVP, true)
+		r.Edited = err == nil
+		return err
+	}
+	rsvp, err := sendRSVPMessage(r.Bot, ctx, r.Config, r.Locale, r.Locale.Format(r.Config.parseMode(), n.Key, n.Args...), n.Time)
+	r.RSVP = rsvp
+	return err
+}
+
+// Edit the notification to show the current answers, the buttons are kept while the session is on
+func editRSVPMessage(b TelegramBot, ctx context.Context, rsvp *RSVP, keyboard bool) error {
+	if rsvp.MessageID == 0 {
+		return errors.New("the RSVP message has not been delivered yet")
+	}
+	params := &bot.EditMessageTextParams{
+		ChatID:    rsvp.ChatID,
+		MessageID: rsvp.MessageID,
+		Text:      rsvp.render(),
+		ParseMode: models.ParseMode(rsvp.Mode),
+	}
+	if keyboard {
+		params.ReplyMarkup = rsvpKeyboard(rsvp.Locale)
+	}
+	_, err := b.EditMessageText(ctx, params)
+	return err
+}
+
+// Remove the buttons from the notification when the session ends
+func closeRSVP(b TelegramBot, ctx context.Context, kiuas *Kiuas) {
+	if kiuas.RSVP == nil {
+		return
+	}
+	if err := editRSVPMessage(b, ctx, kiuas.RSVP, false); err != nil {
+		fmt.Printf("Failed to edit message: %v\n", err)
+	}
+	kiuas.RSVP = nil
+}
+
+// Handler for the RSVP buttons of the warming notification
+func handleRSVPCallback(ctx context.Context, b TelegramBot, kiuas *Kiuas, config *Config, langs *Languages, update *models.Update) {
+	query := update.CallbackQuery
+	answer := RSVPAnswer(strings.TrimPrefix(query.Data, rsvpCallbackPrefix))
+	locale := langs.For(config, query.From.ID)
+
+	reply := locale.T("rsvp_closed")
+	msg := query.Message.Message
+	// The ingest path sets the message ID on delivery and closes the RSVP when the session ends
+	ingestMu.Lock()
+	rsvp := kiuas.RSVP
+	if !slices.Contains(rsvpAnswers, answer) {
+		reply = locale.T("rsvp_unknown")
+	} else if rsvp != nil && msg != nil && msg.Chat.ID == rsvp.ChatID && msg.ID == rsvp.MessageID {
+		rsvp.Answer(query.From.ID, displayName(&query.From), answer)
+		if err := editRSVPMessage(b, ctx, rsvp, true); err != nil {
+			fmt.Printf("Failed to edit message: %v\n", err)
+		}
+		reply = locale.T("rsvp_saved", answer.label(locale))
+	}
+	ingestMu.Unlock()
+
+	err := b.AnswerCallbackQuery(ctx, &bot.AnswerCallbackQueryParams{
+		CallbackQueryID: query.ID,
+		Text:            reply,
+	})
+	if err != nil {
+		fmt.Printf("Failed to answer callback query: %v\n", err)
+	}
+}
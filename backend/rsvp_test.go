@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-telegram/bot"
+	"github.com/go-telegram/bot/models"
+
+	"bt-telegram/format"
+)
+
+func newCallbackUpdate(chatID int64, messageID int, user models.User, data string) *models.Update {
+	return &models.Update{
+		CallbackQuery: &models.CallbackQuery{
+			ID:   "query",
+			From: user,
+			Message: models.MaybeInaccessibleMessage{
+				Message: &models.Message{ID: messageID, Chat: models.Chat{ID: chatID}},
+			},
+			Data: data,
+		},
+	}
+}
+
+func TestRSVP_Render(t *testing.T) {
+	rsvp := &RSVP{Text: LocaleFi.Format(format.MarkdownV2, "warming", "18.30")}
+	rsvp.Answer(1, "@tonttu", RSVPComing)
+	rsvp.Answer(2, "Matti_M", RSVPMaybe)
+	rsvp.Answer(3, "Liisa", RSVPComing)
+	rsvp.Answer(2, "Matti_M", RSVPComing)
+
+	text := rsvp.render()
+	if !strings.HasPrefix(text, "🔥*Sauna lämpiää\\!*🔥\nValmis klo 18\\.30\n") {
+		t.Errorf("Expected the original message first, got %q", text)
+	}
+	if !strings.Contains(text, "✅ Tulossa \\(3\\): @tonttu, Matti\\_M, Liisa") {
+		t.Errorf("Expected everyone coming in answer order with escaped names, got %q", text)
+	}
+	if strings.Contains(text, "Ehkä") {
+		t.Errorf("Expected changed answer to be removed from maybe, got %q", text)
+	}
+}
+
+func TestRSVP_RenderHTML(t *testing.T) {
+	rsvp := &RSVP{Mode: format.HTML, Text: LocaleFi.Format(format.HTML, "warming", "18.30")}
+	rsvp.Answer(1, "<Matti & Liisa>", RSVPComing)
+
+	expected := "🔥<b>Sauna lämpiää!</b>🔥\nValmis klo 18.30\n\n✅ Tulossa (1): &lt;Matti &amp; Liisa&gt;"
+	if text := rsvp.render(); text != expected {
+		t.Errorf("Expected %q, got %q", expected, text)
+	}
+}
+
+func TestCheckAndNotify_WarmingRSVP(t *testing.T) {
+	kiuas := &Kiuas{
+		Temperature:        60.0,
+		TemperatureRecords: [3]float64{50.0, 55.0, 60.0},
+		TimestampRecords: [3]time.Time{
+			time.Now().Add(-3 * time.Minute),
+			time.Now().Add(-2 * time.Minute),
+			time.Now().Add(-1 * time.Minute),
+		},
+	}
+	config := &Config{NotificationChatID: -200, ReadyThreshold: 75.0, LowerBound: 0.01, ResetThreshold: 40.0}
+	mockBot := &MockTelegramBot{}
+	ctx := context.Background()
+
+	checkAndNotify(mockBot, ctx, kiuas, config, nil, nil, time.Now())
+	if kiuas.RSVP == nil || kiuas.RSVP.MessageID != 1 || kiuas.RSVP.ChatID != -200 {
+		t.Fatalf("Expected RSVP for the warming message, got %+v", kiuas.RSVP)
+	}
+
+	handleRSVPCallback(ctx, mockBot, kiuas, &Config{}, nil, newCallbackUpdate(-200, 1, models.User{ID: 42, Username: "tonttu"}, "rsvp:tulossa"))
+	if len(mockBot.EditedMessages) != 1 {
+		t.Fatalf("Expected the message to be edited, got %d edits", len(mockBot.EditedMessages))
+	}
+	edit := mockBot.EditedMessages[0]
+	if edit.MessageID != 1 || !strings.Contains(edit.Text, "@tonttu") || edit.ReplyMarkup == nil {
+		t.Errorf("Expected attendee list with buttons, got %+v", edit)
+	}
+	if len(mockBot.CallbackAnswers) != 1 || !strings.Contains(mockBot.CallbackAnswers[0], "Tulossa") {
+		t.Errorf("Expected the callback to be answered, got %v", mockBot.CallbackAnswers)
+	}
+
+	// An answer to an old message is not recorded
+	handleRSVPCallback(ctx, mockBot, kiuas, &Config{}, nil, newCallbackUpdate(-200, 99, models.User{ID: 43}, "rsvp:en"))
+	if len(mockBot.EditedMessages) != 1 || len(kiuas.RSVP.Entries) != 1 {
+		t.Errorf("Expected answer to an old message to be ignored")
+	}
+
+	// Ending the session removes the buttons
+	kiuas.Temperature = 80.0
+	checkAndNotify(mockBot, ctx, kiuas, config, nil, nil, time.Now())
+	kiuas.Temperature = 30.0
+	checkAndNotify(mockBot, ctx, kiuas, config, nil, nil, time.Now())
+	if kiuas.RSVP != nil {
+		t.Errorf("Expected RSVP to be cleared when the session ends")
+	}
+	last := mockBot.EditedMessages[len(mockBot.EditedMessages)-1]
+	if last.ReplyMarkup != nil || !strings.Contains(last.Text, "@tonttu") {
+		t.Errorf("Expected final attendee list without buttons, got %+v", last)
+	}
+}
+
+func TestRequireRole_CallbackQuery(t *testing.T) {
+	auth := newTestAuthorizer(t)
+
+	called := false
+	handler := RequireRole(auth, RoleMember, func(ctx context.Context, b *bot.Bot, update *models.Update) {
+		called = true
+	})
+
+	handler(context.Background(), nil, newCallbackUpdate(-300, 1, models.User{ID: 42}, "rsvp:en"))
+	if called {
+		t.Errorf("Expected handler not to be called outside the notification chat")
+	}
+
+	handler(context.Background(), nil, newCallbackUpdate(-200, 1, models.User{ID: 42}, "rsvp:en"))
+	if !called {
+		t.Errorf("Expected handler to be called in the notification chat")
+	}
+}
+
+func TestHandleRSVPCallback_ConcurrentSessionEnd(t *testing.T) {
+	mockBot := &MockTelegramBot{}
+	kiuas := &Kiuas{}
+	ctx := context.Background()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			handleRSVPCallback(ctx, mockBot, kiuas, &Config{}, nil, newCallbackUpdate(-200, 1, models.User{ID: 42}, "rsvp:tulossa"))
+		}
+	}()
+	// The ingest path opens and closes sessions while the answers come in
+	for i := 0; i < 100; i++ {
+		ingestMu.Lock()
+		kiuas.RSVP = &RSVP{ChatID: -200, MessageID: 1}
+		closeRSVP(mockBot, ctx, kiuas)
+		ingestMu.Unlock()
+	}
+	<-done
+
+	if len(mockBot.CallbackAnswers) != 100 {
+		t.Errorf("Expected every callback to be answered, got %d", len(mockBot.CallbackAnswers))
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+type SafetyAlert string
+
+const (
+	AlertOverheat          SafetyAlert = "overheat"
+	AlertRapidRise         SafetyAlert = "rapid_rise"
+	AlertFrozenReadings    SafetyAlert = "frozen_readings"
+	AlertHumiditySaturated SafetyAlert = "humidity_saturated"
+)
+
+// Order in which the alerts are evaluated, so that messages are sent deterministically
+var safetyAlerts = []SafetyAlert{AlertOverheat, AlertRapidRise, AlertFrozenReadings, AlertHumiditySaturated}
+
+// SafetyAlertState tracks an active alert so that it is only sent once
+type SafetyAlertState struct {
+	Since    time.Time
+	LastSeen time.Time
+}
+
+// Check if the condition behind the given alert is currently true
+func (k *Kiuas) safetyCondition(alert SafetyAlert, config *Config, currentTime time.Time) bool {
+	switch alert {
+	case AlertOverheat:
+		return config.OverheatThreshold > 0 && k.Temperature >= config.OverheatThreshold
+	case AlertRapidRise:
+		if config.MaxTempRiseRate <= 0 || len(k.Samples) < 2 {
+			return false
+		}
+		prev, last := k.Samples[len(k.Samples)-2], k.Samples[len(k.Samples)-1]
+		minutes := last.Time.Sub(prev.Time).Minutes()
+		if minutes <= 0 {
+			return false
+		}
+		return (last.Temperature-prev.Temperature)/minutes >= config.MaxTempRiseRate
+	case AlertFrozenReadings:
+		return config.FrozenReadingDuration > 0 && !k.LastReadingChange.IsZero() &&
+			currentTime.Sub(k.LastReadingChange) >= config.FrozenReadingDuration
+	case AlertHumiditySaturated:
+		return config.HumiditySaturation > 0 && k.Humidity >= config.HumiditySaturation
+	}
+	return false
+}
+
+// The message of an alert is safety_<alert> in the catalog and its name in the recovery message safety_<alert>_name
+func safetyAlertMessage(alert SafetyAlert, kiuas *Kiuas, config *Config, locale Locale) string {
+	var args []any
+	switch alert {
+	case AlertOverheat:
+		args = []any{kiuas.Temperature, config.OverheatThreshold}
+	case AlertRapidRise:
+		args = []any{config.MaxTempRiseRate, kiuas.Temperature}
+	case AlertFrozenReadings:
+		args = []any{kiuas.Temperature, kiuas.Humidity, config.FrozenReadingDuration.Minutes()}
+	case AlertHumiditySaturated:
+		args = []any{kiuas.Humidity}
+	}
+	return locale.Format(config.parseMode(), "safety_"+string(alert), args...)
+}
+
+func safetyRecoveryMessage(alert SafetyAlert, duration time.Duration, config *Config, locale Locale) string {
+	name := locale.T("safety_" + string(alert) + "_name")
+	return locale.Format(config.parseMode(), "safety_recovered", name, duration.Round(time.Minute))
+}
+
+// Function to check the safety limits and send maintenance alerts and recovery messages.
+// An alert is considered recovered after its condition has been false for SafetyRecoveryTime.
+func checkSafety(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, langs *Languages, currentTime time.Time) {
+	if kiuas.SafetyAlerts == nil {
+		kiuas.SafetyAlerts = make(map[SafetyAlert]*SafetyAlertState)
+	}
+	locale := langs.For(config, config.MaintenanceChatID)
+
+	for _, alert := range safetyAlerts {
+		state, active := kiuas.SafetyAlerts[alert]
+
+		if kiuas.safetyCondition(alert, config, currentTime) {
+			if active {
+				state.LastSeen = currentTime
+				continue
+			}
+			log.Printf("Safety alert %s triggered\n", alert)
+			kiuas.SafetyAlerts[alert] = &SafetyAlertState{Since: currentTime, LastSeen: currentTime}
+			SendTelegramMessage(b, ctx, config, safetyAlertMessage(alert, kiuas, config, locale), config.MaintenanceChatID)
+			continue
+		}
+
+		if active && currentTime.Sub(state.LastSeen) >= config.SafetyRecoveryTime {
+			log.Printf("Safety alert %s recovered\n", alert)
+			delete(kiuas.SafetyAlerts, alert)
+			SendTelegramMessage(b, ctx, config, safetyRecoveryMessage(alert, currentTime.Sub(state.Since), config, locale), config.MaintenanceChatID)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckSafety_OverheatAlertAndRecovery(t *testing.T) {
+	currentTime := time.Now()
+	kiuas := &Kiuas{Temperature: 115.0}
+
+	mockBot := &MockTelegramBot{}
+
+	config := &Config{
+		MaintenanceChatID:  1,
+		NotificationChatID: 2,
+		OverheatThreshold:  110.0,
+		SafetyRecoveryTime: 5 * time.Minute,
+	}
+
+	ctx := context.Background()
+
+	checkSafety(mockBot, ctx, kiuas, config, nil, currentTime)
+	checkSafety(mockBot, ctx, kiuas, config, nil, currentTime.Add(time.Minute))
+
+	if len(mockBot.SentMessages) != 1 {
+		t.Fatalf("Expected 1 alert, got %d", len(mockBot.SentMessages))
+	}
+	if mockBot.SentChatIDs[0] != config.MaintenanceChatID {
+		t.Errorf("Expected alert to go to the maintenance chat, got %v", mockBot.SentChatIDs[0])
+	}
+
+	// No recovery until the condition has been false for SafetyRecoveryTime
+	kiuas.Temperature = 90.0
+	checkSafety(mockBot, ctx, kiuas, config, nil, currentTime.Add(2*time.Minute))
+	if len(mockBot.SentMessages) != 1 {
+		t.Fatalf("Expected no recovery message yet, got %d messages", len(mockBot.SentMessages))
+	}
+
+	checkSafety(mockBot, ctx, kiuas, config, nil, currentTime.Add(7*time.Minute))
+	if len(mockBot.SentMessages) != 2 {
+		t.Fatalf("Expected a recovery message, got %d messages", len(mockBot.SentMessages))
+	}
+	if _, active := kiuas.SafetyAlerts[AlertOverheat]; active {
+		t.Errorf("Expected overheat alert to be cleared")
+	}
+}
+
+func TestCheckSafety_RapidRise(t *testing.T) {
+	currentTime := time.Now()
+	kiuas := &Kiuas{Temperature: 70.0}
+	kiuas.AddSample(30.0, 10.0, 100000, currentTime.Add(-10*time.Second))
+	kiuas.AddSample(70.0, 10.0, 100000, currentTime)
+
+	mockBot := &MockTelegramBot{}
+
+	config := &Config{MaxTempRiseRate: 10.0}
+
+	checkSafety(mockBot, context.Background(), kiuas, config, nil, currentTime)
+
+	if _, active := kiuas.SafetyAlerts[AlertRapidRise]; !active {
+		t.Errorf("Expected rapid rise alert")
+	}
+	if len(mockBot.SentMessages) != 1 {
+		t.Fatalf("Expected 1 alert, got %d", len(mockBot.SentMessages))
+	}
+}
+
+func TestCheckSafety_FrozenReadings(t *testing.T) {
+	currentTime := time.Now()
+	kiuas := &Kiuas{Temperature: 50.0, Humidity: 10.0}
+	for i := 40; i >= 0; i-- {
+		kiuas.AddSample(50.0, 10.0, 100000, currentTime.Add(-time.Duration(i)*time.Minute))
+	}
+
+	mockBot := &MockTelegramBot{}
+
+	config := &Config{FrozenReadingDuration: 30 * time.Minute}
+
+	checkSafety(mockBot, context.Background(), kiuas, config, nil, currentTime)
+
+	if _, active := kiuas.SafetyAlerts[AlertFrozenReadings]; !active {
+		t.Errorf("Expected frozen readings alert")
+	}
+}
+
+func TestCheckSafety_DisabledByDefault(t *testing.T) {
+	kiuas := &Kiuas{Temperature: 150.0, Humidity: 120.0}
+
+	mockBot := &MockTelegramBot{}
+
+	checkSafety(mockBot, context.Background(), kiuas, &Config{}, nil, time.Now())
+
+	if len(mockBot.SentMessages) != 0 {
+		t.Fatalf("Expected 0 messages with zero config, got %d", len(mockBot.SentMessages))
+	}
+}
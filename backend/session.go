@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+// How many past sessions are kept
+const sessionHistoryLength = 200
+
+// SessionRecord is a finished sauna session
+type SessionRecord struct {
+	Start          time.Time `json:"start"`
+	Ready          time.Time `json:"ready"`
+	End            time.Time `json:"end"`
+	MaxTemperature float64   `json:"max_temperature"`
+	LoylyCount     int       `json:"loyly_count"`
+}
+
+func sessionsPath(config *Config) string {
+	return filepath.Join(config.DataDir, "sessions.json")
+}
+
+// LoadSessions reads the past sessions from the data directory
+func (k *Kiuas) LoadSessions(config *Config) error {
+	k.sessionsMu.Lock()
+	defer k.sessionsMu.Unlock()
+	return loadJSON(sessionsPath(config), &k.Sessions)
+}
+
+// SessionsSnapshot returns a copy of the past sessions that is safe to use outside the ingest path
+func (k *Kiuas) SessionsSnapshot() []SessionRecord {
+	k.sessionsMu.RLock()
+	defer k.sessionsMu.RUnlock()
+	return slices.Clone(k.Sessions)
+}
+
+// Record the session that just ended and save the session history
+func (k *Kiuas) EndSession(config *Config, end time.Time) {
+	start := k.WarmingStartTime
+	if start.IsZero() {
+		start = k.ReadyTime
+	}
+	if start.IsZero() {
+		return
+	}
+
+	k.sessionsMu.Lock()
+	k.Sessions = append(k.Sessions, SessionRecord{
+		Start:          start,
+		Ready:          k.ReadyTime,
+		End:            end,
+		MaxTemperature: k.SessionMaxTemperature,
+		LoylyCount:     k.LoylyCount,
+	})
+	if len(k.Sessions) > sessionHistoryLength {
+		k.Sessions = k.Sessions[len(k.Sessions)-sessionHistoryLength:]
+	}
+	k.sessionsMu.Unlock()
+	k.SessionMaxTemperature = 0
+
+	if config.DataDir == "" {
+		return
+	}
+	if err := saveJSON(sessionsPath(config), k.SessionsSnapshot()); err != nil {
+		log.Printf("Failed to save sessions: %v\n", err)
+	}
+}
+
+// Function to warn when the sauna has been on for longer than MaxSessionDuration.
+// The first alert goes to the notification chat, the following ones are repeated
+// every SessionAlertInterval to the maintenance chat until the sauna cools down.
+func checkSessionLength(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, langs *Languages, currentTime time.Time) {
+	if config.MaxSessionDuration <= 0 || !kiuas.ReadyNotificationSent || kiuas.ReadyTime.IsZero() {
+		return
+	}
+
+	// The sauna is cooling down, the reset in checkAndNotify takes care of the rest
+	if kiuas.Temperature < config.ResetThreshold {
+		return
+	}
+
+	sessionLength := currentTime.Sub(kiuas.ReadyTime)
+	if sessionLength < config.MaxSessionDuration {
+		return
+	}
+
+	if kiuas.SessionAlertCount > 0 && currentTime.Sub(kiuas.LastSessionAlert) < config.SessionAlertInterval {
+		return
+	}
+
+	hours := int(sessionLength.Hours())
+	minutes := int(sessionLength.Minutes()) % 60
+	log.Printf("Sauna has been on for %dh %dmin, sending alert %d\n", hours, minutes, kiuas.SessionAlertCount+1)
+
+	if kiuas.SessionAlertCount == 0 {
+		sendLocalized(b, ctx, config, langs, config.NotificationChatID, "session_long", hours, minutes, kiuas.Temperature)
+	} else {
+		sendLocalized(b, ctx, config, langs, config.MaintenanceChatID, "session_still_on", hours, minutes, kiuas.Temperature)
+	}
+
+	kiuas.SessionAlertCount++
+	kiuas.LastSessionAlert = currentTime
+}
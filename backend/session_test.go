@@ -0,0 +1,133 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestCheckSessionLength_Escalation(t *testing.T) {
+	readyTime := time.Now()
+	kiuas := &Kiuas{
+		Temperature:             80.0,
+		WarmingNotificationSent: true,
+		ReadyNotificationSent:   true,
+		ReadyTime:               readyTime,
+	}
+
+	mockBot := &MockTelegramBot{}
+
+	config := &Config{
+		ReadyThreshold:       75.0,
+		ResetThreshold:       40.0,
+		MaintenanceChatID:    1,
+		NotificationChatID:   2,
+		MaxSessionDuration:   4 * time.Hour,
+		SessionAlertInterval: 30 * time.Minute,
+	}
+
+	ctx := context.Background()
+
+	checkSessionLength(mockBot, ctx, kiuas, config, nil, readyTime.Add(3*time.Hour))
+	if len(mockBot.SentMessages) != 0 {
+		t.Fatalf("Expected 0 messages before MaxSessionDuration, got %d", len(mockBot.SentMessages))
+	}
+
+	checkSessionLength(mockBot, ctx, kiuas, config, nil, readyTime.Add(4*time.Hour))
+	checkSessionLength(mockBot, ctx, kiuas, config, nil, readyTime.Add(4*time.Hour+10*time.Minute))
+	checkSessionLength(mockBot, ctx, kiuas, config, nil, readyTime.Add(4*time.Hour+30*time.Minute))
+
+	if len(mockBot.SentMessages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(mockBot.SentMessages))
+	}
+	if mockBot.SentChatIDs[0] != config.NotificationChatID {
+		t.Errorf("Expected first alert to go to the notification chat, got %v", mockBot.SentChatIDs[0])
+	}
+	if mockBot.SentChatIDs[1] != config.MaintenanceChatID {
+		t.Errorf("Expected second alert to go to the maintenance chat, got %v", mockBot.SentChatIDs[1])
+	}
+}
+
+func TestCheckSessionLength_StopsWhenCooled(t *testing.T) {
+	readyTime := time.Now()
+	kiuas := &Kiuas{
+		Temperature:             35.0,
+		WarmingNotificationSent: true,
+		ReadyNotificationSent:   true,
+		ReadyTime:               readyTime,
+	}
+
+	mockBot := &MockTelegramBot{}
+
+	config := &Config{
+		ReadyThreshold:       75.0,
+		ResetThreshold:       40.0,
+		MaxSessionDuration:   4 * time.Hour,
+		SessionAlertInterval: 30 * time.Minute,
+	}
+
+	checkAndNotify(mockBot, context.Background(), kiuas, config, nil, nil, readyTime.Add(5*time.Hour))
+
+	if len(mockBot.SentMessages) != 0 {
+		t.Fatalf("Expected 0 messages after cooling down, got %d", len(mockBot.SentMessages))
+	}
+	if kiuas.SessionAlertCount != 0 || !kiuas.ReadyTime.IsZero() {
+		t.Errorf("Expected session alert state to be reset")
+	}
+}
+
+func TestCheckAndNotify_RecordsSession(t *testing.T) {
+	start := time.Now()
+	kiuas := &Kiuas{
+		Temperature:             35.0,
+		WarmingNotificationSent: true,
+		ReadyNotificationSent:   true,
+		WarmingStartTime:        start,
+		ReadyTime:               start.Add(time.Hour),
+		SessionMaxTemperature:   85.0,
+	}
+
+	config := &Config{
+		ReadyThreshold: 75.0,
+		ResetThreshold: 40.0,
+		DataDir:        t.TempDir(),
+	}
+
+	checkAndNotify(&MockTelegramBot{}, context.Background(), kiuas, config, nil, nil, start.Add(4*time.Hour))
+
+	if len(kiuas.Sessions) != 1 {
+		t.Fatalf("Expected 1 recorded session, got %d", len(kiuas.Sessions))
+	}
+	if session := kiuas.Sessions[0]; !session.Start.Equal(start) || session.MaxTemperature != 85.0 {
+		t.Errorf("Unexpected session %+v", session)
+	}
+
+	loaded := &Kiuas{}
+	if err := loaded.LoadSessions(config); err != nil || len(loaded.Sessions) != 1 {
+		t.Errorf("Expected session to be saved, got %d (%v)", len(loaded.Sessions), err)
+	}
+}
+
+func TestSessionsSnapshot_ConcurrentEndSession(t *testing.T) {
+	kiuas := &Kiuas{}
+	config := &Config{}
+	start := time.Now().Add(-time.Hour)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < sessionHistoryLength+50; i++ {
+			kiuas.WarmingStartTime = start
+			kiuas.EndSession(config, start.Add(time.Duration(i)*time.Second))
+		}
+	}()
+	// The calendar and inline queries read the sessions while the ingest path ends them
+	for i := 0; i < 100; i++ {
+		calendarEvents(kiuas, &Reservations{}, 0, false, time.Now())
+	}
+	<-done
+
+	if sessions := kiuas.SessionsSnapshot(); len(sessions) != sessionHistoryLength {
+		t.Errorf("Expected %d sessions, got %d", sessionHistoryLength, len(sessions))
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-telegram/bot/models"
+)
+
+// SaunaEvent is a state change of the sauna that can be notified about
+type SaunaEvent string
+
+const (
+	EventWarming SaunaEvent = "warming"
+	EventReady   SaunaEvent = "ready"
+	// Only sent to the Telegram chats and the notification channels, users can not subscribe to these
+	EventStalled         SaunaEvent = "stalled"
+	EventCooled          SaunaEvent = "cooled"
+	EventNoData          SaunaEvent = "no_data"
+	EventNoDataEscalated SaunaEvent = "no_data_escalated"
+	EventNoDataRecovered SaunaEvent = "no_data_recovered"
+)
+
+var saunaEvents = []SaunaEvent{EventWarming, EventReady, EventStalled, EventCooled, EventNoData, EventNoDataEscalated, EventNoDataRecovered}
+
+// Subscription of a single user to direct messages
+type Subscription struct {
+	Warming bool `json:"warming"`
+	Ready   bool `json:"ready"`
+	// Hours of day during which no messages are sent, equal values disable quiet hours
+	QuietHoursStart int `json:"quiet_hours_start"`
+	QuietHoursEnd   int `json:"quiet_hours_end"`
+}
+
+func (s *Subscription) wants(event SaunaEvent) bool {
+	switch event {
+	case EventWarming:
+		return s.Warming
+	case EventReady:
+		return s.Ready
+	}
+	return false
+}
+
+// Subscriptions of users to direct messages, saved to the data directory.
+// The private chat ID of a user is the same as the user ID.
+type Subscriptions struct {
+	mu    sync.RWMutex
+	path  string
+	Users map[int64]*Subscription `json:"users"`
+}
+
+// LoadSubscriptions reads the saved subscriptions from the data directory
+func LoadSubscriptions(config *Config) (*Subscriptions, error) {
+	s := &Subscriptions{
+		path:  filepath.Join(config.DataDir, "subscriptions.json"),
+		Users: make(map[int64]*Subscription),
+	}
+	if err := loadJSON(s.path, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Update the subscription of a user and save the subscriptions.
+// Subscriptions without any events are removed.
+func (s *Subscriptions) Update(userID int64, update func(sub *Subscription)) (Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sub, ok := s.Users[userID]
+	if !ok {
+		sub = &Subscription{}
+	}
+	update(sub)
+
+	if sub.Warming || sub.Ready {
+		s.Users[userID] = sub
+	} else {
+		delete(s.Users, userID)
+	}
+	return *sub, saveJSON(s.path, s)
+}
+
+// Get returns the subscription of a user
+func (s *Subscriptions) Get(userID int64) (Subscription, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sub, ok := s.Users[userID]
+	if !ok {
+		return Subscription{}, false
+	}
+	return *sub, true
+}
+
+// Subscribers returns the users that want a message about the event at the given time
+func (s *Subscriptions) Subscribers(event SaunaEvent, t time.Time) []int64 {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var users []int64
+	for userID, sub := range s.Users {
+		if sub.wants(event) && !inQuietHours(t, sub.QuietHoursStart, sub.QuietHoursEnd) {
+			users = append(users, userID)
+		}
+	}
+	return users
+}
+
+// Direct message notifiers of the users subscribed to the event, each in the language of the user
+func subscriberNotifiers(b TelegramBot, config *Config, subs *Subscriptions, langs *Languages, event SaunaEvent, t time.Time) []Notifier {
+	var notifiers []Notifier
+	for _, userID := range subs.Subscribers(event, t) {
+		notifiers = append(notifiers, &TelegramNotifier{Bot: b, Config: config, Langs: langs, ChatID: userID})
+	}
+	return notifiers
+}
+
+func formatSubscription(sub Subscription, ok bool, locale Locale) string {
+	if !ok {
+		return locale.T("subscriptions_none")
+	}
+	var events []string
+	if sub.Warming {
+		events = append(events, locale.T("subscription_warming"))
+	}
+	if sub.Ready {
+		events = append(events, locale.T("subscription_ready"))
+	}
+	text := locale.T("subscriptions", strings.Join(events, ", "))
+	if sub.QuietHoursStart != sub.QuietHoursEnd {
+		text += locale.T("subscription_quiet_hours", sub.QuietHoursStart, sub.QuietHoursEnd)
+	}
+	return text
+}
+
+// Parse quiet hours in the form 23-8
+func parseQuietHours(value string) (start, end int, err error) {
+	startStr, endStr, ok := strings.Cut(value, "-")
+	if !ok {
+		return 0, 0, &MessageError{Key: "quiet_hours_format"}
+	}
+	start, err1 := strconv.Atoi(startStr)
+	end, err2 := strconv.Atoi(endStr)
+	if err1 != nil || err2 != nil || start < 0 || start > 23 || end < 0 || end > 23 {
+		return 0, 0, &MessageError{Key: "quiet_hours_format"}
+	}
+	return start, end, nil
+}
+
+// Handler for /tilaa [lampiaa|valmis|kaikki] and /tilaa hiljaa <alku>-<loppu>|pois
+func handleSubscribeCommand(ctx context.Context, b TelegramBot, config *Config, subs *Subscriptions, langs *Languages, update *models.Update) {
+	if update.Message.From == nil {
+		return
+	}
+	locale := langs.For(config, update.Message.Chat.ID)
+	userID := update.Message.From.ID
+	args := strings.Fields(update.Message.Text)[1:]
+
+	var change func(sub *Subscription)
+	switch {
+	case len(args) == 0 || (len(args) == 1 && args[0] == "kaikki"):
+		change = func(sub *Subscription) { sub.Warming, sub.Ready = true, true }
+	case len(args) == 1 && args[0] == "lampiaa":
+		change = func(sub *Subscription) { sub.Warming = true }
+	case len(args) == 1 && args[0] == "valmis":
+		change = func(sub *Subscription) { sub.Ready = true }
+	case len(args) == 2 && args[0] == "hiljaa":
+		if _, ok := subs.Get(userID); !ok {
+			replyText(ctx, b, update, locale.T("subscribe_first"))
+			return
+		}
+		start, end := 0, 0
+		if args[1] != "pois" {
+			var err error
+			if start, end, err = parseQuietHours(args[1]); err != nil {
+				replyText(ctx, b, update, locale.Error(err))
+				return
+			}
+		}
+		change = func(sub *Subscription) { sub.QuietHoursStart, sub.QuietHoursEnd = start, end }
+	default:
+		replyText(ctx, b, update, locale.T("subscribe_usage"))
+		return
+	}
+
+	sub, err := subs.Update(userID, change)
+	if err != nil {
+		log.Printf("Failed to save subscriptions: %v\n", err)
+		replyText(ctx, b, update, locale.T("subscribe_failed"))
+		return
+	}
+	log.Printf("Subscription of %s updated\n", userName(update.Message.From))
+
+	reply := formatSubscription(sub, true, locale)
+	if update.Message.Chat.ID != userID {
+		reply += locale.T("subscribe_private")
+	}
+	replyText(ctx, b, update, reply)
+}
+
+// Handler for /peru [lampiaa|valmis]
+func handleUnsubscribeCommand(ctx context.Context, b TelegramBot, config *Config, subs *Subscriptions, langs *Languages, update *models.Update) {
+	if update.Message.From == nil {
+		return
+	}
+	locale := langs.For(config, update.Message.Chat.ID)
+	args := strings.Fields(update.Message.Text)[1:]
+
+	var change func(sub *Subscription)
+	switch {
+	case len(args) == 0 || (len(args) == 1 && args[0] == "kaikki"):
+		change = func(sub *Subscription) { sub.Warming, sub.Ready = false, false }
+	case len(args) == 1 && args[0] == "lampiaa":
+		change = func(sub *Subscription) { sub.Warming = false }
+	case len(args) == 1 && args[0] == "valmis":
+		change = func(sub *Subscription) { sub.Ready = false }
+	default:
+		replyText(ctx, b, update, locale.T("subscribe_usage"))
+		return
+	}
+
+	sub, err := subs.Update(update.Message.From.ID, change)
+	if err != nil {
+		log.Printf("Failed to save subscriptions: %v\n", err)
+		replyText(ctx, b, update, locale.T("subscribe_failed"))
+		return
+	}
+	replyText(ctx, b, update, formatSubscription(sub, sub.Warming || sub.Ready, locale))
+}
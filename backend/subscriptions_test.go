@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newTestSubscriptions(t *testing.T) *Subscriptions {
+	t.Helper()
+	subs, err := LoadSubscriptions(&Config{DataDir: t.TempDir()})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return subs
+}
+
+func TestSubscriptions_QuietHours(t *testing.T) {
+	subs := newTestSubscriptions(t)
+	ctx := context.Background()
+	mockBot := &MockTelegramBot{}
+
+	handleSubscribeCommand(ctx, mockBot, &Config{}, subs, nil, newCommandUpdate(42, "/tilaa"))
+	handleSubscribeCommand(ctx, mockBot, &Config{}, subs, nil, newCommandUpdate(42, "/tilaa hiljaa 22-7"))
+
+	night := time.Date(2024, 12, 1, 23, 0, 0, 0, time.Local)
+	evening := time.Date(2024, 12, 1, 18, 0, 0, 0, time.Local)
+
+	if users := subs.Subscribers(EventReady, night); len(users) != 0 {
+		t.Errorf("Expected no subscribers during quiet hours, got %v", users)
+	}
+	if users := subs.Subscribers(EventReady, evening); !slices.Equal(users, []int64{42}) {
+		t.Errorf("Expected subscriber 42, got %v", users)
+	}
+}
+
+func TestSubscriptions_SubscribeAndCancel(t *testing.T) {
+	subs := newTestSubscriptions(t)
+	ctx := context.Background()
+	mockBot := &MockTelegramBot{}
+
+	handleSubscribeCommand(ctx, mockBot, &Config{}, subs, nil, newCommandUpdate(42, "/tilaa valmis"))
+	now := time.Date(2024, 12, 1, 18, 0, 0, 0, time.Local)
+
+	if users := subs.Subscribers(EventWarming, now); len(users) != 0 {
+		t.Errorf("Expected no warming subscribers, got %v", users)
+	}
+	if users := subs.Subscribers(EventReady, now); len(users) != 1 {
+		t.Errorf("Expected 1 ready subscriber, got %v", users)
+	}
+
+	// Saved to disk
+	loaded, err := LoadSubscriptions(&Config{DataDir: filepath.Dir(subs.path)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := loaded.Get(42); !ok {
+		t.Errorf("Expected subscription to be saved")
+	}
+
+	handleUnsubscribeCommand(ctx, mockBot, &Config{}, subs, nil, newCommandUpdate(42, "/peru"))
+	if _, ok := subs.Get(42); ok {
+		t.Errorf("Expected subscription to be removed")
+	}
+}
+
+func TestCheckAndNotify_SendsToSubscribers(t *testing.T) {
+	currentTime := time.Date(2024, 12, 1, 18, 0, 0, 0, time.Local)
+	kiuas := &Kiuas{
+		Temperature: 80.0,
+		TemperatureRecords: [3]float64{
+			70.0, 75.0, 80.0,
+		},
+		TimestampRecords: [3]time.Time{
+			currentTime.Add(-3 * time.Minute),
+			currentTime.Add(-2 * time.Minute),
+			currentTime.Add(-1 * time.Minute),
+		},
+	}
+
+	subs := newTestSubscriptions(t)
+	subs.Update(42, func(sub *Subscription) { sub.Ready = true })
+	subs.Update(43, func(sub *Subscription) { sub.Warming = true })
+
+	mockBot := &MockTelegramBot{}
+
+	config := &Config{
+		ReadyThreshold:     75.0,
+		LowerBound:         0.01,
+		ResetThreshold:     40.0,
+		NotificationChatID: 1,
+	}
+
+	checkAndNotify(mockBot, context.Background(), kiuas, config, subs, nil, currentTime)
+
+	if len(mockBot.SentMessages) != 2 {
+		t.Fatalf("Expected 2 messages, got %d", len(mockBot.SentMessages))
+	}
+	if mockBot.SentChatIDs[0] != int64(1) || mockBot.SentChatIDs[1] != int64(42) {
+		t.Errorf("Expected messages to the group and subscriber 42, got %v", mockBot.SentChatIDs)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// Number of blocks in the progress bar of the warming message
+const progressBarWidth = 10
+
+// Fraction of the way from WarmingThreshold to ReadyThreshold, between 0 and 1
+func (k *Kiuas) warmingProgress(config *Config) float64 {
+	span := config.ReadyThreshold - config.WarmingThreshold
+	if span <= 0 {
+		return 0
+	}
+	return math.Min(math.Max((k.Temperature-config.WarmingThreshold)/span, 0), 1)
+}
+
+func progressBar(fraction float64) string {
+	filled := int(math.Round(fraction * progressBarWidth))
+	return strings.Repeat("▓", filled) + strings.Repeat("░", progressBarWidth-filled)
+}
+
+// Build the warming message with the current temperature, a progress bar and the estimated ready time
+func warmingMessage(kiuas *Kiuas, config *Config, locale Locale) string {
+	progress := kiuas.warmingProgress(config)
+	return locale.Format(config.parseMode(), "warming_progress", kiuas.EstimatedReadyTime.Format("15:04"), kiuas.Temperature, progressBar(progress), progress*100)
+}
+
+// Edit the warming message with the current progress every WarmingUpdateInterval
+func updateWarmingMessage(b TelegramBot, ctx context.Context, kiuas *Kiuas, config *Config, currentTime time.Time) {
+	rsvp := kiuas.RSVP
+	// A queued message is edited once the outbox has delivered it
+	if config.WarmingUpdateInterval <= 0 || rsvp == nil || rsvp.MessageID == 0 || kiuas.ReadyNotificationSent {
+		return
+	}
+	if currentTime.Sub(rsvp.Updated) < config.WarmingUpdateInterval {
+		return
+	}
+
+	// Keep the previous estimate if the temperature is not rising right now
+	if kiuas.tempChangeRate() > 0 {
+		kiuas.EstimatedReadyTime = currentTime.Add(time.Duration(kiuas.getEstimateReadySeconds(config)) * time.Second)
+	}
+	rsvp.SetText(warmingMessage(kiuas, config, rsvp.Locale), currentTime)
+	if err := editRSVPMessage(b, ctx, rsvp, true); err != nil {
+		fmt.Printf("Failed to edit message: %v\n", err)
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressBar(t *testing.T) {
+	tests := []struct {
+		fraction float64
+		expected string
+	}{
+		{0, "░░░░░░░░░░"},
+		{0.44, "▓▓▓▓░░░░░░"},
+		{1, "▓▓▓▓▓▓▓▓▓▓"},
+	}
+	for _, tt := range tests {
+		if got := progressBar(tt.fraction); got != tt.expected {
+			t.Errorf("progressBar(%v) = %s, expected %s", tt.fraction, got, tt.expected)
+		}
+	}
+}
+
+func TestWarmingProgress(t *testing.T) {
+	config := &Config{WarmingThreshold: 30, ReadyThreshold: 70}
+	for temp, expected := range map[float64]float64{20: 0, 50: 0.5, 80: 1} {
+		kiuas := &Kiuas{Temperature: temp}
+		if got := kiuas.warmingProgress(config); got != expected {
+			t.Errorf("Expected progress %v at %v °C, got %v", expected, temp, got)
+		}
+	}
+}
+
+func TestCheckAndNotify_LiveWarmingMessage(t *testing.T) {
+	start := time.Date(2024, 12, 24, 17, 0, 0, 0, time.UTC)
+	kiuas := &Kiuas{Temperature: 40.0}
+	config := &Config{
+		NotificationChatID:    -200,
+		ReadyThreshold:        70.0,
+		WarmingThreshold:      30.0,
+		LowerBound:            0.001,
+		ResetThreshold:        25.0,
+		WarmingUpdateInterval: 5 * time.Minute,
+	}
+	mockBot := &MockTelegramBot{}
+	ctx := context.Background()
+
+	// One degree per minute
+	for i := 0; i <= 30; i++ {
+		now := start.Add(time.Duration(i) * time.Minute)
+		kiuas.Temperature = 40.0 + float64(i)
+		kiuas.AddTemperatureRecord(kiuas.Temperature, now)
+		checkAndNotify(mockBot, ctx, kiuas, config, nil, nil, now)
+	}
+
+	if len(mockBot.SentMessages) != 1 {
+		t.Fatalf("Expected only the warming message to be sent, got %v", mockBot.SentMessages)
+	}
+	// Edited every five minutes from 17:07 to 17:27 and once more when ready at 17:30
+	if len(mockBot.EditedMessages) != 6 {
+		t.Fatalf("Expected 6 edits, got %d", len(mockBot.EditedMessages))
+	}
+
+	progress := mockBot.EditedMessages[0].Text
+	if !strings.Contains(progress, "Valmis klo 17:30") || !strings.Contains(progress, "47\\.0 °C ▓▓▓▓░░░░░░ 42 %") {
+		t.Errorf("Expected progress with updated estimate, got %q", progress)
+	}
+
+	ready := mockBot.EditedMessages[5]
+	if !strings.HasPrefix(ready.Text, "*Sauna valmis\\!*🔥") || ready.ReplyMarkup == nil {
+		t.Errorf("Expected the message to be turned into the ready message, got %+v", ready)
+	}
+}
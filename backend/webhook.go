@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"bt-telegram/format"
+)
+
+const (
+	// Delay before the first retry of a webhook, doubled on every attempt
+	webhookRetryDelay = 5 * time.Second
+	// How many times a webhook is tried before giving up
+	webhookAttempts = 5
+	// Number of deliveries shown in /info
+	webhookLogSize = 10
+	// Header with the HMAC-SHA256 of the body, "sha256=" followed by the hex digest
+	webhookSignatureHeader = "X-Saunatonttu-Signature"
+)
+
+// WebhookPayload is the JSON body posted by WebhookNotifier
+type WebhookPayload struct {
+	Event       SaunaEvent `json:"event"`
+	Text        string     `json:"text"`
+	Time        time.Time  `json:"time"`
+	Temperature float64    `json:"temperature"`
+	Humidity    float64    `json:"humidity"`
+}
+
+// WebhookDelivery is the result of posting an event to a webhook
+type WebhookDelivery struct {
+	Time     time.Time
+	Event    SaunaEvent
+	Host     string
+	Attempts int
+	Err      error
+}
+
+// WebhookLog keeps the latest webhook deliveries for /info
+type WebhookLog struct {
+	mu         sync.Mutex
+	Deliveries []WebhookDelivery
+}
+
+func (l *WebhookLog) record(d WebhookDelivery) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.Deliveries = append(l.Deliveries, d)
+	if len(l.Deliveries) > webhookLogSize {
+		l.Deliveries = l.Deliveries[len(l.Deliveries)-webhookLogSize:]
+	}
+}
+
+// Summary of the deliveries for /info, empty if there are none
+func (l *WebhookLog) summary(locale Locale, loc *time.Location) string {
+	if l == nil {
+		return ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.Deliveries) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString(locale.T("info_webhooks"))
+	for _, d := range l.Deliveries {
+		result := locale.T("info_webhook_ok")
+		if d.Err != nil {
+			result = d.Err.Error()
+		}
+		sb.WriteString(locale.T("info_webhook", d.Time.In(loc).Format("02.01. 15:04"), d.Event, d.Host, d.Attempts, result))
+	}
+	return sb.String()
+}
+
+// Sign the body with the secret
+func signWebhook(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// WebhookNotifier posts the notifications as JSON to a URL. With a secret the body is
+// signed in the X-Saunatonttu-Signature header. notifyWith calls Notify in the background,
+// so the readings never wait for the webhook. A failed delivery is retried with exponential
+// backoff in a goroutine of its own, and the result is recorded in the log.
+type WebhookNotifier struct {
+	URL        string
+	Secret     string
+	Locale     Locale
+	Client     *http.Client
+	Log        *WebhookLog
+	RetryDelay time.Duration // defaults to webhookRetryDelay
+}
+
+func (w *WebhookNotifier) Notify(ctx context.Context, n Notification) error {
+	body, err := json.Marshal(WebhookPayload{
+		Event:       n.Event,
+		Text:        w.Locale.Format(format.Plain, n.Key, n.Args...),
+		Time:        n.Time,
+		Temperature: n.Temperature,
+		Humidity:    n.Humidity,
+	})
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	header.Set("X-Saunatonttu-Event", string(n.Event))
+	if w.Secret != "" {
+		header.Set(webhookSignatureHeader, signWebhook(w.Secret, body))
+	}
+
+	err = post(ctx, w.Client, w.URL, body, header)
+	if err == nil {
+		w.record(n, 1, nil)
+		return nil
+	}
+	log.Printf("Webhook %s failed, retrying: %v\n", w.host(), err)
+	// The retries may take minutes, they do not hold up the background work waited for on shutdown
+	go w.retry(ctx, n, body, header)
+	return nil
+}
+
+func (w *WebhookNotifier) retry(ctx context.Context, n Notification, body []byte, header http.Header) {
+	var err error
+	delay := w.RetryDelay
+	if delay == 0 {
+		delay = webhookRetryDelay
+	}
+	for attempt := 2; attempt <= webhookAttempts; attempt++ {
+		select {
+		case <-ctx.Done():
+			w.record(n, attempt-1, ctx.Err())
+			return
+		case <-time.After(delay):
+		}
+		if err = post(ctx, w.Client, w.URL, body, header); err == nil {
+			w.record(n, attempt, nil)
+			return
+		}
+		delay *= 2
+	}
+	log.Printf("Webhook %s failed after %d attempts: %v\n", w.host(), webhookAttempts, err)
+	w.record(n, webhookAttempts, err)
+}
+
+func (w *WebhookNotifier) record(n Notification, attempts int, err error) {
+	// The error of the HTTP client contains the whole URL
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	w.Log.record(WebhookDelivery{Time: n.Time, Event: n.Event, Host: w.host(), Attempts: attempts, Err: err})
+}
+
+// Only the host of the URL is logged, the path may contain a token
+func (w *WebhookNotifier) host() string {
+	u, err := url.Parse(w.URL)
+	if err != nil {
+		return "invalid URL"
+	}
+	return u.Host
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier_SignedPayload(t *testing.T) {
+	var body []byte
+	var signature, event string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		signature = r.Header.Get(webhookSignatureHeader)
+		event = r.Header.Get("X-Saunatonttu-Event")
+	}))
+	defer server.Close()
+
+	webhookLog := &WebhookLog{}
+	notifier := &WebhookNotifier{URL: server.URL + "/hook", Secret: "löyly", Locale: LocaleEn, Client: server.Client(), Log: webhookLog}
+	when := time.Date(2024, 12, 24, 18, 0, 0, 0, time.UTC)
+	err := notifier.Notify(context.Background(), Notification{Event: EventReady, Key: "ready", Args: []any{75.0}, Time: when, Temperature: 75.0, Humidity: 12.5})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// The receiver computes the HMAC of the raw body with the shared secret
+	if !hmac.Equal([]byte(signature), []byte(signWebhook("löyly", body))) || !strings.HasPrefix(signature, "sha256=") {
+		t.Errorf("Invalid signature %q", signature)
+	}
+	var payload WebhookPayload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if event != "ready" || payload.Event != EventReady || payload.Temperature != 75.0 || payload.Humidity != 12.5 || !payload.Time.Equal(when) {
+		t.Errorf("Unexpected payload %+v", payload)
+	}
+	if len(webhookLog.Deliveries) != 1 || webhookLog.Deliveries[0].Attempts != 1 || webhookLog.Deliveries[0].Err != nil {
+		t.Errorf("Expected a successful delivery in the log, got %+v", webhookLog.Deliveries)
+	}
+}
+
+func TestWebhookNotifier_Retries(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) < 3 {
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	defer server.Close()
+
+	webhookLog := &WebhookLog{}
+	notifier := &WebhookNotifier{URL: server.URL, Locale: LocaleFi, Client: server.Client(), Log: webhookLog, RetryDelay: time.Millisecond}
+	if err := notifier.Notify(context.Background(), Notification{Event: EventCooled, Key: "cooled", Args: []any{35.0}, Time: time.Now()}); err != nil {
+		t.Fatalf("Expected the failure to be retried in the background, got %v", err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		webhookLog.mu.Lock()
+		n := len(webhookLog.Deliveries)
+		webhookLog.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	webhookLog.mu.Lock()
+	defer webhookLog.mu.Unlock()
+	if len(webhookLog.Deliveries) != 1 || webhookLog.Deliveries[0].Attempts != 3 || webhookLog.Deliveries[0].Err != nil {
+		t.Errorf("Expected delivery on the third attempt, got %+v", webhookLog.Deliveries)
+	}
+}
+
+func TestWebhookLog_Summary(t *testing.T) {
+	webhookLog := &WebhookLog{}
+	if webhookLog.summary(LocaleFi, time.UTC) != "" {
+		t.Errorf("Expected no summary without deliveries")
+	}
+
+	when := time.Date(2024, 12, 24, 18, 0, 0, 0, time.UTC)
+	for i := 0; i < webhookLogSize+2; i++ {
+		webhookLog.record(WebhookDelivery{Time: when, Event: EventReady, Host: "koti.example.org", Attempts: 1})
+	}
+	webhookLog.record(WebhookDelivery{Time: when, Event: EventNoData, Host: "koti.example.org", Attempts: 5, Err: io.ErrUnexpectedEOF})
+
+	if len(webhookLog.Deliveries) != webhookLogSize {
+		t.Errorf("Expected the log to keep %d deliveries, got %d", webhookLogSize, len(webhookLog.Deliveries))
+	}
+	summary := webhookLog.summary(LocaleFi, time.UTC)
+	if !strings.HasPrefix(summary, "\n\nWebhookit:\n24.12. 18:00 ready → koti.example.org, yrityksiä 1: ok") {
+		t.Errorf("Unexpected summary %q", summary)
+	}
+	if !strings.HasSuffix(summary, "no_data → koti.example.org, yrityksiä 5: unexpected EOF") {
+		t.Errorf("Expected the failed delivery last, got %q", summary)
+	}
+}
+
+func TestCheckAndNotify_CooledWebhook(t *testing.T) {
+	var events []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		events = append(events, r.Header.Get("X-Saunatonttu-Event"))
+	}))
+	defer server.Close()
+
+	kiuas := &Kiuas{Temperature: 35.0, WarmingNotificationSent: true, ReadyNotificationSent: true, Webhooks: &WebhookLog{}}
+	config := &Config{
+		ReadyThreshold: 70.0,
+		ResetThreshold: 40.0,
+		Notifiers:      []NotifierConfig{{Type: "webhook", URL: server.URL, Events: []SaunaEvent{EventCooled}}},
+	}
+	checkAndNotify(&MockTelegramBot{}, context.Background(), kiuas, config, nil, nil, time.Now())
+	background.Wait()
+
+	if len(events) != 1 || events[0] != "cooled" || len(kiuas.Webhooks.Deliveries) != 1 {
+		t.Errorf("Expected a cooled webhook, got %v", events)
+	}
+}
+
+func TestCheckAndNotify_SlowWebhook(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	kiuas := &Kiuas{Temperature: 35.0, WarmingNotificationSent: true, ReadyNotificationSent: true, Webhooks: &WebhookLog{}}
+	config := &Config{
+		ReadyThreshold: 70.0,
+		ResetThreshold: 40.0,
+		Notifiers:      []NotifierConfig{{Type: "webhook", URL: server.URL}},
+	}
+
+	// The first attempt waits for the webhook, the ingest path does not
+	done := make(chan struct{})
+	go func() {
+		checkAndNotify(&MockTelegramBot{}, context.Background(), kiuas, config, nil, nil, time.Now())
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected the readings not to wait for the webhook")
+	}
+	close(release)
+	background.Wait()
+
+	if kiuas.Webhooks.summary(LocaleFi, time.UTC) == "" {
+		t.Errorf("Expected the delivery to be recorded once the webhook answered")
+	}
+}